@@ -0,0 +1,89 @@
+package cli
+
+// notest
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/NethermindEth/juno/internal/config"
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// prefixedDatabases are the databases whose keys are prefixed with the
+// namespace they belong to, given by db.ClassifyKey.
+var prefixedDatabases = map[string]bool{"SYNCHRONIZER": true, "STATE": true}
+
+// dbCmd groups the commands that work on the database of the node.
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Work on the database of the node.",
+}
+
+// dbInspectCmd prints the number of keys of each database and, in the
+// databases whose keys are prefixed, of each namespace.
+var dbInspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Count the keys of each database and namespace.",
+	Long: `Count the keys of each database and namespace. The keys of the
+SYNCHRONIZER and STATE databases are counted by namespace, such as the state
+trie, the storage tries or the memory pages; the keys that don't belong to
+any known namespace are counted as unknown. The node must not be running.`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		env, err := db.NewMDBXEnv(config.Runtime.DbPath, 100, 0)
+		if err != nil {
+			return fmt.Errorf("couldn't open the database: %w", err)
+		}
+		defer env.Close()
+		names, err := db.ListDatabases(env)
+		if err != nil {
+			return err
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DATABASE\tNAMESPACE\tKEYS")
+		for _, name := range names {
+			database, err := db.NewMDBXDatabase(env, name)
+			if err != nil {
+				return err
+			}
+			if !prefixedDatabases[name] {
+				n, err := database.NumberOfItems()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\t\t%d\n", name, n)
+				continue
+			}
+			counts := make(map[string]uint64)
+			err = database.Iterate(func(key, _ []byte) error {
+				namespace, ok := db.ClassifyKey(key)
+				if !ok {
+					namespace = "unknown"
+				}
+				counts[namespace]++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			namespaces := make([]string, 0, len(counts))
+			for namespace := range counts {
+				namespaces = append(namespaces, namespace)
+			}
+			sort.Strings(namespaces)
+			for _, namespace := range namespaces {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", name, namespace, counts[namespace])
+			}
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	dbCmd.AddCommand(dbInspectCmd)
+	rootCmd.AddCommand(dbCmd)
+}
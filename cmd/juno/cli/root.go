@@ -56,7 +56,11 @@ var (
 				os.Exit(0)
 			}(sig)
 
-			feederGatewayClient := feeder.NewClient(config.Runtime.Starknet.FeederGateway, "/feeder_gateway", nil)
+			feederGatewayClient := feeder.NewFailoverClient(
+				append([]string{config.Runtime.Starknet.FeederGateway}, config.Runtime.Starknet.FallbackFeederGateways...),
+				"/feeder_gateway", nil)
+			feederGatewayClient.LimitRequests(config.Runtime.Starknet.MaxFeederRequests)
+			feederGatewayClient.SetFailoverThreshold(config.Runtime.Starknet.FailoverThreshold)
 			// Subscribe the RPC client to the main loop if it is enabled in
 			// the config.
 			if config.Runtime.RPC.Enabled {
@@ -74,21 +78,17 @@ var (
 			if err := db.InitializeMDBXEnv(config.Runtime.DbPath, 100, 0); err != nil {
 				log.Default.With("Error", err).Fatal("Error starting the database environment")
 			}
+			if !config.Runtime.Starknet.Enabled && config.Runtime.Starknet.NamespaceByChain {
+				// The Synchronizer sets the namespace of the chain it syncs;
+				// without it, the chain is the one of the feeder gateway.
+				chainID := starknet.FeederChainID(feederGatewayClient, config.Runtime.Starknet.Network)
+				services.SetNamespace(starknet.ChainNamespace(chainID))
+			}
 
-			// Initialize ABI Service
-			processHandler.Add("ABI Service", false, services.AbiService.Run, services.AbiService.Close)
-
-			// Initialize State storage service
-			processHandler.Add("State Storage Service", false, services.StateService.Run, services.StateService.Close)
-
-			// Initialize Transactions Storage Service
-			processHandler.Add("Transactions Storage Service", false, services.TransactionService.Run, services.TransactionService.Close)
-
-			// Initialize Block Storage Service
-			processHandler.Add("Block Storage Service", false, services.BlockService.Run, services.BlockService.Close)
-
-			// Initialize Contract Hash storage service
-			processHandler.Add("Contract Hash Storage Service", false, services.ContractHashService.Run, services.ContractHashService.Close)
+			// Initialize the storage services
+			services.BlockService.SetCacheSize(config.Runtime.RPC.BlockCacheSize)
+			storageServices := services.NewStorageManager()
+			processHandler.Add("Storage Services", false, storageServices.Run, storageServices.Close)
 
 			// Subscribe the Starknet Synchronizer to the main loop if it is enabled in
 			// the config.
@@ -110,7 +110,14 @@ var (
 				if err != nil {
 					log.Default.With("Error", err).Fatal("Error starting the SYNCHRONIZER database")
 				}
-				stateSynchronizer := starknet.NewSynchronizer(synchronizerDb, ethereumClient, feederGatewayClient)
+				var stateDb db.DatabaseTransactional
+				if config.Runtime.Starknet.SeparateStateDb {
+					stateDb, err = db.NewMDBXDatabase(env, "STATE")
+					if err != nil {
+						log.Default.With("Error", err).Fatal("Error starting the STATE database")
+					}
+				}
+				stateSynchronizer := starknet.NewSynchronizer(synchronizerDb, stateDb, ethereumClient, feederGatewayClient)
 				// Initialize the Starknet Synchronizer Service.
 				processHandler.Add("Starknet Synchronizer", true, stateSynchronizer.UpdateState,
 					stateSynchronizer.Close)
@@ -191,9 +198,15 @@ func initConfig() {
 		errpkg.CheckFatal(err, "Failed to read in Config after generation.")
 	}
 
+	// Config files written before a key was added don't set it.
+	viper.SetDefault("ethereum.log_chunk_size", config.DefaultLogChunkSize)
+	viper.SetDefault("starknet.check_old_root", true)
+	viper.SetDefault("starknet.skip_verified_blocks", true)
+
 	// Unmarshal and log runtime config instance.
 	err = viper.Unmarshal(&config.Runtime)
 	errpkg.CheckFatal(err, "Unable to unmarshal runtime config instance.")
+	errpkg.CheckFatal(config.Runtime.Validate(), "Invalid config.")
 	log.Default.With(
 		"Database Path", config.Runtime.DbPath,
 		"Rpc Port", config.Runtime.RPC.Port,
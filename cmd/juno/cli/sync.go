@@ -0,0 +1,66 @@
+package cli
+
+// notest
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/NethermindEth/juno/internal/config"
+	"github.com/NethermindEth/juno/internal/log"
+	"github.com/NethermindEth/juno/pkg/starknet"
+	"github.com/spf13/cobra"
+)
+
+// syncCmd runs only the StarkNet Synchronizer, without the RPC, REST and
+// metrics servers.
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync the StarkNet state without serving any API.",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err := starknet.RunNode(ctx, starknet.SynchronizerConfig{
+			DbPath:                 config.Runtime.DbPath,
+			EthereumNode:           config.Runtime.Ethereum.Node,
+			LogChunkSize:           config.Runtime.Ethereum.LogChunkSize,
+			FeederGateway:          config.Runtime.Starknet.FeederGateway,
+			FallbackFeederGateways: config.Runtime.Starknet.FallbackFeederGateways,
+			FailoverThreshold:      config.Runtime.Starknet.FailoverThreshold,
+			Network:                config.Runtime.Starknet.Network,
+			ApiSync:                config.Runtime.Starknet.ApiSync,
+			DeepCheck:              config.Runtime.Starknet.DeepCheck,
+			EventBufferSize:        config.Runtime.Starknet.EventBufferSize,
+			EventQueueSize:         config.Runtime.Starknet.EventQueueSize,
+			CodeFetchLimit:         config.Runtime.Starknet.CodeFetchLimit,
+			MaxFeederRequests:      config.Runtime.Starknet.MaxFeederRequests,
+			StorageRootCacheSize:   config.Runtime.Starknet.StorageRootCacheSize,
+			SeparateStateDb:        config.Runtime.Starknet.SeparateStateDb,
+			NamespaceByChain:       config.Runtime.Starknet.NamespaceByChain,
+			StartBlock:             config.Runtime.Starknet.StartBlock,
+			CheckOldRoot:           config.Runtime.Starknet.CheckOldRoot,
+			PollInterval:           time.Duration(config.Runtime.Starknet.PollInterval) * time.Second,
+			RestartOnPanic:         config.Runtime.Starknet.RestartOnPanic,
+			SkipVerifiedBlocks:     config.Runtime.Starknet.SkipVerifiedBlocks,
+			BackfillSafeNoSync:     config.Runtime.Starknet.BackfillSafeNoSync,
+			BackfillSyncPeriod:     time.Duration(config.Runtime.Starknet.BackfillSyncPeriod) * time.Second,
+			WarmStateTrie:          config.Runtime.Starknet.WarmStateTrie,
+			WarmStateTrieLevels:    config.Runtime.Starknet.WarmStateTrieLevels,
+			DiffRetention:          config.Runtime.Starknet.DiffRetention,
+			PrefetchStateTries:     config.Runtime.Starknet.PrefetchStateTries,
+		})
+		if err != nil {
+			log.Default.With("Error", err).Error("Synchronizer stopped")
+			return err
+		}
+		log.Default.Info("App closing...Bye!!!")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+}
@@ -4,9 +4,12 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/NethermindEth/juno/internal/errpkg"
 	"github.com/NethermindEth/juno/internal/log"
@@ -15,8 +18,9 @@ import (
 
 // rpcConfig represents the juno RPC configuration.
 type rpcConfig struct {
-	Enabled bool `yaml:"enabled" mapstructure:"enabled"`
-	Port    int  `yaml:"port" mapstructure:"port"`
+	Enabled        bool `yaml:"enabled" mapstructure:"enabled"`
+	Port           int  `yaml:"port" mapstructure:"port"`
+	BlockCacheSize int  `yaml:"block_cache_size" mapstructure:"block_cache_size"`
 }
 
 // metricsConfig represents the Prometheus Metrics configuration.
@@ -25,9 +29,55 @@ type metricsConfig struct {
 	Port    int  `yaml:"port" mapstructure:"port"`
 }
 
+// DefaultLogChunkSize is the default number of layer 1 blocks whose logs
+// are requested at once. Some providers reject eth_getLogs ranges larger
+// than 2000 blocks.
+const DefaultLogChunkSize = 2000
+
+// ErrInvalidLogChunkSize is returned by Config.Validate when the log chunk
+// size is not positive.
+var ErrInvalidLogChunkSize = errors.New("ethereum log_chunk_size must be greater than 0")
+
+var (
+	// ErrInvalidFeederGateway is returned by Config.Validate when a feeder
+	// gateway URL isn't an absolute http or https URL.
+	ErrInvalidFeederGateway = errors.New("feeder gateway must be an http or https URL")
+	// ErrInvalidEthereumNode is returned by Config.Validate when the layer
+	// 1 sync is enabled and the Ethereum node is neither an http, https,
+	// ws or wss URL nor the path of an IPC endpoint.
+	ErrInvalidEthereumNode = errors.New("ethereum node must be an http, https, ws or wss URL or an IPC path")
+	// ErrUnknownNetwork is returned by Config.Validate when the network
+	// isn't one the node can sync.
+	ErrUnknownNetwork = errors.New("starknet network must be mainnet or goerli")
+)
+
+// ValidationError lists all the problems found in a configuration.
+// errors.Is reports whether any of them is the target.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.Error()
+	}
+	return "invalid config: " + strings.Join(problems, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	for _, problem := range e.Problems {
+		if errors.Is(problem, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // ethereumConfig represents the juno Ethereum configuration.
 type ethereumConfig struct {
-	Node string `yaml:"node" mapstructure:"node"`
+	Node         string `yaml:"node" mapstructure:"node"`
+	LogChunkSize int    `yaml:"log_chunk_size" mapstructure:"log_chunk_size"`
 }
 
 // restConfig represents the juno REST configuration.
@@ -39,10 +89,31 @@ type restConfig struct {
 
 // starknetConfig represents the juno StarkNet configuration.
 type starknetConfig struct {
-	Enabled       bool   `yaml:"enabled" mapstructure:"enabled"`
-	FeederGateway string `yaml:"feeder_gateway" mapstructure:"feeder_gateway"`
-	Network       string `yaml:"network" mapstructure:"network"`
-	ApiSync       bool   `yaml:"api_sync" mapstructure:"api_sync"`
+	Enabled                bool     `yaml:"enabled" mapstructure:"enabled"`
+	FeederGateway          string   `yaml:"feeder_gateway" mapstructure:"feeder_gateway"`
+	FallbackFeederGateways []string `yaml:"fallback_feeder_gateways" mapstructure:"fallback_feeder_gateways"`
+	FailoverThreshold      int      `yaml:"failover_threshold" mapstructure:"failover_threshold"`
+	Network                string   `yaml:"network" mapstructure:"network"`
+	ApiSync                bool     `yaml:"api_sync" mapstructure:"api_sync"`
+	DeepCheck              bool     `yaml:"deep_check" mapstructure:"deep_check"`
+	EventBufferSize        int      `yaml:"event_buffer_size" mapstructure:"event_buffer_size"`
+	EventQueueSize         int      `yaml:"event_queue_size" mapstructure:"event_queue_size"`
+	CodeFetchLimit         int      `yaml:"code_fetch_limit" mapstructure:"code_fetch_limit"`
+	MaxFeederRequests      int      `yaml:"max_feeder_requests" mapstructure:"max_feeder_requests"`
+	StorageRootCacheSize   int      `yaml:"storage_root_cache_size" mapstructure:"storage_root_cache_size"`
+	SeparateStateDb        bool     `yaml:"separate_state_db" mapstructure:"separate_state_db"`
+	NamespaceByChain       bool     `yaml:"namespace_by_chain" mapstructure:"namespace_by_chain"`
+	StartBlock             uint64   `yaml:"start_block" mapstructure:"start_block"`
+	CheckOldRoot           bool     `yaml:"check_old_root" mapstructure:"check_old_root"`
+	PollInterval           int      `yaml:"poll_interval" mapstructure:"poll_interval"`
+	RestartOnPanic         bool     `yaml:"restart_on_panic" mapstructure:"restart_on_panic"`
+	SkipVerifiedBlocks     bool     `yaml:"skip_verified_blocks" mapstructure:"skip_verified_blocks"`
+	BackfillSafeNoSync     bool     `yaml:"backfill_safe_no_sync" mapstructure:"backfill_safe_no_sync"`
+	BackfillSyncPeriod     int      `yaml:"backfill_sync_period" mapstructure:"backfill_sync_period"`
+	WarmStateTrie          bool     `yaml:"warm_state_trie" mapstructure:"warm_state_trie"`
+	WarmStateTrieLevels    int      `yaml:"warm_state_trie_levels" mapstructure:"warm_state_trie_levels"`
+	DiffRetention          int      `yaml:"diff_retention" mapstructure:"diff_retention"`
+	PrefetchStateTries     bool     `yaml:"prefetch_state_tries" mapstructure:"prefetch_state_tries"`
 }
 
 // Config represents the juno configuration.
@@ -125,14 +196,24 @@ func New() {
 		errpkg.CheckFatal(err, "Failed to create Config directory.")
 	}
 	data, err := yaml.Marshal(&Config{
-		Ethereum: ethereumConfig{Node: ""},
-		RPC:      rpcConfig{Enabled: true, Port: 8080},
+		Ethereum: ethereumConfig{Node: "", LogChunkSize: DefaultLogChunkSize},
+		RPC:      rpcConfig{Enabled: true, Port: 8080, BlockCacheSize: 1024},
 		Metrics:  metricsConfig{Enabled: true, Port: 2048},
 		DbPath:   DataDir,
 		REST:     restConfig{Enabled: true, Port: 8100, Prefix: "/feeder_gateway"},
 		Starknet: starknetConfig{
 			Enabled: true, ApiSync: true, FeederGateway: "https://alpha-mainnet.starknet.io",
-			Network: "mainnet",
+			Network: "mainnet", EventBufferSize: 256, EventQueueSize: 256, CodeFetchLimit: 8, SeparateStateDb: true,
+			StorageRootCacheSize: 100000,
+			NamespaceByChain:     true,
+			CheckOldRoot:         true,
+			PollInterval:         15,
+			SkipVerifiedBlocks:   true,
+			MaxFeederRequests:    32,
+			FailoverThreshold:    3,
+			BackfillSyncPeriod:   30,
+			WarmStateTrie:        true,
+			WarmStateTrieLevels:  16,
 		},
 	})
 	errpkg.CheckFatal(err, "Failed to marshal Config instance to byte data.")
@@ -144,6 +225,57 @@ func New() {
 	}
 }
 
+// Validate checks that the configuration values are usable. The sync
+// settings are only checked if the StarkNet sync is enabled. All the
+// problems found are returned in a *ValidationError.
+func (c *Config) Validate() error {
+	var problems []error
+	if c.Ethereum.LogChunkSize <= 0 {
+		problems = append(problems, ErrInvalidLogChunkSize)
+	}
+	if c.Starknet.Enabled {
+		problems = append(problems, ValidateSync(
+			c.Starknet.Network,
+			append([]string{c.Starknet.FeederGateway}, c.Starknet.FallbackFeederGateways...),
+			c.Starknet.ApiSync,
+			c.Ethereum.Node,
+		)...)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateSync returns the problems with the settings of the StarkNet
+// sync: the network must be known, the feeder gateways must be http or
+// https URLs and, unless the sync is against the feeder gateway only, the
+// Ethereum node must be a URL or an IPC path that go-ethereum can dial.
+func ValidateSync(network string, feederGateways []string, apiSync bool, ethereumNode string) []error {
+	var problems []error
+	if network != "mainnet" && network != "goerli" {
+		problems = append(problems, fmt.Errorf("%w, got %q", ErrUnknownNetwork, network))
+	}
+	for _, gateway := range feederGateways {
+		u, err := url.Parse(gateway)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("%w, got %q", ErrInvalidFeederGateway, gateway))
+		}
+	}
+	if !apiSync {
+		u, err := url.Parse(ethereumNode)
+		switch {
+		case ethereumNode == "" || err != nil:
+			problems = append(problems, fmt.Errorf("%w, got %q", ErrInvalidEthereumNode, ethereumNode))
+		case u.Scheme == "":
+			// The path of an IPC endpoint.
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ws" && u.Scheme != "wss" || u.Host == "":
+			problems = append(problems, fmt.Errorf("%w, got %q", ErrInvalidEthereumNode, ethereumNode))
+		}
+	}
+	return problems
+}
+
 // Exists checks if the default configuration file already exists
 func Exists() bool {
 	f := filepath.Join(Dir, "juno.yaml")
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -23,3 +24,110 @@ func TestConfig(t *testing.T) {
 		t.Fatal("default config file must be exists")
 	}
 }
+
+func TestConfigValidate(t *testing.T) {
+	cfg := Config{Ethereum: ethereumConfig{LogChunkSize: DefaultLogChunkSize}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+	for _, size := range []int{0, -1} {
+		cfg.Ethereum.LogChunkSize = size
+		if err := cfg.Validate(); !errors.Is(err, ErrInvalidLogChunkSize) {
+			t.Errorf("Validate() with log chunk size %d = %v, want %v", size, err, ErrInvalidLogChunkSize)
+		}
+	}
+}
+
+func TestValidateSync(t *testing.T) {
+	tests := [...]struct {
+		name           string
+		network        string
+		feederGateways []string
+		apiSync        bool
+		ethereumNode   string
+		want           []error
+	}{
+		{
+			name:           "api sync",
+			network:        "mainnet",
+			feederGateways: []string{"https://alpha-mainnet.starknet.io"},
+			apiSync:        true,
+		},
+		{
+			name:           "websocket node",
+			network:        "goerli",
+			feederGateways: []string{"https://alpha4.starknet.io"},
+			ethereumNode:   "wss://goerli.example.com",
+		},
+		{
+			name:           "ipc node",
+			network:        "mainnet",
+			feederGateways: []string{"http://localhost:9545"},
+			ethereumNode:   "/root/.ethereum/geth.ipc",
+		},
+		{
+			name:           "unknown network",
+			network:        "testnet",
+			feederGateways: []string{"https://alpha4.starknet.io"},
+			apiSync:        true,
+			want:           []error{ErrUnknownNetwork},
+		},
+		{
+			name:           "invalid fallback",
+			network:        "mainnet",
+			feederGateways: []string{"https://alpha-mainnet.starknet.io", "alpha-mainnet.starknet.io"},
+			apiSync:        true,
+			want:           []error{ErrInvalidFeederGateway},
+		},
+		{
+			name:           "missing node",
+			network:        "mainnet",
+			feederGateways: []string{"https://alpha-mainnet.starknet.io"},
+			want:           []error{ErrInvalidEthereumNode},
+		},
+		{
+			name:           "every problem",
+			network:        "",
+			feederGateways: []string{"ftp://alpha-mainnet.starknet.io"},
+			ethereumNode:   "tcp://localhost:8545",
+			want:           []error{ErrUnknownNetwork, ErrInvalidFeederGateway, ErrInvalidEthereumNode},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := ValidateSync(test.network, test.feederGateways, test.apiSync, test.ethereumNode)
+			if len(problems) != len(test.want) {
+				t.Fatalf("ValidateSync() = %v, want %v", problems, test.want)
+			}
+			for i, want := range test.want {
+				if !errors.Is(problems[i], want) {
+					t.Errorf("problem %d = %v, want %v", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigValidateSync(t *testing.T) {
+	cfg := Config{
+		Ethereum: ethereumConfig{LogChunkSize: 0},
+		Starknet: starknetConfig{Enabled: true, Network: "mainnet", FeederGateway: "alpha-mainnet.starknet.io"},
+	}
+	err := cfg.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate() = %v, want a *ValidationError", err)
+	}
+	if len(validationErr.Problems) != 3 {
+		t.Errorf("Validate() found %d problems, want 3: %v", len(validationErr.Problems), err)
+	}
+	for _, want := range []error{ErrInvalidLogChunkSize, ErrInvalidFeederGateway, ErrInvalidEthereumNode} {
+		if !errors.Is(err, want) {
+			t.Errorf("Validate() = %v, want it to wrap %v", err, want)
+		}
+	}
+	cfg.Starknet.Enabled = false
+	if err := cfg.Validate(); len(err.(*ValidationError).Problems) != 1 {
+		t.Errorf("Validate() with the sync disabled = %v, want only the log chunk size", err)
+	}
+}
@@ -1,7 +1,7 @@
 package block
 
 import (
-	"reflect"
+	"fmt"
 	"testing"
 
 	"github.com/NethermindEth/juno/internal/db"
@@ -29,6 +29,13 @@ func TestManager(t *testing.T) {
 			EventCount:      19,
 			EventCommitment: types.HexToFelt("0"),
 		},
+		{
+			// A status unknown to this version is kept as received.
+			BlockHash:   types.HexToBlockHash("1"),
+			BlockNumber: 2176,
+			Status:      types.BlockStatusUnknown,
+			RawStatus:   "NEW_STATUS",
+		},
 	}
 	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
 	if err != nil {
@@ -39,6 +46,12 @@ func TestManager(t *testing.T) {
 		t.Error(err)
 	}
 	manager := NewManager(database)
+	if block := manager.GetBlockByNumber(blocks[0].BlockNumber); block != nil {
+		t.Errorf("unexpected block %d before it is stored", blocks[0].BlockNumber)
+	}
+	if block := manager.GetBlockByHash(blocks[0].BlockHash); block != nil {
+		t.Errorf("unexpected block with hash %s before it is stored", blocks[0].BlockHash.Hex())
+	}
 	for _, block := range blocks {
 		key := block.BlockHash
 		manager.PutBlock(key, block)
@@ -47,7 +60,7 @@ func TestManager(t *testing.T) {
 		if returnedBlock == nil {
 			t.Errorf("unexpected nil after search for block with hash %s", block.BlockHash)
 		}
-		if !reflect.DeepEqual(block, returnedBlock) {
+		if !block.Equal(returnedBlock) {
 			t.Errorf("block")
 		}
 		// Get block by number
@@ -55,9 +68,65 @@ func TestManager(t *testing.T) {
 		if returnedBlock == nil {
 			t.Errorf("unexpected nil after search for block with number %d", block.BlockNumber)
 		}
-		if !reflect.DeepEqual(block, returnedBlock) {
+		if !block.Equal(returnedBlock) {
 			t.Errorf("block")
 		}
+		// Delete the block
+		returnedBlock = manager.DeleteBlock(block.BlockNumber)
+		if !block.Equal(returnedBlock) {
+			t.Errorf("unexpected block returned after deleting block %d", block.BlockNumber)
+		}
+		if ok, _ := database.Has(buildHashKey(key)); ok {
+			t.Errorf("block with hash %s still stored after delete", block.BlockHash)
+		}
+		if returnedBlock = manager.DeleteBlock(block.BlockNumber); returnedBlock != nil {
+			t.Errorf("unexpected block after deleting missing block %d", block.BlockNumber)
+		}
 	}
 	manager.Close()
 }
+
+// nonTransactional hides the transactions of the database it wraps.
+type nonTransactional struct {
+	db.Database
+}
+
+func TestManagerPutBlocks(t *testing.T) {
+	blocks := make([]*types.Block, 3)
+	for i := range blocks {
+		blocks[i] = &types.Block{
+			BlockHash:   types.HexToBlockHash(fmt.Sprintf("b%d", i)),
+			ParentHash:  types.HexToBlockHash(fmt.Sprintf("b%d", i-1)),
+			BlockNumber: uint64(i),
+			Status:      types.BlockStatusAcceptedOnL2,
+		}
+	}
+	env, err := db.NewMDBXEnv(t.TempDir(), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+	for _, name := range []string{"TRANSACTIONAL", "NON_TRANSACTIONAL"} {
+		t.Run(name, func(t *testing.T) {
+			database, err := db.NewMDBXDatabase(env, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manager := NewManager(database)
+			if name == "NON_TRANSACTIONAL" {
+				manager = NewManager(nonTransactional{database})
+			}
+			if err := manager.PutBlocks(blocks); err != nil {
+				t.Fatal(err)
+			}
+			for _, block := range blocks {
+				if got := manager.GetBlockByNumber(block.BlockNumber); !block.Equal(got) {
+					t.Errorf("block %d = %v, want %v", block.BlockNumber, got, block)
+				}
+				if got := manager.GetBlockByHash(block.BlockHash); !block.Equal(got) {
+					t.Errorf("block with hash %s = %v, want %v", block.BlockHash.Hex(), got, block)
+				}
+			}
+		})
+	}
+}
@@ -26,6 +26,9 @@ func (manager *Manager) GetBlockByHash(blockHash types.BlockHash) *types.Block {
 	// Search on the database
 	rawResult, err := manager.database.Get(hashKey)
 	if err != nil {
+		if db.IsNotFound(err) {
+			return nil
+		}
 		panic(any(err))
 	}
 	// Check not found
@@ -49,6 +52,9 @@ func (manager *Manager) GetBlockByNumber(blockNumber uint64) *types.Block {
 	// Search for the hash key
 	hashKey, err := manager.database.Get(numberKey)
 	if err != nil {
+		if db.IsNotFound(err) {
+			return nil
+		}
 		panic(any(err))
 	}
 	// Check not found
@@ -59,6 +65,9 @@ func (manager *Manager) GetBlockByNumber(blockNumber uint64) *types.Block {
 	// Search for the block
 	rawResult, err := manager.database.Get(hashKey)
 	if err != nil {
+		if db.IsNotFound(err) {
+			return nil
+		}
 		panic(any(err))
 	}
 	// Check not found
@@ -77,25 +86,89 @@ func (manager *Manager) GetBlockByNumber(blockNumber uint64) *types.Block {
 // PutBlock saves the given block with the given hash as key. If any error happens
 // then panic.
 func (manager *Manager) PutBlock(blockHash types.BlockHash, block *types.Block) {
+	if err := putBlock(manager.database, blockHash, block); err != nil {
+		panic(any(err))
+	}
+}
+
+// PutBlocks saves the given blocks with their hashes as keys. If the
+// database supports transactions, they are all saved in a single one, so
+// either every block is saved or, if an error is returned, none is.
+func (manager *Manager) PutBlocks(blocks []*types.Block) error {
+	put := func(txn db.DatabaseOperations) error {
+		for _, block := range blocks {
+			if err := putBlock(txn, block.BlockHash, block); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if database, ok := manager.database.(db.DatabaseTransactional); ok {
+		return database.RunTxn(put)
+	}
+	return put(manager.database)
+}
+
+// putBlock saves the block under its hash and its number under the hash.
+func putBlock(txn db.DatabaseOperations, blockHash types.BlockHash, block *types.Block) error {
 	// Build the keys
 	hashKey := buildHashKey(blockHash)
 	numberKey := buildNumberKey(block.BlockNumber)
 	// Encode the block as []byte
 	rawValue, err := marshalBlock(block)
 	if err != nil {
-		panic(any(err))
+		// notest
+		return err
 	}
-	// TODO: Use transaction?
 	// Save (hashKey, block)
-	err = manager.database.Put(hashKey, rawValue)
+	if err := txn.Put(hashKey, rawValue); err != nil {
+		return err
+	}
+	// Save (hashNumber, hashKey)
+	return txn.Put(numberKey, hashKey)
+}
+
+// DeleteBlock removes the block with the given block number and returns it.
+// If the block does not exist then returns nil. If any error happens, then
+// panic.
+func (manager *Manager) DeleteBlock(blockNumber uint64) *types.Block {
+	// Build the number key
+	numberKey := buildNumberKey(blockNumber)
+	// Check not found
+	ok, err := manager.database.Has(numberKey)
 	if err != nil {
+		// notest
 		panic(any(err))
 	}
-	// Save (hashNumber, hashKey)
-	err = manager.database.Put(numberKey, hashKey)
+	if !ok {
+		return nil
+	}
+	// Search for the hash key and the block
+	hashKey, err := manager.database.Get(numberKey)
+	if err != nil {
+		// notest
+		panic(any(err))
+	}
+	rawResult, err := manager.database.Get(hashKey)
+	if err != nil {
+		// notest
+		panic(any(err))
+	}
+	block, err := unmarshalBlock(rawResult)
 	if err != nil {
+		// notest
+		panic(any(err))
+	}
+	// Remove (hashKey, block) and (hashNumber, hashKey)
+	if err := manager.database.Delete(hashKey); err != nil {
+		// notest
 		panic(any(err))
 	}
+	if err := manager.database.Delete(numberKey); err != nil {
+		// notest
+		panic(any(err))
+	}
+	return block
 }
 
 func (manager *Manager) Close() {
@@ -113,11 +186,16 @@ func buildNumberKey(blockNumber uint64) []byte {
 }
 
 func marshalBlock(block *types.Block) ([]byte, error) {
+	// The status is stored by name, so an unknown one is kept as received.
+	status := block.Status.String()
+	if block.RawStatus != "" {
+		status = block.RawStatus
+	}
 	protoBlock := Block{
 		Hash:             block.BlockHash.Bytes(),
 		BlockNumber:      block.BlockNumber,
 		ParentBlockHash:  block.ParentHash.Bytes(),
-		Status:           block.Status.String(),
+		Status:           status,
 		SequencerAddress: block.Sequencer.Bytes(),
 		GlobalStateRoot:  block.NewRoot.Bytes(),
 		OldRoot:          block.OldRoot.Bytes(),
@@ -146,11 +224,17 @@ func unmarshalBlock(data []byte) (*types.Block, error) {
 	if err != nil {
 		return nil, err
 	}
+	status, err := types.ParseBlockStatus(protoBlock.Status)
+	rawStatus := ""
+	if err != nil {
+		rawStatus = protoBlock.Status
+	}
 	block := types.Block{
 		BlockHash:       types.BytesToBlockHash(protoBlock.Hash),
 		ParentHash:      types.BytesToBlockHash(protoBlock.ParentBlockHash),
 		BlockNumber:     protoBlock.BlockNumber,
-		Status:          types.StringToBlockStatus(protoBlock.Status),
+		Status:          status,
+		RawStatus:       rawStatus,
 		Sequencer:       types.BytesToAddress(protoBlock.SequencerAddress),
 		NewRoot:         types.BytesToFelt(protoBlock.GlobalStateRoot),
 		OldRoot:         types.BytesToFelt(protoBlock.OldRoot),
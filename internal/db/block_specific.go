@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/NethermindEth/juno/internal/log"
 )
@@ -78,6 +79,53 @@ func (db *BlockSpecificDatabase) Put(key []byte, blockNumber uint64, value []byt
 	return nil
 }
 
+// Delete removes every version of the key.
+func (db *BlockSpecificDatabase) Delete(key []byte) error {
+	return db.deleteFrom(key, 0)
+}
+
+// DeleteAfter removes the versions of the key stored at blocks after the
+// given block. If no version is left, the key is removed.
+func (db *BlockSpecificDatabase) DeleteAfter(key []byte, blockNumber uint64) error {
+	if blockNumber == ^uint64(0) {
+		// notest
+		return nil
+	}
+	return db.deleteFrom(key, blockNumber+1)
+}
+
+// deleteFrom removes the versions of the key stored at the given block or
+// later.
+func (db *BlockSpecificDatabase) deleteFrom(key []byte, blockNumber uint64) error {
+	rawList := db.get(key)
+	if rawList == nil {
+		return nil
+	}
+	var list sortedList
+	if err := json.Unmarshal(rawList, &list); err != nil {
+		// notest
+		return err
+	}
+	kept := list[:sort.Search(len(list), func(i int) bool { return list[i] >= blockNumber })]
+	for _, version := range list[len(kept):] {
+		if err := db.database.Delete(newCompoundedKey(key, version)); err != nil {
+			return err
+		}
+	}
+	if len(kept) == len(list) {
+		return nil
+	}
+	if len(kept) == 0 {
+		return db.database.Delete(key)
+	}
+	newRawList, err := json.Marshal(&kept)
+	if err != nil {
+		// notest
+		return err
+	}
+	return db.database.Put(key, newRawList)
+}
+
 func (db *BlockSpecificDatabase) Close() {
 	db.database.Close()
 }
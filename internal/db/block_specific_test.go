@@ -164,3 +164,47 @@ func TestBlockSpecificDatabase_Get(t *testing.T) {
 	}
 	db.Close()
 }
+
+func TestBlockSpecificDatabase_DeleteAfter(t *testing.T) {
+	env, err := NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := NewMDBXDatabase(env, "BlockSpecific")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewBlockSpecificDatabase(database)
+	defer db.Close()
+
+	key := []byte("Key1")
+	for block, value := range map[uint64]string{0: "Value1", 2: "Value2", 5: "Value3"} {
+		if err := db.Put(key, block, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteAfter(key, 3); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := db.Get(key, 10); err != nil || string(value) != "Value2" {
+		t.Errorf("Get(10) after DeleteAfter(3) = %s, %v, want Value2", value, err)
+	}
+	// Nothing is stored after block 3 anymore.
+	if err := db.DeleteAfter(key, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := db.Get(key, 10); err != nil || value != nil {
+		t.Errorf("Get(10) after Delete = %s, %v, want nothing", value, err)
+	}
+	if n, err := database.NumberOfItems(); err != nil || n != 0 {
+		t.Errorf("%d items left after Delete, want 0", n)
+	}
+	// Deleting a missing key does nothing.
+	if err := db.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package db
+
+import "bytes"
+
+// chainNamespaces are the prefixes of the keys of each network when the
+// databases are namespaced by chain.
+var chainNamespaces = []string{"mainnet/", "goerli/"}
+
+// keyPrefixes maps the prefixes of the keys of the SYNCHRONIZER and STATE
+// databases to the namespace they belong to.
+var keyPrefixes = []struct {
+	prefix, namespace string
+}{
+	{"state_trie_", "state_trie"},
+	{"contract_state_", "contract_state"},
+	{"memory_pages", "memory_pages"},
+	{"l1_transactions", "l1_transactions"},
+	{"gps_verifier", "gps_verifier"},
+	{"processed_facts", "processed_facts"},
+	{"facts", "facts"},
+	{"latestBlockSynced", "latest_block_synced"},
+	{"latestStateRoot", "latest_state_root"},
+}
+
+// ClassifyKey returns the namespace a key of the SYNCHRONIZER or STATE
+// database belongs to, such as "state_trie" for the nodes of the state
+// trie or "memory_pages" for the memory pages of the sync. Keys of
+// storage tries, which are prefixed with the hexadecimal address of their
+// contract, are in "storage_trie". If the key has the prefix of a chain,
+// the namespace is prefixed with it too, as in "goerli/state_trie". The
+// keys of the other databases aren't prefixed, so their database is their
+// namespace. ok is false if the key doesn't belong to any known
+// namespace.
+func ClassifyKey(key []byte) (namespace string, ok bool) {
+	for _, chain := range chainNamespaces {
+		if bytes.HasPrefix(key, []byte(chain)) {
+			namespace, ok = ClassifyKey(key[len(chain):])
+			if !ok {
+				return "", false
+			}
+			return chain + namespace, true
+		}
+	}
+	for _, p := range keyPrefixes {
+		if bytes.HasPrefix(key, []byte(p.prefix)) {
+			return p.namespace, true
+		}
+	}
+	if isStorageTrieKey(key) {
+		return "storage_trie", true
+	}
+	return "", false
+}
+
+// isStorageTrieKey returns whether the key is the one of a node of a
+// storage trie: the address of the contract in lowercase hexadecimal
+// followed by either the path of the node, made of '0' and '1', or
+// "root".
+func isStorageTrieKey(key []byte) bool {
+	key = bytes.TrimSuffix(key, []byte("root"))
+	if len(key) == 0 {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
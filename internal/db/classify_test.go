@@ -0,0 +1,36 @@
+package db
+
+import "testing"
+
+func TestClassifyKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		namespace string
+		ok        bool
+	}{
+		{"state_trie_root", "state_trie", true},
+		{"state_trie_0110", "state_trie", true},
+		{"contract_state_1bd7", "contract_state", true},
+		{"1bd7ca87f139693e6681be2042194cf631c4e8d77027bf0ea9e6d55fc6018acroot", "storage_trie", true},
+		{"1bd7ca87f139693e6681be2042194cf631c4e8d77027bf0ea9e6d55fc6018ac0101", "storage_trie", true},
+		{"memory_pages0x1", "memory_pages", true},
+		{"l1_transactions12", "l1_transactions", true},
+		{"gps_verifier0x1", "gps_verifier", true},
+		{"facts12", "facts", true},
+		{"processed_facts0x1", "processed_facts", true},
+		{"latestBlockSynced", "latest_block_synced", true},
+		{"latestStateRoot", "latest_state_root", true},
+		{"goerli/state_trie_root", "goerli/state_trie", true},
+		{"mainnet/1bd7root", "mainnet/storage_trie", true},
+		{"mainnet/unknown", "", false},
+		{"root", "", false},
+		{"1BD7", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		namespace, ok := ClassifyKey([]byte(test.key))
+		if namespace != test.namespace || ok != test.ok {
+			t.Errorf("ClassifyKey(%q) = %q, %t, want %q, %t", test.key, namespace, ok, test.namespace, test.ok)
+		}
+	}
+}
@@ -23,6 +23,27 @@ type DatabaseTransactional interface {
 	RunTxn(DatabaseTxOp) error
 }
 
+// DatabaseIterable represents a transactional database whose key-value
+// pairs can be iterated over in increasing order of the keys.
+type DatabaseIterable interface {
+	DatabaseTransactional
+	// IterateFrom calls fn with every key-value pair whose key is equal to
+	// or greater than start, in increasing order of the keys, until fn
+	// returns an error, which is returned. The slices passed to fn are only
+	// valid until it returns.
+	IterateFrom(start []byte, fn func(key, value []byte) error) error
+}
+
+// OperationsIterable represents database operations, such as those of a
+// transaction, whose key-value pairs can be iterated over in increasing
+// order of the keys.
+type OperationsIterable interface {
+	DatabaseOperations
+	// IterateFrom is as DatabaseIterable.IterateFrom. The database
+	// mustn't be modified until it returns.
+	IterateFrom(start []byte, fn func(key, value []byte) error) error
+}
+
 // DatabaseTxOp executes all the operations inside the
 // txn function. If the functions returns an error then
 // the transaction is aborted, on another case the transaction
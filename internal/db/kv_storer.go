@@ -1,11 +1,21 @@
 package db
 
+import (
+	"fmt"
+
+	"github.com/NethermindEth/juno/pkg/store"
+)
+
 // KeyValueStore implement the Storer interface that use a Databaser
 type KeyValueStore struct {
 	db     DatabaseOperations
 	prefix []byte
 }
 
+// KeyValueStore is the store of the tries kept in the database, so it must
+// implement store.Storer.
+var _ store.Storer = KeyValueStore{}
+
 func NewKeyValueStore(db DatabaseOperations, prefix string) KeyValueStore {
 	return KeyValueStore{
 		db:     db,
@@ -21,13 +31,31 @@ func (k KeyValueStore) Delete(key []byte) {
 	}
 }
 
-func (k KeyValueStore) Get(key []byte) ([]byte, bool) {
+// Get returns the value of the key, or store.ErrNotFound if the key isn't
+// in the database. Any other error of the database is returned wrapped,
+// so that a failed read isn't mistaken for a missing key.
+func (k KeyValueStore) Get(key []byte) ([]byte, error) {
 	get, err := k.db.Get(append(k.prefix, key...))
 	if err != nil {
-		// notest
-		return nil, false
+		if IsNotFound(err) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("key value store: get %q: %w", key, err)
+	}
+	if get == nil {
+		return nil, store.ErrNotFound
+	}
+	return get, nil
+}
+
+// Has returns true if the key is in the database, without reading its
+// value.
+func (k KeyValueStore) Has(key []byte) (bool, error) {
+	has, err := k.db.Has(append(k.prefix, key...))
+	if err != nil {
+		return false, fmt.Errorf("key value store: has %q: %w", key, err)
 	}
-	return get, get != nil
+	return has, nil
 }
 
 func (k KeyValueStore) Put(key, val []byte) {
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/NethermindEth/juno/pkg/store"
 )
 
 // setupTransactionDbTest creates a new TransactionDb for Tests
@@ -24,8 +27,8 @@ func TestKeyValueStoreNewDbAndCommit(t *testing.T) {
 
 	database.Put([]byte("key"), []byte("value"))
 
-	get, has := database.Get([]byte("key"))
-	if !has || get == nil {
+	get, err := database.Get([]byte("key"))
+	if err != nil || get == nil {
 		t.Fail()
 	}
 
@@ -33,13 +36,39 @@ func TestKeyValueStoreNewDbAndCommit(t *testing.T) {
 		t.Fail()
 	}
 
+	if has, err := database.Has([]byte("key")); err != nil || !has {
+		t.Fail()
+	}
+
 	database.Delete([]byte("key"))
 
-	get, has = database.Get([]byte("key"))
-	if has || get != nil {
+	get, err = database.Get([]byte("key"))
+	if !errors.Is(err, store.ErrNotFound) || get != nil {
+		t.Fail()
+	}
+
+	if has, err := database.Has([]byte("key")); err != nil || has {
 		t.Fail()
 	}
 	database.Rollback()
 
 	dbKV.Close()
 }
+
+// failingDatabase is a database whose reads always fail.
+type failingDatabase struct{ DatabaseOperations }
+
+var errRead = errors.New("read failed")
+
+func (failingDatabase) Get([]byte) ([]byte, error) { return nil, errRead }
+func (failingDatabase) Has([]byte) (bool, error)   { return false, errRead }
+
+func TestKeyValueStoreReadError(t *testing.T) {
+	kv := NewKeyValueStore(failingDatabase{}, "test")
+	if _, err := kv.Get([]byte("key")); !errors.Is(err, errRead) || errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, errRead)
+	}
+	if _, err := kv.Has([]byte("key")); !errors.Is(err, errRead) {
+		t.Errorf("Has() error = %v, want %v", err, errRead)
+	}
+}
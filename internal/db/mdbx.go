@@ -15,6 +15,9 @@ var (
 	ErrNotFound = errors.New("not found error")
 	// ErrTx is returned when a transaction fails for some reason.
 	ErrTx = errors.New("transaction error")
+	// ErrNotIterable is returned when the pairs of a database can't be
+	// iterated over.
+	ErrNotIterable = errors.New("database not iterable")
 )
 
 // MDBXDatabase is a Database that works with the LMDB database. A database is a
@@ -126,8 +129,23 @@ func (x *MDBXDatabase) NumberOfItems() (uint64, error) {
 	return entries, err
 }
 
-// Close closes the database. Notice this function does not close the
-// environment.
+// Iterate calls fn with every key-value pair of the database in
+// increasing order of the keys, until fn returns an error, which is
+// returned. The slices passed to fn are only valid until it returns.
+func (x *MDBXDatabase) Iterate(fn func(key, value []byte) error) error {
+	return x.IterateFrom(nil, fn)
+}
+
+// IterateFrom calls fn with every key-value pair of the database whose
+// key is equal to or greater than start, in increasing order of the keys,
+// until fn returns an error, which is returned. The slices passed to fn
+// are only valid until it returns.
+func (x *MDBXDatabase) IterateFrom(start []byte, fn func(key, value []byte) error) error {
+	return x.env.View(func(txn *mdbx.Txn) error {
+		return iterateFrom(txn, x.dbi, start, fn)
+	})
+}
+
 func (x *MDBXDatabase) Close() {
 	x.env.CloseDBI(x.dbi)
 }
@@ -195,6 +213,30 @@ func (tx MDBXTransaction) NumberOfItems() (uint64, error) {
 	return numberOfItems(tx.txn, tx.dbi)
 }
 
+// IterateFrom calls fn with every key-value pair of the transaction whose
+// key is equal to or greater than start, in increasing order of the keys,
+// until fn returns an error, which is returned. The transaction mustn't
+// be modified until it returns.
+func (tx MDBXTransaction) IterateFrom(start []byte, fn func(key, value []byte) error) error {
+	return iterateFrom(tx.txn, tx.dbi, start, fn)
+}
+
+// ListDatabases returns the names of the named databases of the
+// environment.
+func ListDatabases(env *mdbx.Env) ([]string, error) {
+	var names []string
+	err := env.View(func(txn *mdbx.Txn) error {
+		var err error
+		names, err = txn.ListDBI()
+		if err != nil {
+			// notest
+			return newDbError(ErrInternal, err)
+		}
+		return nil
+	})
+	return names, err
+}
+
 // IsNotFound checks is the given error is an ErrNotFound.
 func IsNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound)
@@ -242,6 +284,35 @@ func del(txn *mdbx.Txn, dbi mdbx.DBI, key []byte) error {
 	return nil
 }
 
+// iterateFrom calls fn with every key-value pair of the database dbi
+// whose key is equal to or greater than start, in increasing order of the
+// keys, until fn returns an error, which is returned.
+func iterateFrom(txn *mdbx.Txn, dbi mdbx.DBI, start []byte, fn func(key, value []byte) error) error {
+	cursor, err := txn.OpenCursor(dbi)
+	if err != nil {
+		// notest
+		return newDbError(ErrInternal, err)
+	}
+	defer cursor.Close()
+	op := uint(mdbx.First)
+	if len(start) > 0 {
+		op = mdbx.SetRange
+	}
+	for setKey := start; ; setKey, op = nil, mdbx.Next {
+		key, value, err := cursor.Get(setKey, nil, op)
+		if mdbx.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			// notest
+			return newDbError(ErrInternal, err)
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+}
+
 func numberOfItems(txn *mdbx.Txn, dbi mdbx.DBI) (uint64, error) {
 	stats, err := txn.StatDBI(dbi)
 	if err != nil {
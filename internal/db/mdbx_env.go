@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"time"
 
 	"github.com/torquem-ch/mdbx-go/mdbx"
 )
@@ -13,8 +14,10 @@ var (
 
 var ErrEnvNoInitialized = errors.New("environment is no initialize")
 
-// InitializeMDBXEnv initializes the Juno LMDB environment.
+// InitializeMDBXEnv initializes the Juno LMDB environment. If an
+// environment was initialized already, it's closed first.
 func InitializeMDBXEnv(path string, optMaxDB uint64, flags uint) (err error) {
+	CloseMDBXEnv()
 	defer func() {
 		if err == nil {
 			initialized = true
@@ -57,3 +60,34 @@ func GetMDBXEnv() (*mdbx.Env, error) {
 	}
 	return env, nil
 }
+
+// CloseMDBXEnv closes the environment initialized by InitializeMDBXEnv, if
+// any. The databases opened in it must be closed before.
+func CloseMDBXEnv() {
+	if initialized {
+		env.Close()
+	}
+	env = nil
+	initialized = false
+}
+
+// SetSafeNoSync stops flushing the commits on env to disk one by one, which
+// speeds up the writes. The commits are flushed on the first commit once
+// period has passed since the last flush, and by SetDurable. A crash of the
+// system may lose the commits not flushed yet, but never corrupts the
+// database; a crash of the process loses nothing.
+func SetSafeNoSync(env *mdbx.Env, period time.Duration) error {
+	if err := env.SetSyncPeriod(period); err != nil {
+		return err
+	}
+	return env.SetFlags(mdbx.SafeNoSync)
+}
+
+// SetDurable flushes the commits on env not flushed yet to disk and makes
+// every following commit flushed, undoing SetSafeNoSync.
+func SetDurable(env *mdbx.Env) error {
+	if err := env.UnsetFlags(mdbx.SafeNoSync); err != nil {
+		return err
+	}
+	return env.Sync(true, false)
+}
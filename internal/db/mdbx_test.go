@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/torquem-ch/mdbx-go/mdbx"
 )
 
 func TestNewMDBXDatabase(t *testing.T) {
@@ -134,6 +137,88 @@ func TestMDBXDatabase_NumberOfItems(t *testing.T) {
 	assertNumberOfItems(t, db, 5)
 }
 
+func TestMDBXDatabase_Iterate(t *testing.T) {
+	db := initDatabases(t, 1)[0]
+	defer db.Close()
+
+	for _, key := range []string{"key_2", "key_0", "key_1"} {
+		if err := db.Put([]byte(key), []byte("value_"+key[4:])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keys []string
+	err := db.Iterate(func(key, value []byte) error {
+		if want := "value_" + string(key[4:]); string(value) != want {
+			t.Errorf("value of %s is %s, want %s", key, value, want)
+		}
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"key_0", "key_1", "key_2"}; fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("iterated keys %v, want %v", keys, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = db.Iterate(func(_, _ []byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Iterate() = %v after %d calls, want the error of the first call", err, calls)
+	}
+}
+
+func TestMDBXDatabase_IterateFrom(t *testing.T) {
+	db := initDatabases(t, 1)[0]
+	defer db.Close()
+
+	for _, key := range []string{"key_2", "key_0", "key_1", "other"} {
+		if err := db.Put([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for start, want := range map[string][]string{
+		"key_1":  {"key_1", "key_2", "other"},
+		"key_10": {"key_2", "other"},
+		"p":      nil,
+	} {
+		var keys []string
+		err := db.IterateFrom([]byte(start), func(key, _ []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(keys) != fmt.Sprint(want) {
+			t.Errorf("IterateFrom(%s) iterated keys %v, want %v", start, keys, want)
+		}
+	}
+}
+
+func TestListDatabases(t *testing.T) {
+	env, err := NewMDBXEnv(t.TempDir(), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"STATE", "ABI"} {
+		if _, err := NewMDBXDatabase(env, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := ListDatabases(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != fmt.Sprint([]string{"ABI", "STATE"}) {
+		t.Errorf("ListDatabases() = %v, want [ABI STATE]", names)
+	}
+}
+
 func TestMDBXDatabase_RunTxn(t *testing.T) {
 	dbs := initDatabases(t, 1)
 	defer closeDatabases(dbs)
@@ -166,6 +251,35 @@ func TestMDBXDatabase_RunTxn(t *testing.T) {
 	assertNumberOfItems(t, db, 0)
 }
 
+func TestSetSafeNoSync(t *testing.T) {
+	env, err := NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewMDBXDatabase(env, "DATABASE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSafeNoSync(env, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if flags, err := env.Flags(); err != nil || flags&mdbx.SafeNoSync != mdbx.SafeNoSync {
+		t.Errorf("flags after SetSafeNoSync = %x, %v, want SafeNoSync set", flags, err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDurable(env); err != nil {
+		t.Fatal(err)
+	}
+	if flags, err := env.Flags(); err != nil || flags&mdbx.SafeNoSync != 0 {
+		t.Errorf("flags after SetDurable = %x, %v, want SafeNoSync cleared", flags, err)
+	}
+	if value, err := db.Get([]byte("key")); err != nil || !bytes.Equal(value, []byte("value")) {
+		t.Errorf("value after SetDurable = %s, %v, want value", value, err)
+	}
+}
+
 func TestNewDbError(t *testing.T) {
 	err := newDbError(ErrInternal, fmt.Errorf(""))
 	if !errors.Is(err, ErrInternal) {
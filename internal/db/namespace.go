@@ -0,0 +1,139 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+)
+
+// NamespacedDatabase is a view of a database where every key is prefixed
+// with a namespace, so that several datasets, for instance of different
+// chains, can share a database without their keys colliding.
+type NamespacedDatabase struct {
+	database  DatabaseTransactional
+	namespace []byte
+}
+
+var (
+	_ DatabaseIterable   = (*NamespacedDatabase)(nil)
+	_ OperationsIterable = namespacedOperations{}
+	_ OperationsIterable = MDBXTransaction{}
+)
+
+// NewNamespacedDatabase returns a view of database where every key is
+// prefixed with namespace.
+func NewNamespacedDatabase(database DatabaseTransactional, namespace string) *NamespacedDatabase {
+	return &NamespacedDatabase{database: database, namespace: []byte(namespace)}
+}
+
+// namespacedKey returns the key prefixed with namespace, in a new slice.
+func namespacedKey(namespace, key []byte) []byte {
+	k := make([]byte, 0, len(namespace)+len(key))
+	return append(append(k, namespace...), key...)
+}
+
+func (d *NamespacedDatabase) Has(key []byte) (bool, error) {
+	return d.database.Has(namespacedKey(d.namespace, key))
+}
+
+func (d *NamespacedDatabase) Get(key []byte) ([]byte, error) {
+	return d.database.Get(namespacedKey(d.namespace, key))
+}
+
+func (d *NamespacedDatabase) Put(key, value []byte) error {
+	return d.database.Put(namespacedKey(d.namespace, key), value)
+}
+
+func (d *NamespacedDatabase) Delete(key []byte) error {
+	return d.database.Delete(namespacedKey(d.namespace, key))
+}
+
+// NumberOfItems returns the number of items in the whole underlying
+// database, since the items of a namespace can't be counted without
+// iterating over them.
+func (d *NamespacedDatabase) NumberOfItems() (uint64, error) {
+	// notest
+	return d.database.NumberOfItems()
+}
+
+// Close closes the underlying database.
+func (d *NamespacedDatabase) Close() {
+	d.database.Close()
+}
+
+// IterateFrom calls fn with the key-value pairs of the namespace whose key
+// is equal to or greater than start, without the namespace, in increasing
+// order of the keys, until fn returns an error, which is returned. If the
+// underlying database isn't a DatabaseIterable, ErrNotIterable is
+// returned.
+func (d *NamespacedDatabase) IterateFrom(start []byte, fn func(key, value []byte) error) error {
+	database, ok := d.database.(DatabaseIterable)
+	if !ok {
+		// notest
+		return ErrNotIterable
+	}
+	return iterateNamespace(database.IterateFrom, d.namespace, start, fn)
+}
+
+// iterateNamespace calls fn with the key-value pairs iterated from start
+// in namespace, without the namespace, until the end of the namespace.
+func iterateNamespace(iterateFrom func([]byte, func(key, value []byte) error) error,
+	namespace, start []byte, fn func(key, value []byte) error,
+) error {
+	errEndOfNamespace := errors.New("end of namespace")
+	err := iterateFrom(namespacedKey(namespace, start), func(key, value []byte) error {
+		if !bytes.HasPrefix(key, namespace) {
+			return errEndOfNamespace
+		}
+		return fn(key[len(namespace):], value)
+	})
+	if err == errEndOfNamespace {
+		return nil
+	}
+	return err
+}
+
+// RunTxn runs op on a transaction of the underlying database where every
+// key is prefixed with the namespace.
+func (d *NamespacedDatabase) RunTxn(op DatabaseTxOp) error {
+	return d.database.RunTxn(func(txn DatabaseOperations) error {
+		return op(namespacedOperations{txn: txn, namespace: d.namespace})
+	})
+}
+
+// namespacedOperations prefixes the keys of the operations on a
+// transaction with a namespace.
+type namespacedOperations struct {
+	txn       DatabaseOperations
+	namespace []byte
+}
+
+func (o namespacedOperations) Has(key []byte) (bool, error) {
+	return o.txn.Has(namespacedKey(o.namespace, key))
+}
+
+func (o namespacedOperations) Get(key []byte) ([]byte, error) {
+	return o.txn.Get(namespacedKey(o.namespace, key))
+}
+
+func (o namespacedOperations) Put(key, value []byte) error {
+	return o.txn.Put(namespacedKey(o.namespace, key), value)
+}
+
+func (o namespacedOperations) Delete(key []byte) error {
+	return o.txn.Delete(namespacedKey(o.namespace, key))
+}
+
+func (o namespacedOperations) NumberOfItems() (uint64, error) {
+	// notest
+	return o.txn.NumberOfItems()
+}
+
+// IterateFrom is as NamespacedDatabase.IterateFrom, on the transaction.
+func (o namespacedOperations) IterateFrom(start []byte, fn func(key, value []byte) error) error {
+	txn, ok := o.txn.(OperationsIterable)
+	if !ok {
+		// notest
+		return ErrNotIterable
+	}
+	return iterateNamespace(txn.IterateFrom, o.namespace, start, fn)
+}
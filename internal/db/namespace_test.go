@@ -0,0 +1,133 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNamespacedDatabase(t *testing.T) {
+	dbs := initDatabases(t, 1)
+	defer closeDatabases(dbs)
+	mainnet := NewNamespacedDatabase(dbs[0], "mainnet/")
+	goerli := NewNamespacedDatabase(dbs[0], "goerli/")
+	key := []byte("key")
+	if err := mainnet.Put(key, []byte("value1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := goerli.Put(key, []byte("value2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := mainnet.Get(key); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !bytes.Equal(value, []byte("value1")) {
+		t.Errorf("unexpected value %s, want: value1", value)
+	}
+	if value, err := goerli.Get(key); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !bytes.Equal(value, []byte("value2")) {
+		t.Errorf("unexpected value %s, want: value2", value)
+	}
+	if value, err := dbs[0].Get([]byte("mainnet/key")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !bytes.Equal(value, []byte("value1")) {
+		t.Errorf("unexpected value %s under the prefixed key, want: value1", value)
+	}
+	if exists, err := dbs[0].Has(key); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if exists {
+		t.Errorf("the key must not exist outside of the namespaces")
+	}
+
+	if err := mainnet.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := mainnet.Has(key); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if exists {
+		t.Errorf("the key must not exist after Delete")
+	}
+	if exists, err := goerli.Has(key); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !exists {
+		t.Errorf("the key of another namespace must not be deleted")
+	}
+}
+
+func TestNamespacedDatabase_RunTxn(t *testing.T) {
+	dbs := initDatabases(t, 1)
+	defer closeDatabases(dbs)
+	database := NewNamespacedDatabase(dbs[0], "goerli/")
+	err := database.RunTxn(func(txn DatabaseOperations) error {
+		if err := txn.Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		if value, err := txn.Get([]byte("key")); err != nil {
+			return err
+		} else if !bytes.Equal(value, []byte("value")) {
+			t.Errorf("unexpected value %s, want: value", value)
+		}
+		if exists, err := txn.Has([]byte("key")); err != nil {
+			return err
+		} else if !exists {
+			t.Errorf("the key must exist after Put")
+		}
+		if err := txn.Put([]byte("other"), []byte("value")); err != nil {
+			return err
+		}
+		return txn.Delete([]byte("other"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := dbs[0].Has([]byte("goerli/key")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !exists {
+		t.Errorf("the key must be stored with the namespace")
+	}
+	if exists, err := dbs[0].Has([]byte("goerli/other")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if exists {
+		t.Errorf("the deleted key must not exist")
+	}
+}
+
+func TestNamespacedDatabase_IterateFrom(t *testing.T) {
+	dbs := initDatabases(t, 1)
+	defer closeDatabases(dbs)
+	mainnet := NewNamespacedDatabase(dbs[0], "mainnet/")
+	goerli := NewNamespacedDatabase(dbs[0], "goerli/")
+	for _, key := range []string{"a", "b", "c"} {
+		if err := mainnet.Put([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		if err := goerli.Put([]byte(key), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keys []string
+	err := goerli.IterateFrom([]byte("b"), func(key, _ []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "b" || keys[1] != "c" {
+		t.Errorf("IterateFrom(b) iterated keys %v, want [b c] without the keys of other namespaces", keys)
+	}
+
+	keys = nil
+	err = goerli.RunTxn(func(txn DatabaseOperations) error {
+		return txn.(OperationsIterable).IterateFrom([]byte("b"), func(key, _ []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "b" || keys[1] != "c" {
+		t.Errorf("IterateFrom(b) in a transaction iterated keys %v, want [b c]", keys)
+	}
+}
@@ -0,0 +1,153 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The deployed contracts database holds the first deployment block of
+// each contract, under deployedAddressPrefix and the contract address, and
+// the contracts first deployed in each block, under deployedBlockPrefix and
+// the big-endian block number, so that the blocks are sorted.
+const (
+	deployedAddressPrefix = "address_"
+	deployedBlockPrefix   = "block_"
+)
+
+// errEndOfRange stops the iteration over the blocks of the deployed
+// contracts database.
+var errEndOfRange = errors.New("end of range")
+
+func deployedAddressKey(contractAddress string) []byte {
+	return append([]byte(deployedAddressPrefix), contractAddress...)
+}
+
+func deployedBlockKey(blockNumber uint64) []byte {
+	return append([]byte(deployedBlockPrefix), encodeBlockNumber(blockNumber)...)
+}
+
+func encodeBlockNumber(blockNumber uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, blockNumber)
+	return b
+}
+
+// PutDeployedContract records that the given contract was deployed at the
+// given block number. If the contract is already recorded, nothing
+// changes, so only the first deployment is kept. It returns whether the
+// contract was recorded.
+func (x *Manager) PutDeployedContract(contractAddress string, blockNumber uint64) bool {
+	if x.deployedDatabase == nil {
+		return false
+	}
+	ok, err := x.deployedDatabase.Has(deployedAddressKey(contractAddress))
+	if err != nil {
+		panic(any(fmt.Errorf("database error: %s", err)))
+	}
+	if ok {
+		return false
+	}
+	addresses := x.getDeployedContracts(blockNumber)
+	rawData, err := json.Marshal(append(addresses, contractAddress))
+	if err != nil {
+		panic(any(fmt.Errorf("marshal error: %s", err)))
+	}
+	if err := x.deployedDatabase.Put(deployedBlockKey(blockNumber), rawData); err != nil {
+		panic(any(fmt.Errorf("database error: %s", err)))
+	}
+	if err := x.deployedDatabase.Put(deployedAddressKey(contractAddress), encodeBlockNumber(blockNumber)); err != nil {
+		panic(any(fmt.Errorf("database error: %s", err)))
+	}
+	return true
+}
+
+// GetDeployedContracts returns the addresses of the contracts first
+// deployed between fromBlock and toBlock, both included, in the order they
+// were deployed.
+func (x *Manager) GetDeployedContracts(fromBlock, toBlock uint64) []string {
+	addresses := make([]string, 0)
+	x.rangeDeployedBlocks(fromBlock, toBlock, func(_ uint64, blockAddresses []string) {
+		addresses = append(addresses, blockAddresses...)
+	})
+	return addresses
+}
+
+// DeleteDeployedContractsAfter removes the contracts first deployed after
+// the given block, so that they are recorded again if they are deployed
+// in a later block.
+func (x *Manager) DeleteDeployedContractsAfter(blockNumber uint64) {
+	if x.deployedDatabase == nil || blockNumber == ^uint64(0) {
+		return
+	}
+	var keys [][]byte
+	x.rangeDeployedBlocks(blockNumber+1, ^uint64(0), func(block uint64, addresses []string) {
+		keys = append(keys, deployedBlockKey(block))
+		for _, address := range addresses {
+			keys = append(keys, deployedAddressKey(address))
+		}
+	})
+	for _, key := range keys {
+		if err := x.deployedDatabase.Delete(key); err != nil {
+			panic(any(fmt.Errorf("database error: %s", err)))
+		}
+	}
+}
+
+// rangeDeployedBlocks calls fn with every block between fromBlock and
+// toBlock, both included, with a deployment, in increasing order.
+func (x *Manager) rangeDeployedBlocks(fromBlock, toBlock uint64, fn func(blockNumber uint64, addresses []string)) {
+	if x.deployedDatabase == nil || fromBlock > toBlock {
+		return
+	}
+	prefix := []byte(deployedBlockPrefix)
+	err := x.deployedDatabase.IterateFrom(deployedBlockKey(fromBlock), func(key, value []byte) error {
+		if !bytes.HasPrefix(key, prefix) || len(key) != len(prefix)+8 {
+			return errEndOfRange
+		}
+		blockNumber := binary.BigEndian.Uint64(key[len(prefix):])
+		if blockNumber > toBlock {
+			return errEndOfRange
+		}
+		var addresses []string
+		if err := json.Unmarshal(value, &addresses); err != nil {
+			panic(any(fmt.Errorf("unmarshal error: %s", err)))
+		}
+		fn(blockNumber, addresses)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEndOfRange) {
+		panic(any(fmt.Errorf("database error: %s", err)))
+	}
+}
+
+func (x *Manager) getDeployedContracts(blockNumber uint64) []string {
+	rawData := x.getDeployed(deployedBlockKey(blockNumber))
+	if rawData == nil {
+		return nil
+	}
+	var addresses []string
+	if err := json.Unmarshal(rawData, &addresses); err != nil {
+		panic(any(fmt.Errorf("unmarshal error: %s", err)))
+	}
+	return addresses
+}
+
+// getDeployed returns the value stored under key in the deployed contracts
+// database, or nil if there is none.
+func (x *Manager) getDeployed(key []byte) []byte {
+	ok, err := x.deployedDatabase.Has(key)
+	if err != nil {
+		panic(any(fmt.Errorf("database error: %s", err)))
+	}
+	if !ok {
+		return nil
+	}
+	rawData, err := x.deployedDatabase.Get(key)
+	if err != nil {
+		panic(any(fmt.Errorf("database error: %s", err)))
+	}
+	return rawData
+}
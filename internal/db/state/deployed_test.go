@@ -0,0 +1,107 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NethermindEth/juno/internal/db"
+)
+
+func TestManager_DeployedContracts(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codeDb, err := db.NewMDBXDatabase(env, "CODE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storageDb, err := db.NewMDBXDatabase(env, "STORAGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployedDb, err := db.NewMDBXDatabase(env, "DEPLOYED_CONTRACTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := NewStateManager(codeDb, db.NewBlockSpecificDatabase(storageDb))
+	defer manager.Close()
+
+	if manager.PutDeployedContract("0x1", 0) {
+		t.Error("PutDeployedContract recorded a contract without a deployed contracts database")
+	}
+	manager.SetDeployedDatabase(deployedDb)
+
+	deployments := [...]struct {
+		Address     string
+		BlockNumber uint64
+		Recorded    bool
+	}{
+		{"0x1", 0, true},
+		{"0x2", 2, true},
+		{"0x3", 2, true},
+		// A redeploy keeps the first deployment block.
+		{"0x1", 3, false},
+		{"0x4", 5, true},
+	}
+	for _, d := range deployments {
+		if recorded := manager.PutDeployedContract(d.Address, d.BlockNumber); recorded != d.Recorded {
+			t.Errorf("PutDeployedContract(%s, %d) = %t, want %t", d.Address, d.BlockNumber, recorded, d.Recorded)
+		}
+	}
+
+	tests := [...]struct {
+		FromBlock, ToBlock uint64
+		Want               []string
+	}{
+		{0, 5, []string{"0x1", "0x2", "0x3", "0x4"}},
+		{1, 3, []string{"0x2", "0x3"}},
+		{3, 4, []string{}},
+		{5, ^uint64(0), []string{"0x4"}},
+		{5, 0, []string{}},
+	}
+	for _, test := range tests {
+		got := manager.GetDeployedContracts(test.FromBlock, test.ToBlock)
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("GetDeployedContracts(%d, %d) = %v, want %v", test.FromBlock, test.ToBlock, got, test.Want)
+		}
+	}
+}
+
+func TestManager_DeleteDeployedContractsAfter(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codeDb, err := db.NewMDBXDatabase(env, "CODE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storageDb, err := db.NewMDBXDatabase(env, "STORAGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployedDb, err := db.NewMDBXDatabase(env, "DEPLOYED_CONTRACTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := NewStateManager(codeDb, db.NewBlockSpecificDatabase(storageDb))
+	manager.SetDeployedDatabase(deployedDb)
+	defer manager.Close()
+
+	manager.PutDeployedContract("0x1", 0)
+	manager.PutDeployedContract("0x2", 2)
+	manager.PutDeployedContract("0x3", 3)
+
+	manager.DeleteDeployedContractsAfter(1)
+	if got := manager.GetDeployedContracts(0, ^uint64(0)); !reflect.DeepEqual(got, []string{"0x1"}) {
+		t.Errorf("GetDeployedContracts after the rewind = %v, want [0x1]", got)
+	}
+	// The removed contracts are recorded again when they are redeployed.
+	if !manager.PutDeployedContract("0x3", 2) {
+		t.Error("PutDeployedContract didn't record a contract removed by the rewind")
+	}
+	if got := manager.GetDeployedContracts(0, ^uint64(0)); !reflect.DeepEqual(got, []string{"0x1", "0x3"}) {
+		t.Errorf("GetDeployedContracts after the redeploy = %v, want [0x1 0x3]", got)
+	}
+}
@@ -5,18 +5,28 @@ import (
 )
 
 // Manager is a database manager, with the objective of managing
-// the contract codes and contract storages databases.
+// the contract codes, contract storages and deployed contracts databases.
 type Manager struct {
-	codeDatabase    db.Database
-	storageDatabase *db.BlockSpecificDatabase
+	codeDatabase     db.Database
+	storageDatabase  *db.BlockSpecificDatabase
+	deployedDatabase db.DatabaseIterable
 }
 
 // NewStateManager returns a new instance of Manager with the given database sources.
 func NewStateManager(codeDatabase db.Database, storageDatabase *db.BlockSpecificDatabase) *Manager {
-	return &Manager{codeDatabase, storageDatabase}
+	return &Manager{codeDatabase: codeDatabase, storageDatabase: storageDatabase}
+}
+
+// SetDeployedDatabase sets the database where the deployed contracts are
+// indexed. Until it's set, no deployed contract is recorded.
+func (m *Manager) SetDeployedDatabase(deployedDatabase db.DatabaseIterable) {
+	m.deployedDatabase = deployedDatabase
 }
 
 func (m *Manager) Close() {
 	m.codeDatabase.Close()
 	m.storageDatabase.Close()
+	if m.deployedDatabase != nil {
+		m.deployedDatabase.Close()
+	}
 }
@@ -96,6 +96,25 @@ func (m *Manager) GetReceipt(txHash types.TransactionHash) *types.TransactionRec
 	return receipt
 }
 
+// DeleteTransaction removes the transaction and the transaction receipt
+// associated with the given key. Missing values are ignored.
+func (m *Manager) DeleteTransaction(txHash types.TransactionHash) {
+	for _, database := range []db.Database{m.txDb, m.receiptDb} {
+		ok, err := database.Has(txHash.Bytes())
+		if err != nil {
+			// notest
+			log.Default.With("error", err).Panicf("database error")
+		}
+		if !ok {
+			continue
+		}
+		if err := database.Delete(txHash.Bytes()); err != nil {
+			// notest
+			log.Default.With("error", err).Panicf("database error")
+		}
+	}
+}
+
 // Close closes the manager, specific the associated database.
 func (m *Manager) Close() {
 	m.txDb.Close()
@@ -122,6 +141,17 @@ func marshalTransaction(transaction types.IsTransaction) ([]byte, error) {
 			MaxFee:             tx.MaxFee.Bytes(),
 		}
 		protoTx.Tx = &Transaction_Invoke{&invoke}
+	case *types.TransactionDeployAccount:
+		deployAccount := DeployAccount{
+			ContractAddress:     tx.ContractAddress.Bytes(),
+			ClassHash:           tx.ClassHash.Bytes(),
+			ContractAddressSalt: tx.ContractAddressSalt.Bytes(),
+			ConstructorCallData: marshalFelts(tx.ConstructorCallData),
+			Signature:           marshalFelts(tx.Signature),
+			Nonce:               tx.Nonce.Bytes(),
+			MaxFee:              tx.MaxFee.Bytes(),
+		}
+		protoTx.Tx = &Transaction_DeployAccount{&deployAccount}
 	}
 	return proto.Marshal(&protoTx)
 }
@@ -151,6 +181,19 @@ func unmarshalTransaction(b []byte) (types.IsTransaction, error) {
 		}
 		return &out, nil
 	}
+	if tx := protoTx.GetDeployAccount(); tx != nil {
+		out := types.TransactionDeployAccount{
+			Hash:                types.BytesToTransactionHash(protoTx.Hash),
+			ContractAddress:     types.BytesToAddress(tx.ContractAddress),
+			ClassHash:           types.BytesToFelt(tx.ClassHash),
+			ContractAddressSalt: types.BytesToFelt(tx.ContractAddressSalt),
+			ConstructorCallData: unmarshalFelts(tx.ConstructorCallData),
+			Signature:           unmarshalFelts(tx.Signature),
+			Nonce:               types.BytesToFelt(tx.Nonce),
+			MaxFee:              types.BytesToFelt(tx.MaxFee),
+		}
+		return &out, nil
+	}
 	// notest
 	return nil, fmt.Errorf("unexpected transaction type")
 }
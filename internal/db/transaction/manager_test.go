@@ -66,6 +66,22 @@ var txs = []types.IsTransaction{
 			types.HexToFelt("0x5f1dd5a5aef88e0498eeca4e7b2ea0fa7110608c11531278742f0b5499af4b3"),
 		},
 	},
+	&types.TransactionDeployAccount{
+		Hash:                types.HexToTransactionHash("0x32b272b6d0d584305a460197aa849b5c7a9a85903b66e9d3e1afa2427ef093e"),
+		ContractAddress:     types.HexToAddress("0x4c05e6bb8de0e9a6d4d4dbf0a2c5ee4bfd1eb47dd8bb5b4e8ec3fc0ce0bd1d2"),
+		ClassHash:           types.HexToFelt("0x25ec026985a3bf9d0cc1fe17326b245dfdc3ff89b8fde106542a3ea56c5a918"),
+		ContractAddressSalt: types.HexToFelt("0x3f5ba0c4bd5aa4b5a0b24a7e9f2a1a20ac8ff1a34bd13a4f2c4f1e7bbd3ebd5"),
+		ConstructorCallData: []types.Felt{
+			types.HexToFelt("0x33434ad846cdd5f23eb73ff09fe6fddd568284a0fb7d1be20ee482f044dabe2"),
+			types.HexToFelt("0x1"),
+		},
+		Signature: []types.Felt{
+			types.HexToFelt("0x6a9e5bf94a0e51b2d4ea7a3ad5ac41d0a76e0fbe2ddbc6d4b4d9ac2a4ad8d1"),
+			types.HexToFelt("0x1c5c0a7a6c0c5d7e1a4fb5b0d6d4ea2f8e5e2b1d3e7cbd2a5cd94c2a8e5a3b"),
+		},
+		Nonce:  types.HexToFelt("0x0"),
+		MaxFee: types.HexToFelt("0x2386f26fc10000"),
+	},
 }
 
 func initManager(t *testing.T) *Manager {
@@ -182,3 +198,28 @@ func TestManager_GetReceipt(t *testing.T) {
 	}
 	manager.Close()
 }
+
+func TestManager_DeleteTransaction(t *testing.T) {
+	manager := initManager(t)
+	for _, tx := range txs {
+		manager.PutTransaction(tx.GetHash(), tx)
+	}
+	for _, receipt := range receipts {
+		manager.PutReceipt(receipt.TxHash, receipt)
+	}
+	for _, tx := range txs {
+		manager.DeleteTransaction(tx.GetHash())
+		if ok, _ := manager.txDb.Has(tx.GetHash().Bytes()); ok {
+			t.Errorf("transaction %s still stored after delete", tx.GetHash())
+		}
+		// Deleting a missing transaction is a no-op.
+		manager.DeleteTransaction(tx.GetHash())
+	}
+	for _, receipt := range receipts {
+		manager.DeleteTransaction(receipt.TxHash)
+		if ok, _ := manager.receiptDb.Has(receipt.TxHash.Bytes()); ok {
+			t.Errorf("receipt %s still stored after delete", receipt.TxHash)
+		}
+	}
+	manager.Close()
+}
@@ -38,6 +38,34 @@ var (
 	},
 		[]string{"Status"},
 	)
+	countL1Events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "count_l1_events",
+		Help: "Number of layer 1 logs received by the subscription and times its buffer or the event queue was full",
+	},
+		[]string{"Status"},
+	)
+	l1EventQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "l1_event_queue_length",
+		Help: "Number of layer 1 events waiting to be processed by the Synchronizer",
+	})
+	feederRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "feeder_requests_in_flight",
+		Help: "Number of requests to the feeder gateway waiting for their response",
+	})
+	storageRootCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "storage_root_cache_entries",
+		Help: "Number of contract storage roots held in memory by the Synchronizer",
+	})
+	blockCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "block_cache_lookups",
+		Help: "Number of blocks looked up in the cache of the block service, by whether they were found",
+	},
+		[]string{"Result"},
+	)
+	blockCacheHitRatio = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "block_cache_hit_ratio",
+		Help: "Ratio of the blocks looked up in the cache of the block service that were found",
+	})
 	timeStarknetSync = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "time_starknet_sync",
 		Help: "Number of updates and commits made or failed",
@@ -105,6 +133,11 @@ func IncreaseStateUpdateSent() {
 	noOfRequests.WithLabelValues("Sent", "State Update").Inc()
 }
 
+// This increases when the request in GetStateUpdateWithBlock in feeder.go is sent
+func IncreaseStateUpdateWithBlockSent() {
+	noOfRequests.WithLabelValues("Sent", "State Update With Block").Inc()
+}
+
 // This increases when the request in GetFullContract in feeder.go is sent
 func IncreaseFullContractsSent() {
 	noOfRequests.WithLabelValues("Sent", "Full Contracts").Inc()
@@ -182,6 +215,11 @@ func IncreaseStateUpdateReceived() {
 	noOfRequests.WithLabelValues("Received", "State Update").Inc()
 }
 
+// This increases when the response of GetStateUpdateWithBlock in feeder.go is received
+func IncreaseStateUpdateWithBlockReceived() {
+	noOfRequests.WithLabelValues("Received", "State Update With Block").Inc()
+}
+
 // This increases when the response of GetFullContract in feeder.go is received
 func IncreaseFullContractsReceived() {
 	noOfRequests.WithLabelValues("Received", "Full Contracts").Inc()
@@ -260,6 +298,11 @@ func IncreaseStateUpdateFailed() {
 	noOfRequests.WithLabelValues("Failed", "State Update").Inc()
 }
 
+// This increases when the request in GetStateUpdateWithBlock in feeder.go fails
+func IncreaseStateUpdateWithBlockFailed() {
+	noOfRequests.WithLabelValues("Failed", "State Update With Block").Inc()
+}
+
 // This increases when the request in GetFullContract in feeder.go fails
 func IncreaseFullContractsFailed() {
 	noOfRequests.WithLabelValues("Failed", "Full Contracts").Inc()
@@ -323,6 +366,69 @@ func IncreaseCountStarknetStateSuccess() {
 	countStarknetSync.WithLabelValues("Success").Inc()
 }
 
+// This increases when the layer 1 sync in state.go skips a block already
+// applied to the local state with the root of its fact
+func IncreaseCountStarknetStateAlreadyVerified() {
+	// notest
+	countStarknetSync.WithLabelValues("Already Verified").Inc()
+}
+
+// This increases when a log is received from the layer 1 subscription in state.go
+func IncreaseL1EventsReceived() {
+	// notest
+	countL1Events.WithLabelValues("Received").Inc()
+}
+
+// This increases when the layer 1 subscription buffer in state.go is found full
+func IncreaseL1EventsBufferFull() {
+	// notest
+	countL1Events.WithLabelValues("Buffer Full").Inc()
+}
+
+// This increases when the queue of layer 1 events in state.go is full and
+// the log fetcher has to wait for them to be processed
+func IncreaseL1EventsQueueFull() {
+	// notest
+	countL1Events.WithLabelValues("Queue Full").Inc()
+}
+
+// Sets the number of layer 1 events waiting in the queue in state.go
+func SetL1EventQueueLength(n int) {
+	// notest
+	l1EventQueueLength.Set(float64(n))
+}
+
+// Keeps a track of the number of requests in flight
+// Is called whenever a request is sent in feeder.go
+func IncreaseFeederRequestsInFlight() {
+	feederRequestsInFlight.Inc()
+}
+
+// Is called whenever the response of a request is read in feeder.go
+func DecreaseFeederRequestsInFlight() {
+	feederRequestsInFlight.Dec()
+}
+
+// Sets the number of contract storage roots cached by the Synchronizer
+func SetStorageRootCacheEntries(n int) {
+	storageRootCacheEntries.Set(float64(n))
+}
+
+// Counts a lookup in the block cache, found or not, and updates the hit
+// ratio
+func IncreaseBlockCacheLookups(hit bool) {
+	if hit {
+		blockCacheLookups.WithLabelValues("Hit").Inc()
+	} else {
+		blockCacheLookups.WithLabelValues("Miss").Inc()
+	}
+	hits, misses := &dto.Metric{}, &dto.Metric{}
+	blockCacheLookups.WithLabelValues("Hit").Write(hits)
+	blockCacheLookups.WithLabelValues("Miss").Write(misses)
+	total := hits.Counter.GetValue() + misses.Counter.GetValue()
+	blockCacheHitRatio.Set(hits.Counter.GetValue() / total)
+}
+
 // Changes the total and average amount of time needed for updating and committing a block
 func UpdateStarknetSyncTime(t float64) {
 	timeStarknetSync.WithLabelValues("Total").Add(t)
@@ -46,10 +46,13 @@ func (p *process) Start() (err error) {
 	return p.run()
 }
 
-// Close closes all running processes.
+// Close closes all running processes in the reverse order they were
+// added, so that a process is closed before the ones it depends on (e.g.
+// the Synchronizer before the storage services it writes to).
 func (h *Handler) Close() {
 	// Clear all processes.
-	for _, proc := range h.subprocs {
+	for i := len(h.subprocs) - 1; i >= 0; i-- {
+		proc := h.subprocs[i]
 		// Set 5 second timeout.
 		ctx, cancel := context.WithDeadline(
 			context.Background(), time.Now().Add(5*time.Second))
@@ -50,7 +50,7 @@ func (s *abiService) setDefaults() error {
 		if err != nil {
 			return err
 		}
-		database, err := db.NewMDBXDatabase(env, "ABI")
+		database, err := openDatabase(env, "ABI")
 		if err != nil {
 			return err
 		}
@@ -67,6 +67,7 @@ func (s *abiService) Close(ctx context.Context) {
 	}
 	s.service.Close(ctx)
 	s.manager.Close()
+	s.manager = nil
 }
 
 // StoreAbi stores an ABI in the database. If the key (contractAddress) already
@@ -1,14 +1,21 @@
 package services
 
 import (
+	"container/list"
 	"context"
+	"sync"
 
 	"github.com/NethermindEth/juno/internal/db"
 	"github.com/NethermindEth/juno/internal/db/block"
 	"github.com/NethermindEth/juno/internal/log"
+	metr "github.com/NethermindEth/juno/internal/metrics/prometheus"
 	"github.com/NethermindEth/juno/pkg/types"
 )
 
+// defaultBlockCacheSize is the number of blocks the BlockService keeps in
+// memory when no size is set.
+const defaultBlockCacheSize = 1024
+
 // BlockService is a service to manage the block database. Before
 // using the service, it must be configured with the Setup method;
 // otherwise, the value will be the default. To stop the service, call the
@@ -17,7 +24,9 @@ var BlockService blockService
 
 type blockService struct {
 	service
-	manager *block.Manager
+	manager   *block.Manager
+	cacheSize int
+	cache     *blockCache
 }
 
 // Setup is used to configure the service before it's started. The database
@@ -30,6 +39,17 @@ func (s *blockService) Setup(database db.Database) {
 	s.manager = block.NewManager(database)
 }
 
+// SetCacheSize sets the number of recently stored or read blocks kept in
+// memory. If it's not positive, defaultBlockCacheSize is used. It must be
+// called before the service is started.
+func (s *blockService) SetCacheSize(size int) {
+	if s.service.Running() {
+		// notest
+		s.logger.Panic("trying to SetCacheSize with service running")
+	}
+	s.cacheSize = size
+}
+
 // Run starts the service. If the Setup method is not called before, the default
 // values are used.
 func (s *blockService) Run() error {
@@ -42,6 +62,8 @@ func (s *blockService) Run() error {
 		return err
 	}
 
+	// The blocks cached by a previous run may be of another database.
+	s.cache = newBlockCache(s.cacheSize)
 	return s.setDefaults()
 }
 
@@ -52,7 +74,7 @@ func (s *blockService) setDefaults() error {
 		if err != nil {
 			return err
 		}
-		database, err := db.NewMDBXDatabase(env, "BLOCK")
+		database, err := openDatabase(env, "BLOCK")
 		if err != nil {
 			return err
 		}
@@ -62,7 +84,8 @@ func (s *blockService) setDefaults() error {
 }
 
 // Close stops the service, waiting to end the current operations, and closes
-// the database manager.
+// the database manager. The service is run again on the default database unless
+// Setup is called first.
 func (s *blockService) Close(ctx context.Context) {
 	// notest
 	if !s.Running() {
@@ -70,6 +93,7 @@ func (s *blockService) Close(ctx context.Context) {
 	}
 	s.service.Close(ctx)
 	s.manager.Close()
+	s.manager = nil
 }
 
 // GetBlockByHash searches for the block associated with the given block hash.
@@ -82,7 +106,15 @@ func (s *blockService) GetBlockByHash(blockHash types.BlockHash) *types.Block {
 		With("blockHash", blockHash).
 		Debug("GetBlockByHash")
 
-	return s.manager.GetBlockByHash(blockHash)
+	if b, ok := s.cache.getByHash(blockHash); ok {
+		return b
+	}
+	generation := s.cache.generation()
+	b := s.manager.GetBlockByHash(blockHash)
+	if b != nil {
+		s.cache.fill(b, generation)
+	}
+	return b
 }
 
 // GetBlockByNumber searches for the block associated with the given block
@@ -95,12 +127,39 @@ func (s *blockService) GetBlockByNumber(blockNumber uint64) *types.Block {
 		With("blockNumber", blockNumber).
 		Debug("GetBlockByNumber")
 
-	return s.manager.GetBlockByNumber(blockNumber)
+	if b, ok := s.cache.getByNumber(blockNumber); ok {
+		return b
+	}
+	generation := s.cache.generation()
+	b := s.manager.GetBlockByNumber(blockNumber)
+	if b != nil {
+		s.cache.fill(b, generation)
+	}
+	return b
+}
+
+// DeleteBlock removes the block with the given block number from the
+// database and returns it. If the block does not exist on the database, then
+// returns nil.
+func (s *blockService) DeleteBlock(blockNumber uint64) *types.Block {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("blockNumber", blockNumber).
+		Debug("DeleteBlock")
+
+	// The block is also dropped after it's deleted, in case a concurrent
+	// read cached it in between.
+	s.cache.remove(blockNumber)
+	defer s.cache.remove(blockNumber)
+	return s.manager.DeleteBlock(blockNumber)
 }
 
 // StoreBlock stores the given block into the database. The key used to map the
-// block it's the hash of the block. If the database already has a block with
-// the same key, then the value is overwritten.
+// block it's the hash of the block. If the same block is already stored under
+// its number, then nothing is written. If a different one is, then it is
+// replaced, which happens when the chain is reorganised.
 func (s *blockService) StoreBlock(blockHash types.BlockHash, block *types.Block) {
 	s.AddProcess()
 	defer s.DoneProcess()
@@ -109,5 +168,202 @@ func (s *blockService) StoreBlock(blockHash types.BlockHash, block *types.Block)
 		With("blockHash", blockHash.Hex()).
 		Debug("StoreBlock")
 
+	if stored := s.manager.GetBlockByNumber(block.BlockNumber); stored != nil {
+		if stored.BlockHash == blockHash && stored.Equal(block) {
+			return
+		}
+		s.logger.
+			With("blockNumber", block.BlockNumber, "storedHash", stored.BlockHash.Hex(), "blockHash", blockHash.Hex()).
+			Warn("Replacing a different block with the same number")
+	}
+	// The cached block is dropped first, so that a failed write doesn't
+	// leave a block in the cache that isn't in the database.
+	s.cache.remove(block.BlockNumber)
 	s.manager.PutBlock(blockHash, block)
+	if blockHash == block.BlockHash {
+		s.cache.put(block)
+	} else {
+		s.cache.remove(block.BlockNumber)
+	}
+}
+
+// StoreBlocks stores the given blocks into the database, keyed by their
+// hashes, in a single transaction. As with StoreBlock, the blocks already
+// stored under their number are skipped and different ones are replaced.
+// If an error is returned, none of the blocks is stored.
+func (s *blockService) StoreBlocks(blocks []*types.Block) error {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("blocks", len(blocks)).
+		Debug("StoreBlocks")
+
+	changed := make([]*types.Block, 0, len(blocks))
+	for _, block := range blocks {
+		if stored := s.manager.GetBlockByNumber(block.BlockNumber); stored != nil {
+			if stored.BlockHash == block.BlockHash && stored.Equal(block) {
+				continue
+			}
+			s.logger.
+				With("blockNumber", block.BlockNumber, "storedHash", stored.BlockHash.Hex(), "blockHash", block.BlockHash.Hex()).
+				Warn("Replacing a different block with the same number")
+		}
+		changed = append(changed, block)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	for _, block := range changed {
+		s.cache.remove(block.BlockNumber)
+	}
+	if err := s.manager.PutBlocks(changed); err != nil {
+		return err
+	}
+	for _, block := range changed {
+		s.cache.put(block)
+	}
+	return nil
+}
+
+// blockCache keeps the most recently stored or read blocks in memory,
+// indexed by number and by hash. At most size blocks are kept; the least
+// recently used ones are evicted. The cached blocks are copied in and out,
+// so that callers can't change them. A nil *blockCache is valid and caches
+// nothing.
+//
+// writes counts the changes made to the cache by writes to the database,
+// and is the generation of the cache. A block read from the database is
+// only cached if no write happened since the read started, so that a
+// concurrent write can't be undone by caching the block it replaced.
+type blockCache struct {
+	mu     sync.Mutex
+	size   int
+	writes uint64
+	// order holds the *types.Block cached, from most to least recently
+	// used, and byNumber and byHash map to their elements.
+	order    *list.List
+	byNumber map[uint64]*list.Element
+	byHash   map[types.BlockHash]*list.Element
+}
+
+// newBlockCache returns a new, empty blockCache that keeps at most size
+// blocks. If size is not positive, defaultBlockCacheSize is used.
+func newBlockCache(size int) *blockCache {
+	if size <= 0 {
+		size = defaultBlockCacheSize
+	}
+	return &blockCache{
+		size:     size,
+		order:    list.New(),
+		byNumber: make(map[uint64]*list.Element),
+		byHash:   make(map[types.BlockHash]*list.Element),
+	}
+}
+
+func (c *blockCache) getByNumber(blockNumber uint64) (*types.Block, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hit(c.byNumber[blockNumber])
+}
+
+func (c *blockCache) getByHash(blockHash types.BlockHash) (*types.Block, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hit(c.byHash[blockHash])
+}
+
+// hit records the lookup of e, which is nil if the block wasn't found,
+// and returns a copy of its block.
+func (c *blockCache) hit(e *list.Element) (*types.Block, bool) {
+	metr.IncreaseBlockCacheLookups(e != nil)
+	if e == nil {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return copyBlock(e.Value.(*types.Block)), true
+}
+
+// copyBlock returns a copy of b that shares no memory with it.
+func copyBlock(b *types.Block) *types.Block {
+	cp := *b
+	if b.TxHashes != nil {
+		cp.TxHashes = append(make([]types.TransactionHash, 0, len(b.TxHashes)), b.TxHashes...)
+	}
+	return &cp
+}
+
+// generation returns the current generation of the cache, to be passed to
+// fill with a block read from the database.
+func (c *blockCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writes
+}
+
+// fill caches a copy of the block read from the database, unless a write
+// changed the cache since generation was returned.
+func (c *blockCache) fill(b *types.Block, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writes == generation {
+		c.putLocked(b)
+	}
+}
+
+// put caches a copy of the block written, replacing the one with the same
+// number, and evicts the least recently used block if the cache is full.
+func (c *blockCache) put(b *types.Block) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	c.putLocked(b)
+}
+
+func (c *blockCache) putLocked(b *types.Block) {
+	c.removeLocked(b.BlockNumber)
+	cached := copyBlock(b)
+	e := c.order.PushFront(cached)
+	c.byNumber[cached.BlockNumber] = e
+	c.byHash[cached.BlockHash] = e
+	if c.order.Len() > c.size {
+		c.removeLocked(c.order.Back().Value.(*types.Block).BlockNumber)
+	}
+}
+
+// remove drops the block with the given number, if it's cached, for a
+// write.
+func (c *blockCache) remove(blockNumber uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	c.removeLocked(blockNumber)
+}
+
+func (c *blockCache) removeLocked(blockNumber uint64) {
+	e, ok := c.byNumber[blockNumber]
+	if !ok {
+		return
+	}
+	c.order.Remove(e)
+	delete(c.byNumber, blockNumber)
+	delete(c.byHash, e.Value.(*types.Block).BlockHash)
 }
@@ -2,7 +2,7 @@ package services
 
 import (
 	"context"
-	"reflect"
+	"fmt"
 	"testing"
 
 	"github.com/NethermindEth/juno/internal/db"
@@ -52,7 +52,7 @@ func TestService(t *testing.T) {
 		if returnedBlock == nil {
 			t.Errorf("unexpected nil after search for block with hash %s", key)
 		}
-		if !reflect.DeepEqual(b, returnedBlock) {
+		if !b.Equal(returnedBlock) {
 			t.Errorf("b")
 		}
 		// Get block by number
@@ -60,9 +60,179 @@ func TestService(t *testing.T) {
 		if returnedBlock == nil {
 			t.Errorf("unexpected nil after search for block with number %d", b.BlockNumber)
 		}
-		if !reflect.DeepEqual(b, returnedBlock) {
+		if !b.Equal(returnedBlock) {
 			t.Errorf("b")
 		}
+		// Storing the same block again changes nothing.
+		BlockService.StoreBlock(key, b)
+		if returnedBlock = BlockService.GetBlockByNumber(b.BlockNumber); !b.Equal(returnedBlock) {
+			t.Errorf("block %d changed after being stored again", b.BlockNumber)
+		}
+		// A different block with the same number replaces it.
+		reorged := *b
+		reorged.BlockHash = types.HexToBlockHash("1")
+		reorged.ParentHash = types.HexToBlockHash("2")
+		BlockService.StoreBlock(reorged.BlockHash, &reorged)
+		if returnedBlock = BlockService.GetBlockByNumber(b.BlockNumber); !reorged.Equal(returnedBlock) {
+			t.Errorf("block %d not replaced by a different one", b.BlockNumber)
+		}
 	}
 	BlockService.Close(context.Background())
 }
+
+func TestStoreBlocks(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "BLOCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	BlockService.Setup(database)
+	if err := BlockService.Run(); err != nil {
+		t.Fatalf("error starting the service: %s", err)
+	}
+	defer BlockService.Close(context.Background())
+
+	blocks := []*types.Block{
+		{BlockHash: types.HexToBlockHash("b0"), BlockNumber: 0, Status: types.BlockStatusAcceptedOnL2},
+		{BlockHash: types.HexToBlockHash("b1"), BlockNumber: 1, Status: types.BlockStatusAcceptedOnL2},
+	}
+	BlockService.StoreBlock(blocks[0].BlockHash, blocks[0])
+	// Block 1 is replaced by a block on another chain.
+	reorged := &types.Block{BlockHash: types.HexToBlockHash("c1"), BlockNumber: 1, Status: types.BlockStatusAcceptedOnL2}
+	BlockService.StoreBlock(reorged.BlockHash, reorged)
+
+	if err := BlockService.StoreBlocks(blocks); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if got := BlockService.GetBlockByNumber(block.BlockNumber); !block.Equal(got) {
+			t.Errorf("block %d = %v, want %v", block.BlockNumber, got, block)
+		}
+	}
+	if err := BlockService.StoreBlocks(nil); err != nil {
+		t.Errorf("StoreBlocks() without blocks = %v, want nil", err)
+	}
+}
+
+func TestBlockCache(t *testing.T) {
+	blocks := make([]*types.Block, 3)
+	for i := range blocks {
+		blocks[i] = &types.Block{
+			BlockHash:   types.HexToBlockHash(fmt.Sprintf("b%d", i)),
+			BlockNumber: uint64(i),
+			Status:      types.BlockStatusAcceptedOnL2,
+		}
+	}
+	cache := newBlockCache(2)
+	for _, b := range blocks {
+		cache.put(b)
+	}
+	// Block 0 is the least recently used, so it was evicted.
+	if _, ok := cache.getByNumber(0); ok {
+		t.Error("block 0 is still cached after being evicted")
+	}
+	for _, b := range blocks[1:] {
+		if got, ok := cache.getByNumber(b.BlockNumber); !ok || !b.Equal(got) {
+			t.Errorf("cached block %d = %v, %t, want %v", b.BlockNumber, got, ok, b)
+		}
+		if got, ok := cache.getByHash(b.BlockHash); !ok || !b.Equal(got) {
+			t.Errorf("cached block with hash %s = %v, %t, want %v", b.BlockHash.Hex(), got, ok, b)
+		}
+	}
+
+	// The cached blocks can't be changed by the callers, nor can their
+	// transaction hashes.
+	withTxs := &types.Block{BlockHash: types.HexToBlockHash("b2"), BlockNumber: 2, TxHashes: []types.TransactionHash{types.HexToTransactionHash("1")}}
+	cache.put(withTxs)
+	withTxs.TxHashes[0] = types.HexToTransactionHash("2")
+	got, _ := cache.getByNumber(2)
+	if got.TxHashes[0] != types.HexToTransactionHash("1") {
+		t.Error("changing a put block changed the cached transaction hashes")
+	}
+	got.BlockHash = types.HexToBlockHash("ff")
+	got.TxHashes[0] = types.HexToTransactionHash("3")
+	if got, _ := cache.getByNumber(2); got.BlockHash != withTxs.BlockHash || got.TxHashes[0] != types.HexToTransactionHash("1") {
+		t.Error("a block returned by the cache changed the cached one")
+	}
+
+	// A block read before a write isn't cached after it.
+	generation := cache.generation()
+	cache.remove(0)
+	cache.fill(blocks[0], generation)
+	if _, ok := cache.getByNumber(0); ok {
+		t.Error("a block read before a write was cached")
+	}
+	cache.fill(blocks[0], cache.generation())
+	if _, ok := cache.getByNumber(0); !ok {
+		t.Error("a block read without a concurrent write wasn't cached")
+	}
+
+	// A block with the same number replaces the cached one.
+	reorged := &types.Block{BlockHash: types.HexToBlockHash("c1"), BlockNumber: 1}
+	cache.put(reorged)
+	if _, ok := cache.getByHash(blocks[1].BlockHash); ok {
+		t.Error("the replaced block is still cached by hash")
+	}
+	if got, ok := cache.getByNumber(1); !ok || got.BlockHash != reorged.BlockHash {
+		t.Errorf("cached block 1 = %v, %t, want the replacing one", got, ok)
+	}
+	cache.remove(1)
+	if _, ok := cache.getByHash(reorged.BlockHash); ok {
+		t.Error("block 1 is still cached after being removed")
+	}
+
+	var disabled *blockCache
+	disabled.put(blocks[0])
+	if _, ok := disabled.getByNumber(0); ok {
+		t.Error("a nil cache returned a block")
+	}
+}
+
+func TestServiceBlockCache(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "BLOCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	BlockService.Setup(database)
+	BlockService.SetCacheSize(1)
+	if err := BlockService.Run(); err != nil {
+		t.Fatalf("error starting the service: %s", err)
+	}
+	defer func() {
+		BlockService.Close(context.Background())
+		BlockService.SetCacheSize(0)
+	}()
+
+	stored := &types.Block{BlockHash: types.HexToBlockHash("b0"), BlockNumber: 0, Status: types.BlockStatusAcceptedOnL2}
+	BlockService.StoreBlock(stored.BlockHash, stored)
+	if _, ok := BlockService.cache.getByNumber(0); !ok {
+		t.Error("a stored block isn't cached")
+	}
+
+	// A block read from the database is cached.
+	BlockService.cache.remove(0)
+	if got := BlockService.GetBlockByHash(stored.BlockHash); !stored.Equal(got) {
+		t.Errorf("block with hash %s = %v, want %v", stored.BlockHash.Hex(), got, stored)
+	}
+	if _, ok := BlockService.cache.getByHash(stored.BlockHash); !ok {
+		t.Error("a block read from the database isn't cached")
+	}
+
+	// Replacing the block replaces the cached one and deleting it drops it.
+	reorged := &types.Block{BlockHash: types.HexToBlockHash("c0"), BlockNumber: 0, Status: types.BlockStatusAcceptedOnL2}
+	BlockService.StoreBlock(reorged.BlockHash, reorged)
+	if got := BlockService.GetBlockByNumber(0); !reorged.Equal(got) {
+		t.Errorf("block 0 after it was replaced = %v, want %v", got, reorged)
+	}
+	BlockService.DeleteBlock(0)
+	if got := BlockService.GetBlockByNumber(0); got != nil {
+		t.Errorf("block 0 after it was deleted = %v, want nil", got)
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"math/big"
 
 	"github.com/NethermindEth/juno/internal/db"
@@ -10,6 +12,11 @@ import (
 
 var ContractHashService contractHashService
 
+// ErrUnknownContractHash is returned by GetContractHashAt when the class
+// hash of the contract at the block isn't known, for example because the
+// contract wasn't deployed yet.
+var ErrUnknownContractHash = errors.New("unknown contract hash")
+
 type contractHashService struct {
 	service
 	db db.Database
@@ -42,7 +49,7 @@ func (s *contractHashService) setDefaults() error {
 		if err != nil {
 			return err
 		}
-		database, err := db.NewMDBXDatabase(env, "CONTRACT_HASH")
+		database, err := openDatabase(env, "CONTRACT_HASH")
 		if err != nil {
 			return err
 		}
@@ -58,9 +65,13 @@ func (s *contractHashService) Close(ctx context.Context) {
 	}
 	s.service.Close(ctx)
 	s.db.Close()
+	s.db = nil
 }
 
-func (s *contractHashService) StoreContractHash(contractAddress string, contractHash *big.Int) {
+// StoreContractHash stores the class hash of the contract and returns the
+// one it replaces, or nil if the contract had none. Storing the same hash
+// again doesn't write anything.
+func (s *contractHashService) StoreContractHash(contractAddress string, contractHash *big.Int) (previous *big.Int) {
 	s.AddProcess()
 	defer s.DoneProcess()
 
@@ -68,13 +79,275 @@ func (s *contractHashService) StoreContractHash(contractAddress string, contract
 		With("contractAddress", contractAddress).
 		Debug("StoreContractHash")
 
-	err := s.db.Put([]byte(contractAddress), contractHash.Bytes())
+	rawData, err := s.db.Get([]byte(contractAddress))
+	switch {
+	case err == nil:
+		previous = new(big.Int).SetBytes(rawData)
+		if previous.Cmp(contractHash) == 0 {
+			return previous
+		}
+	case !db.IsNotFound(err):
+		// notest
+		s.logger.
+			With("error", err).
+			Error("StoreContractHash error")
+	}
+	err = s.db.Put([]byte(contractAddress), contractHash.Bytes())
 	if err != nil {
 		// notest
 		s.logger.
 			With("error", err).
 			Error("StoreContractHash error")
 	}
+	return previous
+}
+
+// ClassChange is a change of the class hash of a contract.
+type ClassChange struct {
+	BlockNumber  uint64   `json:"block_number"`
+	OldClassHash *big.Int `json:"old_class_hash"`
+	NewClassHash *big.Int `json:"new_class_hash"`
+}
+
+// classChangesKey returns the key of the class changes of the contract.
+// The addresses are hexadecimal, so it can't be the key of a contract
+// hash.
+func classChangesKey(contractAddress string) []byte {
+	return []byte("class_changes_" + contractAddress)
+}
+
+// StoreClassChange appends the change to the class changes of the
+// contract.
+func (s *contractHashService) StoreClassChange(contractAddress string, change ClassChange) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress, "blockNumber", change.BlockNumber).
+		Debug("StoreClassChange")
+
+	changes := append(s.classChanges(contractAddress), change)
+	rawData, err := json.Marshal(changes)
+	if err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Panic("marshalling error")
+	}
+	if err := s.db.Put(classChangesKey(contractAddress), rawData); err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Error("StoreClassChange error")
+	}
+}
+
+// DeleteClassChangesAfter removes the class changes of the contract made
+// after the given block.
+func (s *contractHashService) DeleteClassChangesAfter(contractAddress string, blockNumber uint64) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress, "blockNumber", blockNumber).
+		Debug("DeleteClassChangesAfter")
+
+	changes := s.classChanges(contractAddress)
+	kept := make([]ClassChange, 0, len(changes))
+	for _, change := range changes {
+		if change.BlockNumber <= blockNumber {
+			kept = append(kept, change)
+		}
+	}
+	if len(kept) == len(changes) {
+		return
+	}
+	var err error
+	if len(kept) == 0 {
+		err = s.db.Delete(classChangesKey(contractAddress))
+	} else {
+		var rawData []byte
+		rawData, err = json.Marshal(kept)
+		if err != nil {
+			// notest
+			s.logger.
+				With("error", err).
+				Panic("marshalling error")
+		}
+		err = s.db.Put(classChangesKey(contractAddress), rawData)
+	}
+	if err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Error("DeleteClassChangesAfter error")
+	}
+}
+
+// GetClassChanges returns the class changes of the contract in the order
+// they were stored, or nil if its class never changed.
+func (s *contractHashService) GetClassChanges(contractAddress string) []ClassChange {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress).
+		Debug("GetClassChanges")
+
+	return s.classChanges(contractAddress)
+}
+
+func (s *contractHashService) classChanges(contractAddress string) []ClassChange {
+	rawData, err := s.db.Get(classChangesKey(contractAddress))
+	if err != nil {
+		if !db.IsNotFound(err) {
+			// notest
+			s.logger.
+				With("error", err).
+				Error("GetClassChanges error")
+		}
+		return nil
+	}
+	var changes []ClassChange
+	if err := json.Unmarshal(rawData, &changes); err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Panic("unmarshalling error")
+	}
+	return changes
+}
+
+// contractHashHistoryKey returns the key of the history of the class hash
+// of the contract. The addresses are hexadecimal, so it can't be the key
+// of a contract hash.
+func contractHashHistoryKey(contractAddress string) []byte {
+	return []byte("class_hash_history_" + contractAddress)
+}
+
+// StoreContractHashAt records that the class hash of the contract is
+// contractHash as of the given block, until another hash is stored at a
+// later block.
+func (s *contractHashService) StoreContractHashAt(contractAddress string, blockNumber uint64, contractHash *big.Int) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress, "blockNumber", blockNumber).
+		Debug("StoreContractHashAt")
+
+	history := db.NewBlockSpecificDatabase(s.db)
+	if err := history.Put(contractHashHistoryKey(contractAddress), blockNumber, contractHash.Bytes()); err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Error("StoreContractHashAt error")
+	}
+}
+
+// DeleteContractHashesAfter removes the class hashes of the contract
+// stored by StoreContractHashAt at blocks after the given block.
+func (s *contractHashService) DeleteContractHashesAfter(contractAddress string, blockNumber uint64) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress, "blockNumber", blockNumber).
+		Debug("DeleteContractHashesAfter")
+
+	history := db.NewBlockSpecificDatabase(s.db)
+	if err := history.DeleteAfter(contractHashHistoryKey(contractAddress), blockNumber); err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Error("DeleteContractHashesAfter error")
+	}
+}
+
+// DeleteContractHash removes the class hash of the contract, along with
+// its history and class changes, as if it was never deployed.
+func (s *contractHashService) DeleteContractHash(contractAddress string) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress).
+		Debug("DeleteContractHash")
+
+	history := db.NewBlockSpecificDatabase(s.db)
+	if err := history.Delete(contractHashHistoryKey(contractAddress)); err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Error("DeleteContractHash error")
+		return
+	}
+	for _, key := range [][]byte{classChangesKey(contractAddress), []byte(contractAddress)} {
+		ok, err := s.db.Has(key)
+		if err == nil && ok {
+			err = s.db.Delete(key)
+		}
+		if err != nil {
+			// notest
+			s.logger.
+				With("error", err).
+				Error("DeleteContractHash error")
+			return
+		}
+	}
+}
+
+// GetContractHashAt returns the class hash of the contract as of the
+// given block. The history is only stored for the contracts deployed or
+// changed since it was added; for the others, the hash is derived from
+// the class changes and the current hash, assuming the contract was
+// deployed. If the hash isn't known, ErrUnknownContractHash is returned.
+func (s *contractHashService) GetContractHashAt(contractAddress string, blockNumber uint64) (*big.Int, error) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress, "blockNumber", blockNumber).
+		Debug("GetContractHashAt")
+
+	history := db.NewBlockSpecificDatabase(s.db)
+	key := contractHashHistoryKey(contractAddress)
+	rawData, err := history.Get(key, blockNumber)
+	if err != nil {
+		// notest
+		return nil, err
+	}
+	if rawData != nil {
+		return new(big.Int).SetBytes(rawData), nil
+	}
+	has, err := s.db.Has(key)
+	if err != nil {
+		// notest
+		return nil, err
+	}
+	if has {
+		// The contract was deployed after the block.
+		return nil, ErrUnknownContractHash
+	}
+
+	changes := s.classChanges(contractAddress)
+	for i := len(changes) - 1; i >= 0; i-- {
+		if changes[i].BlockNumber <= blockNumber {
+			return changes[i].NewClassHash, nil
+		}
+	}
+	if len(changes) > 0 {
+		return changes[0].OldClassHash, nil
+	}
+	rawData, err = s.db.Get([]byte(contractAddress))
+	if err != nil {
+		if db.IsNotFound(err) {
+			return nil, ErrUnknownContractHash
+		}
+		// notest
+		return nil, err
+	}
+	return new(big.Int).SetBytes(rawData), nil
 }
 
 func (s *contractHashService) GetContractHash(contractAddress string) *big.Int {
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/NethermindEth/juno/internal/db"
+)
+
+func setupContractHashService(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "CONTRACT_HASH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ContractHashService.Setup(database)
+	if err := ContractHashService.Run(); err != nil {
+		t.Fatalf("unexpeted error in Run: %s", err)
+	}
+}
+
+func TestContractHashService_StoreContractHash(t *testing.T) {
+	setupContractHashService(t)
+	defer ContractHashService.Close(context.Background())
+
+	address := "1bd7ca87f139693e6681be2042194cf631c4e8d77027bf0ea9e6d55fc6018ac"
+	first, second := big.NewInt(1), big.NewInt(2)
+
+	if previous := ContractHashService.StoreContractHash(address, first); previous != nil {
+		t.Errorf("previous hash of a new contract is %s, want nil", previous)
+	}
+	if previous := ContractHashService.StoreContractHash(address, first); previous == nil || previous.Cmp(first) != 0 {
+		t.Errorf("previous hash after storing the same hash is %v, want %s", previous, first)
+	}
+	if previous := ContractHashService.StoreContractHash(address, second); previous == nil || previous.Cmp(first) != 0 {
+		t.Errorf("previous hash after a class change is %v, want %s", previous, first)
+	}
+	if hash := ContractHashService.GetContractHash(address); hash.Cmp(second) != 0 {
+		t.Errorf("contract hash is %s, want %s", hash, second)
+	}
+}
+
+func TestContractHashService_ClassChanges(t *testing.T) {
+	setupContractHashService(t)
+	defer ContractHashService.Close(context.Background())
+
+	address := "1bd7ca87f139693e6681be2042194cf631c4e8d77027bf0ea9e6d55fc6018ac"
+	if changes := ContractHashService.GetClassChanges(address); changes != nil {
+		t.Errorf("class changes of a new contract are %v, want nil", changes)
+	}
+	want := []ClassChange{
+		{BlockNumber: 10, OldClassHash: big.NewInt(1), NewClassHash: big.NewInt(2)},
+		{BlockNumber: 20, OldClassHash: big.NewInt(2), NewClassHash: big.NewInt(3)},
+	}
+	for _, change := range want {
+		ContractHashService.StoreClassChange(address, change)
+	}
+	if changes := ContractHashService.GetClassChanges(address); !reflect.DeepEqual(changes, want) {
+		t.Errorf("class changes are %v, want %v", changes, want)
+	}
+
+	ContractHashService.DeleteClassChangesAfter(address, 15)
+	if changes := ContractHashService.GetClassChanges(address); !reflect.DeepEqual(changes, want[:1]) {
+		t.Errorf("class changes after deleting the ones after block 15 are %v, want %v", changes, want[:1])
+	}
+	ContractHashService.DeleteClassChangesAfter(address, 5)
+	if changes := ContractHashService.GetClassChanges(address); changes != nil {
+		t.Errorf("class changes after deleting the ones after block 5 are %v, want nil", changes)
+	}
+}
+
+func TestContractHashService_GetContractHashAt(t *testing.T) {
+	setupContractHashService(t)
+	defer ContractHashService.Close(context.Background())
+
+	address := "1bd7ca87f139693e6681be2042194cf631c4e8d77027bf0ea9e6d55fc6018ac"
+	if _, err := ContractHashService.GetContractHashAt(address, 10); !errors.Is(err, ErrUnknownContractHash) {
+		t.Errorf("GetContractHashAt of an unknown contract = %v, want %v", err, ErrUnknownContractHash)
+	}
+
+	// Deployed at block 10 and upgraded at block 20.
+	ContractHashService.StoreContractHashAt(address, 10, big.NewInt(1))
+	ContractHashService.StoreContractHashAt(address, 20, big.NewInt(2))
+	if _, err := ContractHashService.GetContractHashAt(address, 9); !errors.Is(err, ErrUnknownContractHash) {
+		t.Errorf("GetContractHashAt before the deployment = %v, want %v", err, ErrUnknownContractHash)
+	}
+	for block, want := range map[uint64]int64{10: 1, 19: 1, 20: 2, 100: 2} {
+		hash, err := ContractHashService.GetContractHashAt(address, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("GetContractHashAt(%d) = %s, want %d", block, hash, want)
+		}
+	}
+}
+
+func TestContractHashService_GetContractHashAtWithoutHistory(t *testing.T) {
+	setupContractHashService(t)
+	defer ContractHashService.Close(context.Background())
+
+	// Contracts stored before the history was.
+	unchanged := "1"
+	ContractHashService.StoreContractHash(unchanged, big.NewInt(5))
+	changed := "2"
+	ContractHashService.StoreContractHash(changed, big.NewInt(3))
+	ContractHashService.StoreClassChange(changed, ClassChange{BlockNumber: 10, OldClassHash: big.NewInt(1), NewClassHash: big.NewInt(2)})
+	ContractHashService.StoreClassChange(changed, ClassChange{BlockNumber: 20, OldClassHash: big.NewInt(2), NewClassHash: big.NewInt(3)})
+
+	tests := [...]struct {
+		address string
+		block   uint64
+		want    int64
+	}{
+		{unchanged, 0, 5},
+		{changed, 5, 1},
+		{changed, 10, 2},
+		{changed, 19, 2},
+		{changed, 20, 3},
+	}
+	for _, test := range tests {
+		hash, err := ContractHashService.GetContractHashAt(test.address, test.block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash.Cmp(big.NewInt(test.want)) != 0 {
+			t.Errorf("GetContractHashAt(%s, %d) = %s, want %d", test.address, test.block, hash, test.want)
+		}
+	}
+}
+
+func TestContractHashService_DeleteContractHashesAfter(t *testing.T) {
+	setupContractHashService(t)
+	defer ContractHashService.Close(context.Background())
+
+	// Deployed at block 10 and upgraded at blocks 20 and 30.
+	address := "1"
+	ContractHashService.StoreContractHash(address, big.NewInt(3))
+	ContractHashService.StoreContractHashAt(address, 10, big.NewInt(1))
+	ContractHashService.StoreContractHashAt(address, 20, big.NewInt(2))
+	ContractHashService.StoreContractHashAt(address, 30, big.NewInt(3))
+
+	ContractHashService.DeleteContractHashesAfter(address, 20)
+	for block, want := range map[uint64]int64{10: 1, 20: 2, 100: 2} {
+		hash, err := ContractHashService.GetContractHashAt(address, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("GetContractHashAt(%d) = %s, want %d", block, hash, want)
+		}
+	}
+
+	ContractHashService.DeleteContractHash(address)
+	if _, err := ContractHashService.GetContractHashAt(address, 100); !errors.Is(err, ErrUnknownContractHash) {
+		t.Errorf("GetContractHashAt of a deleted contract = %v, want %v", err, ErrUnknownContractHash)
+	}
+	if hash := ContractHashService.GetContractHash(address); hash != nil {
+		t.Errorf("GetContractHash of a deleted contract = %s, want none", hash)
+	}
+	// Deleting it again does nothing.
+	ContractHashService.DeleteContractHash(address)
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/NethermindEth/juno/internal/log"
+)
+
+// Manager runs and closes a group of services together. The services are
+// run in the order they were registered and closed in the reverse order.
+// It doesn't set them up: a service is given its databases with its own
+// Setup before the Manager runs it, or opens its default ones when run.
+type Manager struct {
+	mu       sync.Mutex
+	services []managedService
+	// started is the number of services run and not closed yet.
+	started int
+}
+
+// managedService is a service registered in a Manager.
+type managedService struct {
+	name    string
+	service Service
+}
+
+// NewManager returns a Manager without services.
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// NewStorageManager returns a Manager of the package-level storage
+// services. The Synchronizer and the APIs keep using those services
+// directly; the Manager only runs and closes them.
+func NewStorageManager() *Manager {
+	m := NewManager()
+	m.Register("ABI Service", &AbiService)
+	m.Register("State Storage Service", &StateService)
+	m.Register("Transactions Storage Service", &TransactionService)
+	m.Register("Block Storage Service", &BlockService)
+	m.Register("Contract Hash Storage Service", &ContractHashService)
+	m.Register("Message Service", &MessageService)
+	return m
+}
+
+// Register adds the service to the Manager under the given name. It must
+// be called before Run.
+func (m *Manager) Register(name string, service Service) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.services = append(m.services, managedService{name: name, service: service})
+}
+
+// Run runs the services in the order they were registered. If a service
+// fails to run, the services already running are closed and the error is
+// returned.
+func (m *Manager) Run() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started > 0 {
+		return ErrAlreadyRunning
+	}
+	for _, s := range m.services {
+		if err := s.service.Run(); err != nil {
+			log.Default.With("Error", err, "Service", s.name).Error("Unable to start service")
+			m.close(context.Background())
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+		m.started++
+	}
+	return nil
+}
+
+// Close closes the running services in the reverse order they were run.
+func (m *Manager) Close(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.close(ctx)
+}
+
+func (m *Manager) close(ctx context.Context) {
+	for ; m.started > 0; m.started-- {
+		m.services[m.started-1].service.Close(ctx)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingService records the calls to its methods in calls.
+type recordingService struct {
+	name  string
+	err   error
+	calls *[]string
+}
+
+func (s *recordingService) Run() error {
+	*s.calls = append(*s.calls, "run "+s.name)
+	return s.err
+}
+
+func (s *recordingService) Close(context.Context) {
+	*s.calls = append(*s.calls, "close "+s.name)
+}
+
+func TestManager(t *testing.T) {
+	var calls []string
+	m := NewManager()
+	for _, name := range []string{"a", "b", "c"} {
+		m.Register(name, &recordingService{name: name, calls: &calls})
+	}
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Run(); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second Run() = %v, want %v", err, ErrAlreadyRunning)
+	}
+	m.Close(context.Background())
+	m.Close(context.Background())
+	want := []string{"run a", "run b", "run c", "close c", "close b", "close a"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestManager_RunError(t *testing.T) {
+	var calls []string
+	failure := errors.New("failure")
+	m := NewManager()
+	m.Register("a", &recordingService{name: "a", calls: &calls})
+	m.Register("b", &recordingService{name: "b", err: failure, calls: &calls})
+	m.Register("c", &recordingService{name: "c", calls: &calls})
+	if err := m.Run(); !errors.Is(err, failure) {
+		t.Errorf("Run() = %v, want %v", err, failure)
+	}
+	m.Close(context.Background())
+	want := []string{"run a", "run b", "close a"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/NethermindEth/juno/internal/log"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MessageStatus is the status of a message sent from layer 1 to layer 2.
+// The statuses are ordered: a message only moves to a later status.
+type MessageStatus uint8
+
+const (
+	// MessageStatusUnknown is the status of a message that has not been
+	// seen.
+	MessageStatusUnknown MessageStatus = iota
+	// MessageStatusSent is the status of a message sent to layer 2 that
+	// has not been consumed yet.
+	MessageStatusSent
+	// MessageStatusCancellationStarted is the status of a message whose
+	// cancellation was requested on layer 1.
+	MessageStatusCancellationStarted
+	// MessageStatusConsumed is the status of a message consumed on layer 2.
+	MessageStatusConsumed
+	// MessageStatusCancelled is the status of a message cancelled on
+	// layer 1 before it was consumed.
+	MessageStatusCancelled
+)
+
+// String returns the name of the status.
+func (s MessageStatus) String() string {
+	switch s {
+	case MessageStatusSent:
+		return "SENT"
+	case MessageStatusCancellationStarted:
+		return "CANCELLATION_STARTED"
+	case MessageStatusConsumed:
+		return "CONSUMED"
+	case MessageStatusCancelled:
+		return "CANCELLED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// MessageService is a service to track the status of the messages sent
+// from layer 1 to layer 2, indexed by message hash. Before using the
+// service, it must be configured with the Setup method; otherwise, the
+// value will be the default. To stop the service, call the Close method.
+var MessageService messageService
+
+type messageService struct {
+	service
+	db db.Database
+}
+
+// Setup is used to configure the service before it's started. The database
+// param is the database where the message statuses will be stored.
+func (s *messageService) Setup(database db.Database) {
+	if s.Running() {
+		// notest
+		s.logger.Panic("trying to Setup with service running")
+	}
+	s.db = database
+}
+
+// Run starts the service. If the Setup method is not called before, the default
+// values are used.
+func (s *messageService) Run() error {
+	if s.logger == nil {
+		s.logger = log.Default.Named("Message Service")
+	}
+
+	if err := s.service.Run(); err != nil {
+		// notest
+		return err
+	}
+
+	return s.setDefaults()
+}
+
+func (s *messageService) setDefaults() error {
+	if s.db == nil {
+		// notest
+		env, err := db.GetMDBXEnv()
+		if err != nil {
+			return err
+		}
+		database, err := openDatabase(env, "L1_TO_L2_MESSAGES")
+		if err != nil {
+			return err
+		}
+		s.db = database
+	}
+	return nil
+}
+
+// Close stops the service, waiting to end the current operations, and closes
+// the database. The service is run again on the default database unless
+// Setup is called first.
+func (s *messageService) Close(ctx context.Context) {
+	// notest
+	if !s.Running() {
+		return
+	}
+	s.service.Close(ctx)
+	s.db.Close()
+	s.db = nil
+}
+
+// StoreMessageStatus sets the status of the message with the given hash.
+// The status is only changed if it's later than the stored one, so logs
+// received again or out of order do not move a message back.
+func (s *messageService) StoreMessageStatus(messageHash common.Hash, status MessageStatus) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("messageHash", messageHash.Hex(), "status", status).
+		Debug("StoreMessageStatus")
+
+	if current := s.getMessageStatus(messageHash); current >= status {
+		return
+	}
+	err := s.db.Put(messageHash.Bytes(), []byte{byte(status)})
+	if err != nil {
+		// notest
+		s.logger.
+			With("error", err).
+			Error("StoreMessageStatus error")
+	}
+}
+
+// GetMessageStatus returns the status of the message with the given hash.
+// If the message has not been seen, it returns MessageStatusUnknown.
+func (s *messageService) GetMessageStatus(messageHash common.Hash) MessageStatus {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("messageHash", messageHash.Hex()).
+		Debug("GetMessageStatus")
+
+	return s.getMessageStatus(messageHash)
+}
+
+func (s *messageService) getMessageStatus(messageHash common.Hash) MessageStatus {
+	rawData, err := s.db.Get(messageHash.Bytes())
+	if err != nil {
+		if !db.IsNotFound(err) {
+			// notest
+			s.logger.
+				With("error", err).
+				Error("GetMessageStatus error")
+		}
+		return MessageStatusUnknown
+	}
+	if len(rawData) != 1 {
+		// notest
+		return MessageStatusUnknown
+	}
+	return MessageStatus(rawData[0])
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestMessageService(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "L1_TO_L2_MESSAGES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	MessageService.Setup(database)
+	if err := MessageService.Run(); err != nil {
+		t.Fatalf("error starting the service: %s", err)
+	}
+	defer MessageService.Close(context.Background())
+
+	hash := common.HexToHash("0x1")
+	if status := MessageService.GetMessageStatus(hash); status != MessageStatusUnknown {
+		t.Errorf("status of an unknown message = %s, want %s", status, MessageStatusUnknown)
+	}
+
+	steps := []struct {
+		store MessageStatus
+		want  MessageStatus
+	}{
+		{MessageStatusSent, MessageStatusSent},
+		{MessageStatusConsumed, MessageStatusConsumed},
+		// A message does not move back to an earlier status.
+		{MessageStatusSent, MessageStatusConsumed},
+	}
+	for _, step := range steps {
+		MessageService.StoreMessageStatus(hash, step.store)
+		if status := MessageService.GetMessageStatus(hash); status != step.want {
+			t.Errorf("status after storing %s = %s, want %s", step.store, status, step.want)
+		}
+	}
+	if status := MessageService.GetMessageStatus(common.HexToHash("0x2")); status != MessageStatusUnknown {
+		t.Errorf("status of another message = %s, want %s", status, MessageStatusUnknown)
+	}
+}
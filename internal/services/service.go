@@ -5,6 +5,8 @@ import (
 	"errors"
 	"sync"
 
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/torquem-ch/mdbx-go/mdbx"
 	"go.uber.org/zap"
 )
 
@@ -12,6 +14,27 @@ import (
 // while the service is running.
 var ErrAlreadyRunning = errors.New("service is already running")
 
+// namespace prefixes the keys of the default databases of the services.
+var namespace string
+
+// SetNamespace sets the namespace the keys of the default databases of
+// the services are prefixed with, so that the data of several chains can
+// be kept in the same environment. It must be called before the
+// services are run and match the namespace the data was stored with.
+func SetNamespace(ns string) {
+	namespace = ns
+}
+
+// openDatabase opens the default database of a service with the given
+// name, in the namespace set with SetNamespace.
+func openDatabase(env *mdbx.Env, name string) (db.DatabaseIterable, error) {
+	database, err := db.NewMDBXDatabase(env, name)
+	if err != nil || namespace == "" {
+		return database, err
+	}
+	return db.NewNamespacedDatabase(database, namespace), nil
+}
+
 // Service describes the basic functionalities that all the services have in
 // common.
 type Service interface {
@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/NethermindEth/juno/internal/db"
 	"github.com/NethermindEth/juno/internal/db/state"
@@ -11,9 +13,14 @@ import (
 
 var StateService stateService
 
+// ErrInvalidBlockRange is returned when the first block of a range is
+// after the last one.
+var ErrInvalidBlockRange = errors.New("invalid block range")
+
 type stateService struct {
 	service
-	manager *state.Manager
+	manager          *state.Manager
+	deployedDatabase db.DatabaseIterable
 }
 
 func (s *stateService) Setup(codeDatabase db.Database, storageDatabase *db.BlockSpecificDatabase) {
@@ -24,6 +31,17 @@ func (s *stateService) Setup(codeDatabase db.Database, storageDatabase *db.Block
 	s.manager = state.NewStateManager(codeDatabase, storageDatabase)
 }
 
+// SetDeployedDatabase sets the database where the deployed contracts are
+// indexed. It must be called before Run; if it isn't, the default database
+// is used only when Setup wasn't called either.
+func (s *stateService) SetDeployedDatabase(deployedDatabase db.DatabaseIterable) {
+	if s.Running() {
+		// notest
+		s.logger.Panic("service is already running")
+	}
+	s.deployedDatabase = deployedDatabase
+}
+
 func (s *stateService) Run() error {
 	if s.logger == nil {
 		s.logger = log.Default.Named("StateService")
@@ -44,16 +62,25 @@ func (s *stateService) setDefaults() error {
 		if err != nil {
 			return err
 		}
-		codeDb, err := db.NewMDBXDatabase(env, "CODE")
+		codeDb, err := openDatabase(env, "CODE")
 		if err != nil {
 			return err
 		}
-		storageDb, err := db.NewMDBXDatabase(env, "STORAGE")
+		storageDb, err := openDatabase(env, "STORAGE")
 		if err != nil {
 			return err
 		}
 		storageDatabase := db.NewBlockSpecificDatabase(storageDb)
 		s.manager = state.NewStateManager(codeDb, storageDatabase)
+		if s.deployedDatabase == nil {
+			s.deployedDatabase, err = openDatabase(env, "DEPLOYED_CONTRACTS")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if s.deployedDatabase != nil {
+		s.manager.SetDeployedDatabase(s.deployedDatabase)
 	}
 	return nil
 }
@@ -65,6 +92,8 @@ func (s *stateService) Close(ctx context.Context) {
 	}
 	s.service.Close(ctx)
 	s.manager.Close()
+	s.manager = nil
+	s.deployedDatabase = nil
 }
 
 func (s *stateService) StoreCode(contractAddress []byte, code *state.Code) {
@@ -128,3 +157,47 @@ func (s *stateService) UpdateStorage(contractAddress string, blockNumber uint64,
 		s.StoreStorage(contractAddress, blockNumber, oldStorage)
 	}
 }
+
+// StoreDeployedContract records that the contract with the given address
+// was deployed at the given block number. Only the first deployment of
+// each contract is kept.
+func (s *stateService) StoreDeployedContract(contractAddress string, blockNumber uint64) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("contractAddress", contractAddress, "blockNumber", blockNumber).
+		Debug("StoreDeployedContract")
+
+	s.manager.PutDeployedContract(contractAddress, blockNumber)
+}
+
+// DeployedContracts returns the addresses of the contracts first deployed
+// between fromBlock and toBlock, both included, in the order they were
+// deployed.
+func (s *stateService) DeployedContracts(fromBlock, toBlock uint64) ([]string, error) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("fromBlock", fromBlock, "toBlock", toBlock).
+		Debug("DeployedContracts")
+
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("%w: from block %d is after to block %d", ErrInvalidBlockRange, fromBlock, toBlock)
+	}
+	return s.manager.GetDeployedContracts(fromBlock, toBlock), nil
+}
+
+// DeleteDeployedContractsAfter removes the contracts first deployed after
+// the given block number.
+func (s *stateService) DeleteDeployedContractsAfter(blockNumber uint64) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.
+		With("blockNumber", blockNumber).
+		Debug("DeleteDeployedContractsAfter")
+
+	s.manager.DeleteDeployedContractsAfter(blockNumber)
+}
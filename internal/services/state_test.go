@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"testing"
 
 	"github.com/NethermindEth/juno/internal/db"
@@ -158,3 +159,41 @@ func equalCodes(t *testing.T, a, b *state.Code) bool {
 	}
 	return bytes.Compare(aRaw, bRaw) == 0
 }
+
+func TestStateService_DeployedContracts(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployedDb, err := db.NewMDBXDatabase(env, "DEPLOYED_CONTRACTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	StateService.SetDeployedDatabase(deployedDb)
+	stateServiceInitServices(t)
+	defer StateService.Close(context.Background())
+
+	StateService.StoreDeployedContract("0x1", 1)
+	StateService.StoreDeployedContract("0x2", 4)
+	StateService.StoreDeployedContract("0x1", 4)
+
+	addresses, err := StateService.DeployedContracts(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 2 || addresses[0] != "0x1" || addresses[1] != "0x2" {
+		t.Errorf("DeployedContracts(0, 10) = %v, want [0x1 0x2]", addresses)
+	}
+	if _, err := StateService.DeployedContracts(4, 1); !errors.Is(err, ErrInvalidBlockRange) {
+		t.Errorf("DeployedContracts(4, 1) error = %v, want %v", err, ErrInvalidBlockRange)
+	}
+
+	StateService.DeleteDeployedContractsAfter(3)
+	addresses, err = StateService.DeployedContracts(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 1 || addresses[0] != "0x1" {
+		t.Errorf("DeployedContracts(0, 10) after DeleteDeployedContractsAfter(3) = %v, want [0x1]", addresses)
+	}
+}
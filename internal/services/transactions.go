@@ -53,11 +53,11 @@ func (s *transactionService) setDefaults() error {
 		if err != nil {
 			return err
 		}
-		txDb, err := db.NewMDBXDatabase(env, "TRANSACTION")
+		txDb, err := openDatabase(env, "TRANSACTION")
 		if err != nil {
 			return err
 		}
-		receiptDb, err := db.NewMDBXDatabase(env, "RECEIPT")
+		receiptDb, err := openDatabase(env, "RECEIPT")
 		if err != nil {
 			return err
 		}
@@ -75,6 +75,7 @@ func (s *transactionService) Close(ctx context.Context) {
 	}
 	s.service.Close(ctx)
 	s.manager.Close()
+	s.manager = nil
 }
 
 // GetTransaction searches for the transaction associated with the given
@@ -127,3 +128,14 @@ func (s *transactionService) StoreReceipt(txHash types.TransactionHash, receipt
 
 	s.manager.PutReceipt(txHash, receipt)
 }
+
+// DeleteTransaction removes the transaction and the transaction receipt
+// associated with the given transaction hash from the database.
+func (s *transactionService) DeleteTransaction(txHash types.TransactionHash) {
+	s.AddProcess()
+	defer s.DoneProcess()
+
+	s.logger.With("txHash", txHash).Debug("DeleteTransaction")
+
+	s.manager.DeleteTransaction(txHash)
+}
@@ -0,0 +1,81 @@
+package feeder
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/NethermindEth/juno/internal/log"
+)
+
+// DefaultFailoverThreshold is the number of consecutive failed requests
+// after which a Client moves to the next feeder gateway, unless it's
+// changed with SetFailoverThreshold.
+const DefaultFailoverThreshold = 3
+
+// gateways is the list of feeder gateways a Client sends its requests to.
+// Requests go to the active gateway until it fails threshold times in a
+// row, then to the next one, wrapping around at the end of the list.
+type gateways struct {
+	mu        sync.Mutex
+	urls      []*url.URL
+	active    int
+	failures  int
+	threshold int
+}
+
+// current returns the URL of the active gateway.
+func (g *gateways) current() *url.URL {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.urls[g.active]
+}
+
+// report records the outcome of a request sent to u. Only requests sent
+// to the active gateway are counted, so the requests that were in flight
+// when it changed don't move it again.
+func (g *gateways) report(u *url.URL, failed bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if active := g.urls[g.active]; u.Scheme != active.Scheme || u.Host != active.Host {
+		return
+	}
+	if !failed {
+		g.failures = 0
+		return
+	}
+	g.failures++
+	if g.failures < g.threshold || len(g.urls) == 1 {
+		return
+	}
+	from := g.urls[g.active]
+	g.active = (g.active + 1) % len(g.urls)
+	g.failures = 0
+	log.Default.With("From", from, "To", g.urls[g.active], "Failures", g.threshold).
+		Warn("Feeder gateway is failing, switching to the next one")
+}
+
+// skip moves to the next gateway at once, when the active one returns a
+// response that can't be right.
+func (g *gateways) skip() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.urls) == 1 {
+		return
+	}
+	from := g.urls[g.active]
+	g.active = (g.active + 1) % len(g.urls)
+	g.failures = 0
+	log.Default.With("From", from, "To", g.urls[g.active]).
+		Warn("Feeder gateway returned an invalid response, switching to the next one")
+}
+
+// SetFailoverThreshold sets the number of consecutive failed requests
+// after which the Client moves to the next feeder gateway to n. If n isn't
+// positive, DefaultFailoverThreshold is used. It must be called before the
+// Client is used.
+func (c *Client) SetFailoverThreshold(n int) {
+	if n <= 0 {
+		n = DefaultFailoverThreshold
+	}
+	c.gateways.threshold = n
+}
@@ -5,10 +5,12 @@ package feeder
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/NethermindEth/juno/internal/errpkg"
@@ -24,15 +26,36 @@ type HttpClient interface {
 // Client represents a client for the StarkNet feeder gateway.
 type Client struct {
 	httpClient *HttpClient
+	gateways   *gateways
+	requests   *requests
 
+	// BaseURL is the URL of the primary feeder gateway. The requests go to
+	// the active gateway, which is BaseURL until the Client fails over.
+	//
+	// Deprecated: use ActiveGateway to know where the requests are sent.
 	BaseURL            *url.URL
 	BaseAPI, UserAgent string
 }
 
 // NewClient returns a new Client.
 func NewClient(baseURL, baseAPI string, client *HttpClient) *Client {
-	u, err := url.Parse(baseURL)
-	errpkg.CheckFatal(err, "Bad base URL.")
+	return NewFailoverClient([]string{baseURL}, baseAPI, client)
+}
+
+// NewFailoverClient returns a new Client that sends its requests to the
+// first of baseURLs and moves to the next one when a gateway keeps
+// failing.
+func NewFailoverClient(baseURLs []string, baseAPI string, client *HttpClient) *Client {
+	if len(baseURLs) == 0 {
+		// notest
+		log.Default.Fatal("No feeder gateway URL.")
+	}
+	urls := make([]*url.URL, len(baseURLs))
+	for i, baseURL := range baseURLs {
+		u, err := url.Parse(baseURL)
+		errpkg.CheckFatal(err, "Bad base URL.")
+		urls[i] = u
+	}
 	if client == nil {
 		var p HttpClient
 		c := http.Client{
@@ -41,7 +64,27 @@ func NewClient(baseURL, baseAPI string, client *HttpClient) *Client {
 		p = &c
 		client = &p
 	}
-	return &Client{BaseURL: u, BaseAPI: baseAPI, httpClient: client}
+	return &Client{
+		gateways:   &gateways{urls: urls, threshold: DefaultFailoverThreshold},
+		requests:   &requests{},
+		BaseURL:    urls[0],
+		BaseAPI:    baseAPI,
+		httpClient: client,
+	}
+}
+
+// ActiveGateway returns the URL of the feeder gateway the requests are
+// currently sent to.
+func (c *Client) ActiveGateway() string {
+	return c.gateways.current().String()
+}
+
+// ReportInvalidResponse tells the Client that the active feeder gateway
+// returned a response that is well-formed JSON but can't be right, such
+// as a state update with a root that isn't hex. The Client moves to the
+// next gateway, if there is one.
+func (c *Client) ReportInvalidResponse() {
+	c.gateways.skip()
 }
 
 func formattedBlockIdentifier(blockHash, blockNumber string) map[string]string {
@@ -71,7 +114,7 @@ func TxnIdentifier(txHash, txId string) map[string]string {
 // error otherwise.
 func (c *Client) newRequest(method, path string, query map[string]string, body any) (*http.Request, error) {
 	rel := &url.URL{Path: c.BaseAPI + path}
-	u := c.BaseURL.ResolveReference(rel)
+	u := c.gateways.current().ResolveReference(rel)
 	var buf io.ReadWriter
 	if body != nil {
 		buf = new(bytes.Buffer)
@@ -103,18 +146,40 @@ func (c *Client) newRequest(method, path string, query map[string]string, body a
 // do executes a request and waits for response and returns an error
 // otherwise.
 func (c *Client) do(req *http.Request, v any) (*http.Response, error) {
+	return c.send(req, v, true)
+}
+
+// doOptional is do for the endpoints the caller can do without. The
+// request isn't retried and doesn't count towards the failover of the
+// gateway, and a server error is returned as an error.
+func (c *Client) doOptional(req *http.Request, v any) (*http.Response, error) {
+	return c.send(req, v, false)
+}
+
+// send executes a request, retrying it and reporting its outcome to the
+// failover of the gateway if required is set.
+func (c *Client) send(req *http.Request, v any, required bool) (*http.Response, error) {
+	defer c.requests.acquire()()
 	metr.IncreaseRequestsSent()
 	res, err := (*c.httpClient).Do(req)
-	// notest
-	for i := 0; err != nil && i < 2; i++ {
-		time.Sleep(time.Second * 5)
-		res, err = (*c.httpClient).Do(req)
+	if required {
+		// notest
+		for i := 0; err != nil && i < 2; i++ {
+			time.Sleep(time.Second * 5)
+			res, err = (*c.httpClient).Do(req)
+		}
+		c.gateways.report(req.URL, err != nil || res.StatusCode >= http.StatusInternalServerError)
 	}
 	// We tried three times and still received an error
 	if err != nil {
 		metr.IncreaseRequestsFailed()
 		return nil, err
 	}
+	if !required && res.StatusCode >= http.StatusInternalServerError {
+		_ = res.Body.Close()
+		metr.IncreaseRequestsFailed()
+		return nil, fmt.Errorf("feeder gateway answered %s", res.Status)
+	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
@@ -138,8 +203,10 @@ func (c *Client) do(req *http.Request, v any) (*http.Response, error) {
 // doCodeWithABI executes a request and waits for response and returns an error
 // otherwise. de-Marshals response into appropriate ByteCode and ABI structs.
 func (c *Client) doCodeWithABI(req *http.Request, v *CodeInfo) (*http.Response, error) {
+	defer c.requests.acquire()()
 	metr.IncreaseABISent()
 	res, err := (*c.httpClient).Do(req)
+	c.gateways.report(req.URL, err != nil || res.StatusCode >= http.StatusInternalServerError)
 	if err != nil {
 		metr.IncreaseABIFailed()
 		return nil, err
@@ -188,12 +255,12 @@ func (c *Client) doCodeWithABI(req *http.Request, v *CodeInfo) (*http.Response,
 // GetContractAddresses creates a new request to get contract addresses
 // from the gateway.
 func (c Client) GetContractAddresses() (*ContractAddresses, error) {
-	log.Default.With("Gateway URL", c.BaseURL).Info("Getting contract address from gateway.")
+	log.Default.With("Gateway URL", c.ActiveGateway()).Info("Getting contract address from gateway.")
 	req, err := c.newRequest("GET", "/get_contract_addresses", nil, nil)
 	if err != nil {
 		metr.IncreaseContractAddressesFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_contract_addresses.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_contract_addresses.")
 		return nil, err
 	}
 	var res ContractAddresses
@@ -201,20 +268,47 @@ func (c Client) GetContractAddresses() (*ContractAddresses, error) {
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseContractAddressesFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseContractAddressesReceived()
 	return &res, err
 }
 
+// ErrUnknownChain is returned by GetChainId when the StarkNet contract of
+// the gateway is not the one of a known network.
+var ErrUnknownChain = errors.New("unknown chain")
+
+// starknetContracts maps the address of the StarkNet core contract on
+// layer 1 to the network it belongs to.
+var starknetContracts = map[string]ChainID{
+	"0xc662c410c0ecf747543f5ba90660f6abebd9c8c4": Mainnet,
+	"0xde29d060d45901fb19ed6c6e959eb22d8626708e": Testnet,
+}
+
+// GetChainId returns the network the gateway serves. The gateway doesn't
+// expose its chain id, so it's derived from the address of the StarkNet
+// core contract it reports. If the address is not a known one,
+// ErrUnknownChain is returned.
+func (c Client) GetChainId() (ChainID, error) {
+	addresses, err := c.GetContractAddresses()
+	if err != nil {
+		return "", err
+	}
+	chainID, ok := starknetContracts[strings.ToLower(addresses.Starknet)]
+	if !ok {
+		return "", fmt.Errorf("%w: StarkNet contract %q", ErrUnknownChain, addresses.Starknet)
+	}
+	return chainID, nil
+}
+
 // CallContract creates a new request to call a contract using the gateway.
 func (c Client) CallContract(invokeFunc InvokeFunction, blockHash, blockNumber string) (*map[string][]string, error) {
 	req, err := c.newRequest("POST", "/call_contract", formattedBlockIdentifier(blockHash, blockNumber), invokeFunc)
 	if err != nil {
 		metr.IncreaseContractCallsFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_contract_addresses.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_contract_addresses.")
 		return nil, err
 	}
 	var res map[string][]string
@@ -222,7 +316,7 @@ func (c Client) CallContract(invokeFunc InvokeFunction, blockHash, blockNumber s
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseContractCallsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseContractCallsReceived()
@@ -235,7 +329,7 @@ func (c Client) GetBlock(blockHash, blockNumber string) (*StarknetBlock, error)
 	if err != nil {
 		metr.IncreaseBlockFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_contract_addresses.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_contract_addresses.")
 		return nil, err
 	}
 	var res StarknetBlock
@@ -243,7 +337,7 @@ func (c Client) GetBlock(blockHash, blockNumber string) (*StarknetBlock, error)
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseBlockFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseBlockReceived()
@@ -256,7 +350,7 @@ func (c Client) GetStateUpdateGoerli(blockHash, blockNumber string) (*StateUpdat
 	req, err := c.newRequest("GET", "/get_state_update", formattedBlockIdentifier(blockHash, blockNumber), nil)
 	if err != nil {
 		metr.IncreaseStateUpdateGoerliFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_contract_addresses.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_contract_addresses.")
 		return nil, err
 	}
 	var res StateUpdateResponseGoerli
@@ -264,7 +358,7 @@ func (c Client) GetStateUpdateGoerli(blockHash, blockNumber string) (*StateUpdat
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseStateUpdateGoerliFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseStateUpdateGoerliReceived()
@@ -298,7 +392,7 @@ func (c Client) GetStateUpdate(blockHash, blockNumber string) (*StateUpdateRespo
 	if err != nil {
 		metr.IncreaseStateUpdateFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_contract_addresses.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_contract_addresses.")
 		return nil, err
 	}
 
@@ -307,13 +401,46 @@ func (c Client) GetStateUpdate(blockHash, blockNumber string) (*StateUpdateRespo
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseStateUpdateFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseStateUpdateReceived()
 	return &res, err
 }
 
+// GetStateUpdateWithBlock creates a new request to get the State Update
+// of a given block together with the block itself, saving the round
+// trip of a separate GetBlock call. The combined response is served by
+// the get_state_update endpoint when the includeBlock flag is set. Not
+// every gateway supports it, so the request isn't retried and its
+// failures don't make the Client move to another gateway.
+func (c Client) GetStateUpdateWithBlock(blockNumber string) (*StateUpdateWithBlock, error) {
+	query := formattedBlockIdentifier("", blockNumber)
+	if query == nil {
+		// notest
+		query = map[string]string{}
+	}
+	query["includeBlock"] = "true"
+	req, err := c.newRequest("GET", "/get_state_update", query, nil)
+	if err != nil {
+		metr.IncreaseStateUpdateWithBlockFailed()
+		metr.IncreaseRequestsFailed()
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_state_update.")
+		return nil, err
+	}
+
+	var res StateUpdateWithBlock
+	metr.IncreaseStateUpdateWithBlockSent()
+	_, err = c.doOptional(req, &res)
+	if err != nil {
+		metr.IncreaseStateUpdateWithBlockFailed()
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
+		return nil, err
+	}
+	metr.IncreaseStateUpdateWithBlockReceived()
+	return &res, err
+}
+
 // GetCode creates a new request to get the code of a contract
 func (c Client) GetCode(contractAddress, blockHash, blockNumber string) (*CodeInfo, error) {
 	blockIdentifier := formattedBlockIdentifier(blockHash, blockNumber)
@@ -325,14 +452,14 @@ func (c Client) GetCode(contractAddress, blockHash, blockNumber string) (*CodeIn
 	req, err := c.newRequest("GET", "/get_code", blockIdentifier, nil)
 	if err != nil {
 		metr.IncreaseABIFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_contract_addresses.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_contract_addresses.")
 		return nil, err
 	}
 	var res CodeInfo
 	_, err = c.doCodeWithABI(req, &res)
 	if err != nil {
 		metr.IncreaseABIFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	return &res, err
@@ -351,7 +478,7 @@ func (c Client) GetFullContract(contractAddress, blockHash, blockNumber string)
 	if err != nil {
 		metr.IncreaseFullContractsFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_full_contract.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_full_contract.")
 		return nil, err
 	}
 	var res map[string]interface{}
@@ -359,13 +486,90 @@ func (c Client) GetFullContract(contractAddress, blockHash, blockNumber string)
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseFullContractsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseFullContractsReceived()
 	return res, err
 }
 
+// ContractEntryPoint is an entry point of a contract class.
+type ContractEntryPoint struct {
+	Offset   string `json:"offset"`
+	Selector string `json:"selector"`
+}
+
+// ContractEntryPoints are the entry points of a contract class by type.
+type ContractEntryPoints struct {
+	Constructor []ContractEntryPoint `json:"CONSTRUCTOR"`
+	External    []ContractEntryPoint `json:"EXTERNAL"`
+	L1Handler   []ContractEntryPoint `json:"L1_HANDLER"`
+}
+
+// ContractClass is the definition of a contract as returned by
+// get_full_contract. The ABI and the program are kept in the format of
+// the gateway.
+type ContractClass struct {
+	Abi               json.RawMessage     `json:"abi"`
+	EntryPointsByType ContractEntryPoints `json:"entry_points_by_type"`
+	Program           json.RawMessage     `json:"program"`
+}
+
+// GetContractClass creates a new request to get the class of the
+// contract deployed at the given address, with its program, entry
+// points and ABI.
+func (c Client) GetContractClass(contractAddress, blockHash, blockNumber string) (*ContractClass, error) {
+	blockIdentifier := formattedBlockIdentifier(blockHash, blockNumber)
+	if blockIdentifier == nil {
+		// notest
+		blockIdentifier = map[string]string{}
+	}
+	blockIdentifier["contractAddress"] = contractAddress
+	req, err := c.newRequest("GET", "/get_full_contract", blockIdentifier, nil)
+	if err != nil {
+		// notest
+		metr.IncreaseFullContractsFailed()
+		metr.IncreaseRequestsFailed()
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_full_contract.")
+		return nil, err
+	}
+	var res ContractClass
+	metr.IncreaseFullContractsSent()
+	_, err = c.do(req, &res)
+	if err != nil {
+		metr.IncreaseFullContractsFailed()
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
+		return nil, err
+	}
+	metr.IncreaseFullContractsReceived()
+	return &res, err
+}
+
+// GetClassHashAt creates a new request to get the hash of the class of
+// the contract deployed at the given address.
+func (c Client) GetClassHashAt(contractAddress, blockHash, blockNumber string) (string, error) {
+	blockIdentifier := formattedBlockIdentifier(blockHash, blockNumber)
+	if blockIdentifier == nil {
+		// notest
+		blockIdentifier = map[string]string{}
+	}
+	blockIdentifier["contractAddress"] = contractAddress
+	req, err := c.newRequest("GET", "/get_class_hash_at", blockIdentifier, nil)
+	if err != nil {
+		// notest
+		metr.IncreaseRequestsFailed()
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_class_hash_at.")
+		return "", err
+	}
+	var res string
+	_, err = c.do(req, &res)
+	if err != nil {
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
+		return "", err
+	}
+	return res, nil
+}
+
 // GetStorageAt creates a new request to get contract storage.
 func (c Client) GetStorageAt(contractAddress, key, blockHash, blockNumber string) (*StorageInfo, error) {
 	blockIdentifier := formattedBlockIdentifier(blockHash, blockNumber)
@@ -381,7 +585,7 @@ func (c Client) GetStorageAt(contractAddress, key, blockHash, blockNumber string
 	if err != nil {
 		metr.IncreaseContractStorageFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_storage_at.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_storage_at.")
 		return nil, err
 	}
 	var res StorageInfo
@@ -390,7 +594,7 @@ func (c Client) GetStorageAt(contractAddress, key, blockHash, blockNumber string
 
 	if err != nil {
 		metr.IncreaseContractStorageFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseContractStorageReceived()
@@ -404,7 +608,7 @@ func (c Client) GetTransactionStatus(txHash, txID string) (*TransactionStatus, e
 	if err != nil {
 		metr.IncreaseTxStatusFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_transaction_status.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_transaction_status.")
 		return nil, err
 	}
 	var res TransactionStatus
@@ -412,7 +616,7 @@ func (c Client) GetTransactionStatus(txHash, txID string) (*TransactionStatus, e
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseTxStatusFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseTxStatusReceived()
@@ -426,7 +630,7 @@ func (c Client) GetTransactionTrace(txHash, txID string) (*TransactionTrace, err
 	req, err := c.newRequest("GET", "/get_transaction_trace", TxnIdentifier(txHash, txID), nil)
 	if err != nil {
 		metr.IncreaseTxTraceFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_transaction_trace.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_transaction_trace.")
 		return nil, err
 	}
 	var res TransactionTrace
@@ -434,7 +638,7 @@ func (c Client) GetTransactionTrace(txHash, txID string) (*TransactionTrace, err
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseTxTraceFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseTxTraceReceived()
@@ -447,7 +651,7 @@ func (c Client) GetTransaction(txHash, txID string) (*TransactionInfo, error) {
 	if err != nil {
 		metr.IncreaseTxFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_transaction.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_transaction.")
 		return nil, err
 	}
 	var res TransactionInfo
@@ -455,7 +659,7 @@ func (c Client) GetTransaction(txHash, txID string) (*TransactionInfo, error) {
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseTxFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseTxReceived()
@@ -469,7 +673,7 @@ func (c Client) GetTransactionReceipt(txHash, txID string) (*TransactionReceipt,
 	if err != nil {
 		metr.IncreaseTxReceiptFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_transaction_receipt.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_transaction_receipt.")
 		return nil, err
 	}
 	var res TransactionReceipt
@@ -477,7 +681,7 @@ func (c Client) GetTransactionReceipt(txHash, txID string) (*TransactionReceipt,
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseTxReceiptFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseTxReceiptReceived()
@@ -491,7 +695,7 @@ func (c Client) GetBlockHashById(blockID string) (*string, error) {
 	if err != nil {
 		metr.IncreaseBlockHashFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_block_hash_by_id.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_block_hash_by_id.")
 		return nil, err
 	}
 	var res string
@@ -499,7 +703,7 @@ func (c Client) GetBlockHashById(blockID string) (*string, error) {
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseBlockHashFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseBlockHashReceived()
@@ -514,7 +718,7 @@ func (c Client) GetBlockIDByHash(blockHash string) (*string, error) {
 	if err != nil {
 		metr.IncreaseBlockIDFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_block_id_by_hash.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_block_id_by_hash.")
 		return nil, err
 	}
 	var res interface{}
@@ -522,7 +726,7 @@ func (c Client) GetBlockIDByHash(blockHash string) (*string, error) {
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseBlockIDFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	resStr := fmt.Sprintf("%v", res)
@@ -539,7 +743,7 @@ func (c Client) GetTransactionHashByID(txID string) (*string, error) {
 	if err != nil {
 		metr.IncreaseTxHashFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_transaction_hash_by_id.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_transaction_hash_by_id.")
 		return nil, err
 	}
 	var res string
@@ -547,7 +751,7 @@ func (c Client) GetTransactionHashByID(txID string) (*string, error) {
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseTxHashFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Error connecting to the gateway.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Error connecting to the gateway.")
 		return nil, err
 	}
 	metr.IncreaseTxHashReceived()
@@ -563,7 +767,7 @@ func (c Client) GetTransactionIDByHash(txHash string) (*string, error) {
 	if err != nil {
 		metr.IncreaseTxIDFailed()
 		metr.IncreaseRequestsFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).Error("Unable to create a request for get_transaction_id_by_hash.")
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).Error("Unable to create a request for get_transaction_id_by_hash.")
 		return nil, err
 	}
 	var res interface{}
@@ -571,7 +775,7 @@ func (c Client) GetTransactionIDByHash(txHash string) (*string, error) {
 	_, err = c.do(req, &res)
 	if err != nil {
 		metr.IncreaseTxIDFailed()
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).
 			Error("Error connecting to the gateway.")
 		return nil, err
 	}
@@ -603,7 +807,7 @@ func (c Client) EstimateTransactionFee(contractAddress, entryPointSelector, call
 	var res EstimateFeeResponse
 	_, err = c.do(req, &res)
 	if err != nil {
-		log.Default.With("Error", err, "Gateway URL", c.BaseURL).
+		log.Default.With("Error", err, "Gateway URL", c.ActiveGateway()).
 			Error("Error connecting to gateway.")
 	}
 	return &res, err
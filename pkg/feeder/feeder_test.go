@@ -7,11 +7,15 @@ package feeder_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/NethermindEth/juno/pkg/feeder"
 
@@ -78,6 +82,27 @@ func TestGetContractAddress(t *testing.T) {
 	assert.Equal(t, &cOrig, contractAddresses, "Contract Address does not match")
 }
 
+func TestGetChainId(t *testing.T) {
+	tests := [...]struct {
+		starknet string
+		want     feeder.ChainID
+		err      error
+	}{
+		{"0xc662c410C0ECf747543f5bA90660f6ABeBD9C8c4", feeder.Mainnet, nil},
+		{"0xde29d060D45901Fb19ED6C6e959EB22d8626708e", feeder.Testnet, nil},
+		{"0x1", "", feeder.ErrUnknownChain},
+	}
+	for _, test := range tests {
+		body := fmt.Sprintf("{\"GpsStatementVerifier\":\"0x1\",\"Starknet\":\"%s\"}", test.starknet)
+		httpClient.DoReturns(generateResponse(body), nil)
+		chainID, err := client.GetChainId()
+		if !errors.Is(err, test.err) {
+			t.Errorf("GetChainId() for contract %s error = %v, want %v", test.starknet, err, test.err)
+		}
+		assert.Equal(t, test.want, chainID, "GetChainId() for contract %s", test.starknet)
+	}
+}
+
 func TestCallContract(t *testing.T) {
 	a := make(map[string][]string)
 	body, err := json.Marshal(a)
@@ -156,6 +181,24 @@ func stateUpdateResponseToGoerli(res feeder.StateUpdateResponseGoerli) *feeder.S
 	}
 }
 
+func TestGetStateUpdateWithBlock(t *testing.T) {
+	body := `{"block": {"block_hash": "0x6c9a1403d0d573ff7ce46b5ac0fba02b289bed60e26cacbc08f335e0a75fbbe", "block_number": 2, "status": "ACCEPTED_ON_L1"}, "state_update": {"block_hash": "0x6c9a1403d0d573ff7ce46b5ac0fba02b289bed60e26cacbc08f335e0a75fbbe", "new_root": "070d8a4d9843d6fb1a2b0564334133fc00a70b0ec9b9ccd791489c1c17a4a963", "old_root": "0025b10263a0ce4f984d313e8df3fae4dd473e6164b0c5e261a9af35892eafed", "state_diff": {"storage_diffs": {"0x11d0bd2a59aec732a27c3532decaa00db297c9d832f32eeefd35d27285302f2": [{"key": "0x5", "value": "0x64"}]}, "deployed_contracts": []}}}`
+	httpClient.DoReturns(generateResponse(body), nil)
+	var cOrig feeder.StateUpdateWithBlock
+	err := json.Unmarshal([]byte(body), &cOrig)
+	if err != nil {
+		t.Fatal()
+	}
+	stateUpdate, err := client.GetStateUpdateWithBlock("2")
+	if err != nil {
+		t.Fatal()
+	}
+	assert.Equal(t, &cOrig, stateUpdate, "State Update With Block response does not match")
+	assert.Equal(t, stateUpdate.Block.BlockHash, stateUpdate.StateUpdate.BlockHash, "Block and State Update hashes do not match")
+	query := httpClient.DoArgsForCall(httpClient.DoCallCount() - 1).URL.Query()
+	assert.Equal(t, "true", query.Get("includeBlock"), "includeBlock flag not set")
+}
+
 func TestGetFullContract(t *testing.T) {
 	body := "{\"block_hash\": \"0x03a0ae1aaefeed60bafd6990f06d0b68fb593b5d9395ff726868ee61a6e1beb3\", \"block_number\": \"3\"}\n"
 	httpClient.DoReturns(generateResponse(body), nil)
@@ -171,6 +214,34 @@ func TestGetFullContract(t *testing.T) {
 	assert.Equal(t, cOrig, getStateUpdate, "GetFullContract response does not match")
 }
 
+func TestGetContractClass(t *testing.T) {
+	body := `{
+		"abi": [{"inputs": [], "name": "get_balance", "outputs": [{"name": "res", "type": "felt"}], "type": "function"}],
+		"entry_points_by_type": {
+			"CONSTRUCTOR": [],
+			"EXTERNAL": [{"offset": "0x3a", "selector": "0x39e11d48192e4333233c7eb19d10ad67c362bb28580c604d67884c85da39695"}],
+			"L1_HANDLER": []
+		},
+		"program": {"prime": "0x800000000000011000000000000000000000000000000000000000000000001", "data": ["0x1"]}
+	}`
+	httpClient.DoReturns(generateResponse(body), nil)
+	class, err := client.GetContractClass("address", "", "number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []feeder.ContractEntryPoint{{
+		Offset:   "0x3a",
+		Selector: "0x39e11d48192e4333233c7eb19d10ad67c362bb28580c604d67884c85da39695",
+	}}, class.EntryPointsByType.External, "external entry points do not match")
+	assert.Empty(t, class.EntryPointsByType.Constructor, "unexpected constructor entry points")
+	assert.JSONEq(t, `{"prime": "0x800000000000011000000000000000000000000000000000000000000000001", "data": ["0x1"]}`,
+		string(class.Program), "program does not match")
+	assert.JSONEq(t, `[{"inputs": [], "name": "get_balance", "outputs": [{"name": "res", "type": "felt"}], "type": "function"}]`,
+		string(class.Abi), "ABI does not match")
+	query := httpClient.DoArgsForCall(httpClient.DoCallCount() - 1).URL.Query()
+	assert.Equal(t, "address", query.Get("contractAddress"), "contractAddress not set")
+}
+
 func TestGetCode(t *testing.T) {
 	a := feeder.CodeInfo{}
 	body, err := StructFaker(a)
@@ -185,6 +256,129 @@ func TestGetCode(t *testing.T) {
 	assert.Equal(t, &a, getCode, "GetCode response does not match")
 }
 
+func TestFailover(t *testing.T) {
+	fake := &feederfakes.FakeHttpClient{}
+	var p feeder.HttpClient = fake
+	c := feeder.NewFailoverClient([]string{"https://primary", "https://fallback"}, "/feeder_gateway/", &p)
+	assert.Equal(t, "https://primary", c.ActiveGateway())
+
+	// A success resets the count of consecutive failures.
+	fake.DoReturns(nil, errors.New("connection refused"))
+	_, _ = c.GetCode("0x1", "", "latest")
+	_, _ = c.GetCode("0x1", "", "latest")
+	fake.DoReturns(generateResponse("{\"abi\": []}"), nil)
+	_, _ = c.GetCode("0x1", "", "latest")
+	fake.DoReturns(nil, errors.New("connection refused"))
+	_, _ = c.GetCode("0x1", "", "latest")
+	_, _ = c.GetCode("0x1", "", "latest")
+	assert.Equal(t, "https://primary", c.ActiveGateway())
+
+	_, _ = c.GetCode("0x1", "", "latest")
+	assert.Equal(t, "https://fallback", c.ActiveGateway())
+	fake.DoReturns(generateResponse("{\"abi\": []}"), nil)
+	if _, err := c.GetCode("0x1", "", "latest"); err != nil {
+		t.Fatal(err)
+	}
+	req := fake.DoArgsForCall(fake.DoCallCount() - 1)
+	assert.Equal(t, "fallback", req.URL.Host)
+
+	// Server errors count as failures and the list wraps around.
+	for i := 0; i < 3; i++ {
+		fake.DoReturns(&http.Response{StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil)
+		_, _ = c.GetCode("0x1", "", "latest")
+	}
+	assert.Equal(t, "https://primary", c.ActiveGateway())
+
+	// The failures of the combined state update endpoint are returned but
+	// don't count, since not every gateway supports it.
+	calls := fake.DoCallCount()
+	for i := 0; i < 3; i++ {
+		fake.DoReturns(&http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway", Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil)
+		if _, err := c.GetStateUpdateWithBlock("1"); err == nil {
+			t.Error("GetStateUpdateWithBlock didn't fail on a server error")
+		}
+	}
+	fake.DoReturns(nil, errors.New("connection refused"))
+	for i := 0; i < 3; i++ {
+		_, _ = c.GetStateUpdateWithBlock("1")
+	}
+	assert.Equal(t, "https://primary", c.ActiveGateway())
+	assert.Equal(t, calls+6, fake.DoCallCount(), "the combined state update requests were retried")
+
+	// An invalid response moves to the next gateway at once.
+	c.ReportInvalidResponse()
+	assert.Equal(t, "https://fallback", c.ActiveGateway())
+	single := feeder.NewClient("https://primary", "/feeder_gateway/", &p)
+	single.ReportInvalidResponse()
+	assert.Equal(t, "https://primary", single.ActiveGateway())
+
+	// BaseURL stays the primary gateway after a fail over.
+	assert.Equal(t, "https://primary", c.BaseURL.String())
+}
+
+func TestSetFailoverThreshold(t *testing.T) {
+	fake := &feederfakes.FakeHttpClient{}
+	var p feeder.HttpClient = fake
+	c := feeder.NewFailoverClient([]string{"https://primary", "https://fallback"}, "/feeder_gateway/", &p)
+	c.SetFailoverThreshold(1)
+	fake.DoReturns(nil, errors.New("connection refused"))
+	_, _ = c.GetCode("0x1", "", "latest")
+	assert.Equal(t, "https://fallback", c.ActiveGateway())
+
+	// A threshold that isn't positive means the default one.
+	c.SetFailoverThreshold(0)
+	for i := 0; i < feeder.DefaultFailoverThreshold-1; i++ {
+		_, _ = c.GetCode("0x1", "", "latest")
+	}
+	assert.Equal(t, "https://fallback", c.ActiveGateway())
+	_, _ = c.GetCode("0x1", "", "latest")
+	assert.Equal(t, "https://primary", c.ActiveGateway())
+}
+
+func TestLimitRequests(t *testing.T) {
+	const limit, requests = 2, 8
+	fake := &feederfakes.FakeHttpClient{}
+	var p feeder.HttpClient = fake
+	c := feeder.NewClient("https://local", "/feeder_gateway/", &p)
+	c.LimitRequests(limit)
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int64
+	unblock := make(chan struct{})
+	fake.DoStub = func(*http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		<-unblock
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return generateResponse("{}"), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = c.GetBlock("", "1")
+		}()
+	}
+	// Wait for the requests allowed by the limit to be sent.
+	for fake.DoCallCount() < limit {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int64(limit), c.InFlight())
+	close(unblock)
+	wg.Wait()
+
+	assert.Equal(t, requests, fake.DoCallCount())
+	assert.Equal(t, int64(limit), maxInFlight)
+	assert.Equal(t, int64(0), c.InFlight())
+}
+
 func TestGetCode_ABICoverage(t *testing.T) {
 	a := feederfakes.ReturnAbiInfo_Full()
 	assert.Equal(t, "Struct-custom", a.Structs[0].Name)
@@ -373,6 +567,19 @@ func TestGetTransactionIdByHash(t *testing.T) {
 	assert.Equal(t, &cOrig, transactionId, "GetTransactionIdByHash response does not match")
 }
 
+func TestGetClassHashAt(t *testing.T) {
+	httpClient.DoReturns(generateResponse("\"0x1234\""), nil)
+	classHash, err := client.GetClassHashAt("address", "", "number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "0x1234", classHash, "GetClassHashAt response does not match")
+	req := httpClient.DoArgsForCall(httpClient.DoCallCount() - 1)
+	assert.True(t, strings.HasSuffix(req.URL.Path, "/get_class_hash_at"), "wrong endpoint %s", req.URL.Path)
+	assert.Equal(t, "address", req.URL.Query().Get("contractAddress"), "contractAddress not set")
+	assert.Equal(t, "number", req.URL.Query().Get("blockNumber"), "blockNumber not set")
+}
+
 func TestGetStorageAt(t *testing.T) {
 	var body feeder.StorageInfo
 	body = "\"storage\"\n"
@@ -0,0 +1,124 @@
+// Package feedertest provides a feeder gateway serving recorded responses
+// for tests that can't reach the network.
+package feedertest
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/NethermindEth/juno/pkg/feeder"
+)
+
+// keyParams maps the endpoints the Server serves to the query parameter
+// their responses are keyed by.
+var keyParams = map[string]string{
+	"get_state_update": "blockNumber",
+	"get_block":        "blockNumber",
+	"get_code":         "contractAddress",
+	"get_transaction":  "transactionHash",
+}
+
+// Server is a feeder gateway serving recorded responses. The responses
+// of get_state_update and get_block are keyed by block number, the ones
+// of get_code by contract address and the ones of get_transaction by
+// transaction hash. A request for a key without a response gets the
+// answer of the StarkNet feeder gateway for a missing object. The
+// combined state update and block is served if both are recorded.
+type Server struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses map[string][]byte
+}
+
+// NewServer starts a Server with the responses in fixtures, stored as
+// <endpoint>/<key>.json, for example get_state_update/0.json, and returns
+// it along with a client of it. The Server is closed when the test ends.
+func NewServer(t testing.TB, fixtures fs.FS) (*Server, *feeder.Client) {
+	t.Helper()
+	s := &Server{responses: make(map[string][]byte)}
+	if fixtures != nil {
+		for endpoint := range keyParams {
+			files, err := fs.Glob(fixtures, endpoint+"/*.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				body, err := fs.ReadFile(fixtures, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.Set(endpoint, strings.TrimSuffix(path.Base(file), ".json"), body)
+			}
+		}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s, feeder.NewClient(s.URL, "/feeder_gateway", nil)
+}
+
+// Set sets the response of the endpoint for the key, replacing the
+// recorded one, for example to serve another block after a reorg.
+func (s *Server) Set(endpoint, key string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[endpoint+"/"+key] = body
+}
+
+// Delete removes the response of the endpoint for the key, so that it's
+// served as missing.
+func (s *Server) Delete(endpoint, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, endpoint+"/"+key)
+}
+
+func (s *Server) response(endpoint, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.responses[endpoint+"/"+key]
+	return body, ok
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	endpoint := path.Base(r.URL.Path)
+	param, ok := keyParams[endpoint]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key := r.URL.Query().Get(param)
+	body, ok := s.response(endpoint, key)
+	if ok && endpoint == "get_state_update" && r.URL.Query().Get("includeBlock") == "true" {
+		var block []byte
+		if block, ok = s.response("get_block", key); ok {
+			body = []byte(fmt.Sprintf(`{"block": %s, "state_update": %s}`, block, body))
+		}
+	}
+	if !ok {
+		notFound(w, endpoint, key)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// notFound writes what the StarkNet feeder gateway answers when the
+// object requested from the endpoint doesn't exist.
+func notFound(w http.ResponseWriter, endpoint, key string) {
+	w.Header().Set("Content-Type", "application/json")
+	switch endpoint {
+	case "get_transaction":
+		_, _ = w.Write([]byte(`{"status": "NOT_RECEIVED"}`))
+	case "get_code":
+		_, _ = w.Write([]byte(`{"bytecode": [], "abi": []}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, `{"code": "StarknetErrorCode.BLOCK_NOT_FOUND", "message": "Block number %s was not found."}`, key)
+	}
+}
@@ -0,0 +1,85 @@
+package feedertest_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/NethermindEth/juno/pkg/feeder/feedertest"
+)
+
+func TestServer(t *testing.T) {
+	fixtures := fstest.MapFS{
+		"get_state_update/0.json": {Data: []byte(`{"block_hash": "0xb0", "new_root": "0x1", "old_root": "0x0"}`)},
+		"get_block/0.json":        {Data: []byte(`{"block_hash": "0xb0", "block_number": 0, "parent_block_hash": "0x0"}`)},
+		"get_state_update/1.json": {Data: []byte(`{"block_hash": "0xb1", "new_root": "0x2", "old_root": "0x1"}`)},
+		"get_code/0x1.json":       {Data: []byte(`{"bytecode": ["0x1", "0x2"], "abi": []}`)},
+		"get_transaction/0xa.json": {
+			Data: []byte(`{"status": "ACCEPTED_ON_L2", "block_number": 0, "transaction": {"transaction_hash": "0xa"}}`),
+		},
+	}
+	srv, client := feedertest.NewServer(t, fixtures)
+
+	update, err := client.GetStateUpdate("", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.BlockHash != "0xb0" || update.NewRoot != "0x1" {
+		t.Errorf("state update of block 0 = %+v, want the recorded one", update)
+	}
+	combined, err := client.GetStateUpdateWithBlock("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if combined.Block.BlockHash != "0xb0" || combined.StateUpdate.NewRoot != "0x1" {
+		t.Errorf("combined state update of block 0 = %+v, want the recorded one", combined)
+	}
+	// Block 1 has no recorded block, so it isn't combined.
+	if combined, err := client.GetStateUpdateWithBlock("1"); err != nil || combined.Block.BlockHash != "" {
+		t.Errorf("combined state update of block 1 = %+v, %v, want none", combined, err)
+	}
+
+	// A missing block is answered as by the feeder gateway.
+	update, err = client.GetStateUpdate("", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.BlockHash != "" {
+		t.Errorf("state update of a missing block = %+v, want an empty one", update)
+	}
+
+	// Replacing a block, as in a reorg.
+	srv.Set("get_block", "0", []byte(`{"block_hash": "0xc0", "block_number": 0, "parent_block_hash": "0x0"}`))
+	block, err := client.GetBlock("", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BlockHash != "0xc0" {
+		t.Errorf("block 0 after it was replaced = %s, want 0xc0", block.BlockHash)
+	}
+	srv.Delete("get_block", "0")
+	if block, err := client.GetBlock("", "0"); err != nil || block.BlockHash != "" {
+		t.Errorf("block 0 after it was deleted = %+v, %v, want none", block, err)
+	}
+
+	code, err := client.GetCode("0x1", "", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code.Bytecode) != 2 {
+		t.Errorf("bytecode of contract 0x1 = %v, want the recorded one", code.Bytecode)
+	}
+	if code, err := client.GetCode("0x2", "", "0"); err != nil || len(code.Bytecode) != 0 {
+		t.Errorf("code of a missing contract = %+v, %v, want none", code, err)
+	}
+
+	tx, err := client.GetTransaction("0xa", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != "ACCEPTED_ON_L2" {
+		t.Errorf("status of transaction 0xa = %s, want ACCEPTED_ON_L2", tx.Status)
+	}
+	if tx, err := client.GetTransaction("0xb", ""); err != nil || tx.Status != "NOT_RECEIVED" {
+		t.Errorf("status of a missing transaction = %+v, %v, want NOT_RECEIVED", tx, err)
+	}
+}
@@ -0,0 +1,52 @@
+package feeder
+
+import (
+	"context"
+	"sync/atomic"
+
+	metr "github.com/NethermindEth/juno/internal/metrics/prometheus"
+	"golang.org/x/sync/semaphore"
+)
+
+// requests limits the number of requests a Client and its copies have in
+// flight at once. The zero value doesn't limit them.
+type requests struct {
+	sem      *semaphore.Weighted
+	inFlight int64
+}
+
+// acquire waits until a request can be sent and returns the function
+// that releases it once its response has been read.
+func (r *requests) acquire() (release func()) {
+	if r.sem != nil {
+		// It can't fail: the context is never done.
+		_ = r.sem.Acquire(context.Background(), 1)
+	}
+	atomic.AddInt64(&r.inFlight, 1)
+	metr.IncreaseFeederRequestsInFlight()
+	return func() {
+		atomic.AddInt64(&r.inFlight, -1)
+		metr.DecreaseFeederRequestsInFlight()
+		if r.sem != nil {
+			r.sem.Release(1)
+		}
+	}
+}
+
+// LimitRequests limits the number of requests to the feeder gateway that
+// the Client has in flight at once to n. The limit is shared by the
+// copies of the Client, and by all its methods. If n isn't positive, the
+// requests aren't limited. It must be called before the Client is used.
+func (c *Client) LimitRequests(n int) {
+	if n <= 0 {
+		c.requests.sem = nil
+		return
+	}
+	c.requests.sem = semaphore.NewWeighted(int64(n))
+}
+
+// InFlight returns the number of requests to the feeder gateway the
+// Client has in flight.
+func (c *Client) InFlight() int64 {
+	return atomic.LoadInt64(&c.requests.inFlight)
+}
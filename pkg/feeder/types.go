@@ -101,14 +101,18 @@ func (i InvokeFunction) CalculateHash(config StarknetGeneralConfig) Hash {
 
 // TxnSpecificInfo represent a StarkNet transaction information.
 type TxnSpecificInfo struct {
-	ContractAddress    string   `json:"contract_address"`
-	EntryPointSelector string   `json:"entry_point_selector"`
-	EntryPointType     string   `json:"entry_point_type"`
-	Calldata           []string `json:"calldata"`
-	Signature          []string `json:"signature"`
-	TransactionHash    string   `json:"transaction_hash"`
-	MaxFee             string   `json:"max_fee"`
-	Type               string   `json:"type"`
+	ContractAddress     string   `json:"contract_address"`
+	EntryPointSelector  string   `json:"entry_point_selector"`
+	EntryPointType      string   `json:"entry_point_type"`
+	Calldata            []string `json:"calldata"`
+	Signature           []string `json:"signature"`
+	TransactionHash     string   `json:"transaction_hash"`
+	MaxFee              string   `json:"max_fee"`
+	Type                string   `json:"type"`
+	ClassHash           string   `json:"class_hash"`
+	ContractAddressSalt string   `json:"contract_address_salt"`
+	ConstructorCalldata []string `json:"constructor_calldata"`
+	Nonce               string   `json:"nonce"`
 }
 
 // L1ToL2Message Represents a StarkNet L1-to-L2 message.
@@ -280,6 +284,13 @@ type StateUpdateResponse struct {
 	StateDiff StateDiff `json:"state_diff"`
 }
 
+// StateUpdateWithBlock represents the combined response of a StarkNet
+// state update and the block it belongs to.
+type StateUpdateWithBlock struct {
+	Block       StarknetBlock       `json:"block"`
+	StateUpdate StateUpdateResponse `json:"state_update"`
+}
+
 type Fee struct {
 	Amount int    `json:"amount,omitempty"`
 	Unit   string `json:"unit,omitempty"`
@@ -0,0 +1,62 @@
+package starknet
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/NethermindEth/juno/pkg/crypto/pedersen"
+	"github.com/NethermindEth/juno/pkg/store"
+	"github.com/NethermindEth/juno/pkg/trie"
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+)
+
+// txCommitmentHeight is the height of the Patricia trie of the
+// transaction commitment of a block.
+const txCommitmentHeight = 64
+
+// ErrUnknownTxCommitment is returned by VerifyTxCommitment when the block
+// has no transaction commitment to check against, as for the blocks
+// synced from the feeder gateway, which doesn't return it.
+var ErrUnknownTxCommitment = errors.New("the transaction commitment of the block is unknown")
+
+// TxCommitment returns the commitment to the transactions of a block: the
+// root of the Patricia trie of height 64 whose leaf at index i is
+// h(hashes[i], h(signatures[i])), where the signature is hashed with
+// pedersen.ArrayDigest. signatures may be shorter than hashes; the missing
+// signatures are empty, as they are for the transactions other than
+// invokes.
+func TxCommitment(hashes []*localTypes.Felt, signatures [][]*localTypes.Felt) *localTypes.Felt {
+	txTrie := trie.New(store.New(), txCommitmentHeight)
+	for i, hash := range hashes {
+		var signature []*big.Int
+		if i < len(signatures) {
+			signature = make([]*big.Int, len(signatures[i]))
+			for j, s := range signatures[i] {
+				signature[j] = s.Big()
+			}
+		}
+		txTrie.Put(big.NewInt(int64(i)), pedersen.Digest(hash.Big(), pedersen.ArrayDigest(signature...)))
+	}
+	commitment := localTypes.BigToFelt(txTrie.Commitment())
+	return &commitment
+}
+
+// VerifyTxCommitment returns whether the transactions with the given
+// hashes and signatures, in order, are the ones the block commits to. A
+// list of transactions that is truncated or reordered doesn't match. If
+// the transaction commitment of the block is unknown,
+// ErrUnknownTxCommitment is returned.
+func VerifyTxCommitment(block *localTypes.Block, txHashes []*localTypes.Felt, signatures [][]*localTypes.Felt) (bool, error) {
+	if block.TxCount == 0 {
+		// The commitment of a block without transactions is 0.
+		return len(txHashes) == 0, nil
+	}
+	if block.TxCommitment == (localTypes.Felt{}) {
+		return false, fmt.Errorf("%w: block %d", ErrUnknownTxCommitment, block.BlockNumber)
+	}
+	if uint64(len(txHashes)) != block.TxCount {
+		return false, nil
+	}
+	return *TxCommitment(txHashes, signatures) == block.TxCommitment, nil
+}
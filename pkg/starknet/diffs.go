@@ -0,0 +1,176 @@
+package starknet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/internal/db"
+	starknetTypes "github.com/NethermindEth/juno/pkg/starknet/types"
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+)
+
+// stateDiffPrefix is the prefix of the keys of the state diffs retained
+// in the state database. The state diff of a block is stored under the
+// prefix followed by its block number in decimal, zero-padded to 20
+// digits so that the keys sort by block number.
+const stateDiffPrefix = "state_diff_"
+
+// ErrStateDiffNotRetained is returned by StateDiff for a block whose
+// state diff isn't among the retained ones.
+var ErrStateDiffNotRetained = errors.New("state diff not retained")
+
+// storedStateDiff is the encoding of a retained state diff. The storage
+// diffs are kept in the order they are applied in.
+type storedStateDiff struct {
+	DeployedContracts []starknetTypes.DeployedContract `json:"deployed_contracts"`
+	StorageDiffs      []storedStorageDiff              `json:"storage_diffs"`
+}
+
+type storedStorageDiff struct {
+	Address string             `json:"address"`
+	KVs     []starknetTypes.KV `json:"kvs"`
+}
+
+func stateDiffKey(blockNumber uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", stateDiffPrefix, blockNumber))
+}
+
+// errEndOfStateDiffs stops the iteration over the retained state diffs.
+var errEndOfStateDiffs = errors.New("end of the state diffs")
+
+// putStateDiff stores the state diff applied for the given block and
+// removes the ones of the blocks retention blocks or more before, so that
+// only the state diffs of the last retention blocks are kept. Nothing is
+// stored if retention isn't positive.
+func putStateDiff(txn db.DatabaseOperations, blockNumber uint64, stateDiff *starknetTypes.StateDiff, retention int) error {
+	if retention <= 0 {
+		return nil
+	}
+	stored := storedStateDiff{DeployedContracts: stateDiff.DeployedContracts}
+	stateDiff.StorageDiffs.Range(func(address localTypes.Felt, kvs []starknetTypes.KV) bool {
+		stored.StorageDiffs = append(stored.StorageDiffs, storedStorageDiff{Address: address.Hex(), KVs: kvs})
+		return true
+	})
+	value, err := json.Marshal(stored)
+	if err != nil {
+		// notest
+		return fmt.Errorf("couldn't encode the state diff of block %d: %w", blockNumber, err)
+	}
+	if err := txn.Put(stateDiffKey(blockNumber), value); err != nil {
+		// notest
+		return fmt.Errorf("couldn't store the state diff of block %d: %w", blockNumber, err)
+	}
+	if blockNumber < uint64(retention) {
+		return nil
+	}
+	return pruneStateDiffs(txn, blockNumber-uint64(retention)+1)
+}
+
+// pruneStateDiffs removes the retained state diffs of the blocks before
+// the given one. If txn can't be iterated over, only the state diff of the
+// block just before is removed.
+func pruneStateDiffs(txn db.DatabaseOperations, blockNumber uint64) error {
+	iterable, ok := txn.(db.OperationsIterable)
+	if !ok {
+		// notest
+		return deleteStateDiff(txn, blockNumber-1)
+	}
+	// The keys are collected first, since the transaction mustn't be
+	// modified while it's iterated over.
+	end := stateDiffKey(blockNumber)
+	var keys [][]byte
+	err := iterable.IterateFrom([]byte(stateDiffPrefix), func(key, _ []byte) error {
+		if !bytes.HasPrefix(key, []byte(stateDiffPrefix)) || bytes.Compare(key, end) >= 0 {
+			return errEndOfStateDiffs
+		}
+		keys = append(keys, append([]byte(nil), key...))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEndOfStateDiffs) {
+		// notest
+		return fmt.Errorf("couldn't read the state diffs before block %d: %w", blockNumber, err)
+	}
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			// notest
+			return fmt.Errorf("couldn't delete the state diff %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// deleteStateDiff removes the state diff of the given block, if it's
+// retained.
+func deleteStateDiff(txn db.DatabaseOperations, blockNumber uint64) error {
+	key := stateDiffKey(blockNumber)
+	// Deleting a missing key is an error.
+	has, err := txn.Has(key)
+	if err == nil && has {
+		err = txn.Delete(key)
+	}
+	if err != nil {
+		// notest
+		return fmt.Errorf("couldn't delete the state diff of block %d: %w", blockNumber, err)
+	}
+	return nil
+}
+
+// getStateDiff returns the retained state diff of the given block, or
+// ErrStateDiffNotRetained if there is none.
+func getStateDiff(database db.DatabaseOperations, blockNumber uint64) (*starknetTypes.StateDiff, error) {
+	value, err := database.Get(stateDiffKey(blockNumber))
+	if db.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: block %d", ErrStateDiffNotRetained, blockNumber)
+	}
+	if err != nil {
+		// notest
+		return nil, err
+	}
+	var stored storedStateDiff
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return nil, fmt.Errorf("state diff of block %d: %w", blockNumber, err)
+	}
+	stateDiff := &starknetTypes.StateDiff{DeployedContracts: stored.DeployedContracts}
+	for _, storage := range stored.StorageDiffs {
+		address, err := localTypes.FeltFromHex(storage.Address)
+		if err != nil {
+			return nil, fmt.Errorf("state diff of block %d: address of storage diff: %w", blockNumber, err)
+		}
+		stateDiff.StorageDiffs.Put(address, storage.KVs)
+	}
+	return stateDiff, nil
+}
+
+// appliedStateDiff returns the state diff applied for the given block,
+// which is read from the retained ones if it's there and fetched from
+// the feeder gateway otherwise.
+func (s *Synchronizer) appliedStateDiff(blockNumber uint64) (*starknetTypes.StateDiff, error) {
+	stateDiff, err := getStateDiff(s.stateDatabase, blockNumber)
+	if !errors.Is(err, ErrStateDiffNotRetained) {
+		return stateDiff, err
+	}
+	update, _, err := s.getStateUpdate(blockNumber)
+	if err != nil {
+		// notest
+		return nil, fmt.Errorf("couldn't get the state update of block %d: %w", blockNumber, err)
+	}
+	fetched, err := stateUpdateResponseToStateDiff(*update)
+	if err != nil {
+		// notest
+		return nil, fmt.Errorf("state update of block %d: %w", blockNumber, err)
+	}
+	if err := fetched.Validate(); err != nil {
+		// notest
+		return nil, fmt.Errorf("state update of block %d: %w", blockNumber, err)
+	}
+	return &fetched, nil
+}
+
+// StateDiff returns the state diff the Synchronizer applied for the given
+// block, if it's among the last DiffRetention blocks synced. Otherwise,
+// ErrStateDiffNotRetained is returned.
+func (s *Synchronizer) StateDiff(blockNumber uint64) (*starknetTypes.StateDiff, error) {
+	return getStateDiff(s.stateDatabase, blockNumber)
+}
@@ -0,0 +1,76 @@
+package starknet
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+)
+
+// ErrStorageChanged is returned by DumpContractStorage when a block
+// updates the storage of the contract while it is being dumped, so the
+// dump mixes two states and must be taken again.
+var ErrStorageChanged = errors.New("contract storage changed during the dump")
+
+// StorageSlot is a storage slot of a contract as dumped by
+// DumpContractStorage.
+type StorageSlot struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// DumpContractStorage writes every storage slot of the contract at the
+// given address in the local state to w, as a JSON array of StorageSlot
+// in increasing order of the keys. The slots are read from the committed
+// storage trie and written as they are read, so the storage is never
+// held in memory. Holding a database transaction while w is written
+// would block the sync, so the slots are read outside of one; if a block
+// updates the storage meanwhile, ErrStorageChanged is returned after the
+// dump.
+func (s *Synchronizer) DumpContractStorage(address string, w io.Writer) error {
+	contract, err := localTypes.FeltFromHex(address)
+	if err != nil {
+		return fmt.Errorf("contract address: %w", err)
+	}
+	storageTrie := newTrie(s.stateDatabase, remove0x(contract.Hex()))
+	root := storageTrie.Commitment()
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	first := true
+	err = storageTrie.Iterate(func(key, val *big.Int) error {
+		slot, err := json.Marshal(StorageSlot{
+			Key:   localTypes.BigToFelt(key).Hex(),
+			Value: localTypes.BigToFelt(val).Hex(),
+		})
+		if err != nil {
+			// notest
+			return err
+		}
+		if !first {
+			bw.WriteString(",")
+		}
+		first = false
+		_, err = bw.Write(slot)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("]\n")
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	changed := storageTrie.Commitment().Cmp(root) != 0
+	if err := storageTrie.Err(); err != nil {
+		return err
+	}
+	if changed {
+		return fmt.Errorf("%w: %s", ErrStorageChanged, contract.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package starknet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	dbAbi "github.com/NethermindEth/juno/internal/db/abi"
+	"github.com/NethermindEth/juno/pkg/types"
+)
+
+// ErrUnknownEvent is returned by DecodeEvent when the event isn't in the
+// ABI of the contract that emitted it.
+var ErrUnknownEvent = errors.New("event not in the ABI")
+
+// DecodeEvent decodes the data of an event emitted by a contract with the
+// given ABI into a map from the names of the event members to their
+// values, like UnpackIntoMap does for layer 1 events. The event is found
+// by its first key, the selector of its name. A felt is decoded as a
+// types.Felt, a struct as a map from its member names to their values
+// and an array, whose length is the member before it, as a
+// []interface{}.
+func DecodeEvent(abi *dbAbi.Abi, raw types.Event) (map[string]interface{}, error) {
+	if len(raw.Keys) == 0 {
+		return nil, fmt.Errorf("%w: event has no keys", ErrUnknownEvent)
+	}
+	var event *dbAbi.AbiEvent
+	for _, e := range abi.GetEvents() {
+		if SelectorFeltFromName(e.Name) == raw.Keys[0] {
+			event = e
+			break
+		}
+	}
+	if event == nil {
+		return nil, fmt.Errorf("%w: selector %s", ErrUnknownEvent, raw.Keys[0].Hex())
+	}
+
+	d := eventDecoder{structs: make(map[string]*dbAbi.Struct), data: raw.Data}
+	for _, s := range abi.GetStructs() {
+		d.structs[s.Name] = s
+	}
+	values := make(map[string]interface{}, len(event.Data))
+	var previous interface{}
+	for _, member := range event.Data {
+		value, err := d.decode(member.Type, previous)
+		if err != nil {
+			return nil, fmt.Errorf("member %s of event %s: %w", member.Name, event.Name, err)
+		}
+		values[member.Name] = value
+		previous = value
+	}
+	if len(d.data) != 0 {
+		return nil, fmt.Errorf("event %s has %d more data elements than its ABI", event.Name, len(d.data))
+	}
+	return values, nil
+}
+
+// eventDecoder decodes the values of an event from the data not yet
+// consumed.
+type eventDecoder struct {
+	structs map[string]*dbAbi.Struct
+	data    []types.Felt
+}
+
+// decode consumes a value of type typ. previous is the value before it,
+// which holds the length of an array.
+func (d *eventDecoder) decode(typ string, previous interface{}) (interface{}, error) {
+	if elem := strings.TrimSuffix(typ, "*"); elem != typ {
+		length, ok := previous.(types.Felt)
+		if !ok {
+			return nil, fmt.Errorf("array of %s isn't preceded by its length", elem)
+		}
+		n := length.Big()
+		if !n.IsInt64() || n.Int64() > int64(len(d.data)) {
+			return nil, fmt.Errorf("array length %s is longer than the data", length.Hex())
+		}
+		values := make([]interface{}, n.Int64())
+		for i := range values {
+			value, err := d.decode(elem, nil)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+	if typ == "felt" {
+		if len(d.data) == 0 {
+			return nil, errors.New("not enough data")
+		}
+		value := d.data[0]
+		d.data = d.data[1:]
+		return value, nil
+	}
+	s, ok := d.structs[typ]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+	fields := make([]*dbAbi.Struct_Field, len(s.Fields))
+	copy(fields, s.Fields)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Offset < fields[j].Offset })
+	values := make(map[string]interface{}, len(fields))
+	var previousField interface{}
+	for _, field := range fields {
+		value, err := d.decode(field.Type, previousField)
+		if err != nil {
+			return nil, fmt.Errorf("member %s of struct %s: %w", field.Name, s.Name, err)
+		}
+		values[field.Name] = value
+		previousField = value
+	}
+	return values, nil
+}
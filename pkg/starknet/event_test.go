@@ -0,0 +1,73 @@
+package starknet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	dbAbi "github.com/NethermindEth/juno/internal/db/abi"
+	"github.com/NethermindEth/juno/pkg/types"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	abi := &dbAbi.Abi{
+		Events: []*dbAbi.AbiEvent{
+			{Name: "Approval", Data: []*dbAbi.AbiEvent_Data{{Name: "owner", Type: "felt"}}},
+			{Name: "Transfer", Data: []*dbAbi.AbiEvent_Data{
+				{Name: "from_", Type: "felt"},
+				{Name: "value", Type: "Uint256"},
+				{Name: "ids_len", Type: "felt"},
+				{Name: "ids", Type: "felt*"},
+			}},
+		},
+		Structs: []*dbAbi.Struct{{
+			Name: "Uint256",
+			Size: 2,
+			// The fields are decoded by offset, whatever their order.
+			Fields: []*dbAbi.Struct_Field{{Name: "high", Type: "felt", Offset: 1}, {Name: "low", Type: "felt", Offset: 0}},
+		}},
+	}
+	felts := func(hexes ...string) []types.Felt {
+		f := make([]types.Felt, len(hexes))
+		for i, h := range hexes {
+			f[i] = types.HexToFelt(h)
+		}
+		return f
+	}
+	transfer := SelectorFeltFromName("Transfer")
+
+	got, err := DecodeEvent(abi, types.Event{
+		Keys: []types.Felt{transfer},
+		Data: felts("0xa", "0x1", "0x2", "0x2", "0x7", "0x8"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"from_":   types.HexToFelt("0xa"),
+		"value":   map[string]interface{}{"low": types.HexToFelt("0x1"), "high": types.HexToFelt("0x2")},
+		"ids_len": types.HexToFelt("0x2"),
+		"ids":     []interface{}{types.HexToFelt("0x7"), types.HexToFelt("0x8")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeEvent() = %v, want %v", got, want)
+	}
+
+	invalid := []struct {
+		name  string
+		event types.Event
+	}{
+		{"no keys", types.Event{Data: felts("0x1")}},
+		{"unknown selector", types.Event{Keys: []types.Felt{SelectorFeltFromName("Mint")}}},
+		{"short data", types.Event{Keys: []types.Felt{transfer}, Data: felts("0xa", "0x1", "0x2", "0x3", "0x7")}},
+		{"long data", types.Event{Keys: []types.Felt{transfer}, Data: felts("0xa", "0x1", "0x2", "0x0", "0x7")}},
+	}
+	for _, test := range invalid {
+		if _, err := DecodeEvent(abi, test.event); err == nil {
+			t.Errorf("DecodeEvent() of an event with %s did not fail", test.name)
+		}
+	}
+	if _, err := DecodeEvent(abi, invalid[1].event); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("DecodeEvent() of an unknown event returned %v, want %v", err, ErrUnknownEvent)
+	}
+}
@@ -0,0 +1,224 @@
+package starknet
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/NethermindEth/juno/internal/config"
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/NethermindEth/juno/internal/services"
+	"github.com/NethermindEth/juno/pkg/feeder"
+)
+
+// shutdownTimeout is the time given to the Synchronizer to stop its sync
+// loops once the node is asked to stop.
+const shutdownTimeout = 5 * time.Second
+
+// SynchronizerConfig holds the values needed to run a standalone
+// Synchronizer with RunNode.
+type SynchronizerConfig struct {
+	// DbPath is the directory of the MDBX environment.
+	DbPath string
+	// EthereumNode is the address of the layer 1 node. It's only used if
+	// ApiSync is false.
+	EthereumNode string
+	// LogChunkSize is the number of layer 1 blocks whose logs are
+	// requested at once. If it's not positive, config.DefaultLogChunkSize
+	// is used.
+	LogChunkSize int
+	// FeederGateway is the base URL of the feeder gateway.
+	FeederGateway string
+	// FallbackFeederGateways are the base URLs of the feeder gateways
+	// used, in order, when the current one keeps failing.
+	FallbackFeederGateways []string
+	// FailoverThreshold is the number of consecutive failed requests after
+	// which the next feeder gateway is used. If it's not positive,
+	// feeder.DefaultFailoverThreshold is used.
+	FailoverThreshold int
+	// Network is the name of the StarkNet network, "mainnet" or "goerli".
+	Network string
+	// ApiSync sets whether the state is synced against the feeder gateway
+	// instead of layer 1.
+	ApiSync bool
+	// DeepCheck sets whether the storage of each updated contract is
+	// checked against the feeder gateway when a state root mismatches.
+	DeepCheck bool
+	// EventBufferSize is the size of the buffer of the layer 1 log
+	// subscription. If it's not positive, defaultEventBufferSize is used.
+	EventBufferSize int
+	// EventQueueSize is the number of decoded layer 1 events that can wait
+	// to be processed before the log fetcher blocks. If it's not positive,
+	// defaultEventQueueSize is used.
+	EventQueueSize int
+	// CodeFetchLimit is the maximum number of concurrent requests made to
+	// the feeder gateway to fetch the code of the contracts deployed in a
+	// block. If it's not positive, defaultCodeFetchLimit is used.
+	CodeFetchLimit int
+	// MaxFeederRequests is the maximum number of requests to the feeder
+	// gateway in flight at once, shared by everything the node fetches.
+	// If it's not positive, the requests aren't limited.
+	MaxFeederRequests int
+	// StorageRootCacheSize is the maximum number of contract storage roots
+	// kept in memory. If it's not positive, defaultStorageRootCacheSize is
+	// used.
+	StorageRootCacheSize int
+	// SeparateStateDb sets whether the state tries are stored in their
+	// own STATE database instead of the SYNCHRONIZER one. The layout is
+	// recorded on the first run, and the sync fails with an
+	// ErrStateDbLayoutMismatch if the setting is changed afterwards.
+	SeparateStateDb bool
+	// NamespaceByChain sets whether the keys of the sync, state and service
+	// databases are prefixed with the namespace of the network, given by
+	// ChainNamespace for the chain the Synchronizer detects, so that
+	// several networks can share a database path. The namespace is set for
+	// the services when the Synchronizer is created, so they must be run
+	// after it. Existing nodes must keep the setting they were synced
+	// with.
+	NamespaceByChain bool
+	// StartBlock is the block the API sync starts from on a fresh
+	// database. If it's not 0, the state as of the block before it must
+	// have been imported into the state database.
+	StartBlock uint64
+	// PollInterval is the longest the API sync waits between polls of the
+	// feeder gateway once it is synced. The wait is shorter right after a
+	// new block and grows while none comes. If it's not positive,
+	// defaultPollInterval is used.
+	PollInterval time.Duration
+	// RestartOnPanic sets whether a sync goroutine that panics is started
+	// again after a backoff. Otherwise the panic stops the sync, which
+	// returns it as an error.
+	RestartOnPanic bool
+	// SkipVerifiedBlocks sets whether the layer 1 sync skips the memory
+	// pages of the blocks already applied to the local state with the root
+	// of their fact, such as the ones synced from the feeder gateway. The
+	// juno config and NewSynchronizer enable it by default, but the zero
+	// value doesn't, so it must be set explicitly.
+	SkipVerifiedBlocks bool
+	// CheckOldRoot sets whether the old root of each block is checked
+	// against the local state root before the block is applied. The juno
+	// config and NewSynchronizer enable it by default, but the zero value
+	// doesn't, so it must be set explicitly to keep the check.
+	CheckOldRoot bool
+	// BackfillSafeNoSync sets whether the commits of the database aren't
+	// flushed to disk one by one while the API sync catches up with the
+	// feeder gateway. They are flushed every BackfillSyncPeriod instead,
+	// and every commit is flushed again once the sync has caught up. A
+	// crash of the system during the backfill may lose the blocks not
+	// flushed yet, which are synced again.
+	BackfillSafeNoSync bool
+	// BackfillSyncPeriod is the longest the commits of the backfill go
+	// unflushed. If it's not positive, defaultBackfillSyncPeriod is used.
+	BackfillSyncPeriod time.Duration
+	// WarmStateTrie sets whether the top WarmStateTrieLevels levels of the
+	// state trie are read before the sync starts, so that the first block
+	// after a restart isn't slowed down by loading them from disk.
+	WarmStateTrie bool
+	// WarmStateTrieLevels is the number of levels of the state trie read
+	// on startup. If it's not positive, defaultWarmStateTrieLevels is used.
+	WarmStateTrieLevels int
+	// DiffRetention is the number of blocks whose applied state diff is
+	// kept in the state database, the older ones being removed as blocks
+	// are synced. If it's not positive, no state diff is kept.
+	DiffRetention int
+	// PrefetchStateTries sets whether, while the API sync catches up with
+	// the feeder gateway, the trie nodes a block updates are read
+	// concurrently before the block is applied, so that the transaction
+	// applying it doesn't wait for them to be loaded from disk one by one.
+	PrefetchStateTries bool
+}
+
+// Validate checks the settings that would otherwise only fail once the
+// sync has started, such as the URLs of the feeder gateways and of the
+// Ethereum node, and returns all the problems found in a
+// *config.ValidationError. The ABIs of the layer 1 contracts are embedded
+// in the binary, so there are no paths to check.
+func (cfg *SynchronizerConfig) Validate() error {
+	problems := config.ValidateSync(cfg.Network, append([]string{cfg.FeederGateway}, cfg.FallbackFeederGateways...),
+		cfg.ApiSync, cfg.EthereumNode)
+	if len(problems) > 0 {
+		return &config.ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// RunNode opens the database, starts the storage services and syncs the
+// StarkNet state until the context is done or the Synchronizer fails.
+// Before returning, the Synchronizer, the services and the database
+// environment are closed, so RunNode can be called again in the same
+// process. The configuration is validated before anything is opened.
+func RunNode(ctx context.Context, cfg SynchronizerConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := db.InitializeMDBXEnv(cfg.DbPath, 100, 0); err != nil {
+		return err
+	}
+	defer db.CloseMDBXEnv()
+	var ethereumClient *ethclient.Client
+	if !cfg.ApiSync {
+		// notest
+		var err error
+		ethereumClient, err = ethclient.Dial(cfg.EthereumNode)
+		if err != nil {
+			return err
+		}
+	}
+	feederClient := feeder.NewFailoverClient(
+		append([]string{cfg.FeederGateway}, cfg.FallbackFeederGateways...), "/feeder_gateway", nil)
+	feederClient.LimitRequests(cfg.MaxFeederRequests)
+	feederClient.SetFailoverThreshold(cfg.FailoverThreshold)
+
+	env, err := db.GetMDBXEnv()
+	if err != nil {
+		// notest
+		return err
+	}
+	synchronizerDb, err := db.NewMDBXDatabase(env, "SYNCHRONIZER")
+	if err != nil {
+		// notest
+		return err
+	}
+	var stateDb db.DatabaseTransactional
+	if cfg.SeparateStateDb {
+		stateDb, err = db.NewMDBXDatabase(env, "STATE")
+		if err != nil {
+			// notest
+			synchronizerDb.Close()
+			return err
+		}
+	}
+	synchronizer := newSynchronizer(synchronizerDb, stateDb, ethereumClient, feederClient, cfg)
+
+	// The services are run once the Synchronizer has set their namespace.
+	storageServices := services.NewStorageManager()
+	if err := storageServices.Run(); err != nil {
+		// notest
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		synchronizer.Close(shutdownCtx)
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		storageServices.Close(shutdownCtx)
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- synchronizer.UpdateState()
+	}()
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errCh:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	synchronizer.Close(shutdownCtx)
+	return err
+}
@@ -0,0 +1,104 @@
+package starknet
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/internal/config"
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/NethermindEth/juno/internal/services"
+)
+
+func TestRunNodeStopsOnContextCancel(t *testing.T) {
+	// The feeder gateway always answers with an empty state update, so the
+	// Synchronizer keeps waiting for a pending block until it's stopped.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- RunNode(ctx, SynchronizerConfig{
+			DbPath:        t.TempDir(),
+			FeederGateway: srv.URL,
+			Network:       "mainnet",
+			ApiSync:       true,
+		})
+	}()
+
+	time.Sleep(time.Second)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunNode returned an error: %v", err)
+		}
+	case <-time.After(2 * shutdownTimeout):
+		t.Fatal("RunNode did not return after the context was cancelled")
+	}
+}
+
+func TestRunNodeInvalidConfig(t *testing.T) {
+	dbPath := t.TempDir()
+	err := RunNode(context.Background(), SynchronizerConfig{
+		DbPath:        dbPath,
+		FeederGateway: "alpha-mainnet.starknet.io",
+		Network:       "mainnet",
+	})
+	if !errors.Is(err, config.ErrInvalidFeederGateway) || !errors.Is(err, config.ErrInvalidEthereumNode) {
+		t.Errorf("RunNode() = %v, want the feeder gateway and the Ethereum node rejected", err)
+	}
+	if entries, _ := os.ReadDir(dbPath); len(entries) != 0 {
+		t.Errorf("RunNode() opened the database before validating the config")
+	}
+}
+
+func TestRunNodeTwice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	for run := 0; run < 2; run++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- RunNode(ctx, SynchronizerConfig{
+				DbPath:        t.TempDir(),
+				FeederGateway: srv.URL,
+				Network:       "mainnet",
+				ApiSync:       true,
+			})
+		}()
+		time.Sleep(time.Second)
+
+		// The services run on the database of this run, not on the closed
+		// one of the previous run.
+		services.ContractHashService.StoreContractHash("1", big.NewInt(int64(run+1)))
+		if hash := services.ContractHashService.GetContractHash("1"); hash == nil || hash.Int64() != int64(run+1) {
+			t.Errorf("run %d: contract hash = %v, want %d", run, hash, run+1)
+		}
+		cancel()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("run %d: RunNode returned an error: %v", run, err)
+			}
+		case <-time.After(2 * shutdownTimeout):
+			t.Fatalf("run %d: RunNode did not return after the context was cancelled", run)
+		}
+		if _, err := db.GetMDBXEnv(); !errors.Is(err, db.ErrEnvNoInitialized) {
+			t.Errorf("run %d: the database environment is open after RunNode returned", run)
+		}
+	}
+}
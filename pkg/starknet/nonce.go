@@ -0,0 +1,66 @@
+package starknet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/NethermindEth/juno/internal/services"
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+)
+
+// ErrUnknownNonce is returned by GetNonce when the state leaf of a
+// contract doesn't commit to a nonce of 0.
+var ErrUnknownNonce = errors.New("the state leaf commits to an unknown nonce")
+
+// GetNonce returns the nonce of the contract at the given address in the
+// committed state. The nonces in the state diffs aren't applied yet, so
+// the state leaves built by this node commit to a nonce of 0, and the
+// nonce of a deployed contract is 0 once its leaf is checked against its
+// class hash and storage root. A leaf that doesn't match gives
+// ErrUnknownNonce. A contract that isn't deployed has a nonce of 0.
+func (s *Synchronizer) GetNonce(address string) (*localTypes.Felt, error) {
+	contract, err := localTypes.FeltFromHex(address)
+	if err != nil {
+		return nil, fmt.Errorf("contract address: %w", err)
+	}
+	formattedAddress := remove0x(contract.Hex())
+	// The contract hash database can't be read inside the transaction on
+	// the state database.
+	contractHash := services.ContractHashService.GetContractHash(formattedAddress)
+
+	// RunTxn doesn't wrap the error of the transaction, so it's kept to be
+	// returned as is and the mismatch can be told apart.
+	var txnErr error
+	err = s.stateDatabase.RunTxn(func(txn db.DatabaseOperations) (err error) {
+		defer func() { txnErr = err }()
+		stateTrie := newTrie(txn, "state_trie_")
+		leaf, ok := stateTrie.Get(contract.Big())
+		if err := stateTrie.Err(); err != nil {
+			return fmt.Errorf("state trie: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+		if contractHash == nil {
+			// notest
+			return fmt.Errorf("unknown class hash of contract %s", contract.Hex())
+		}
+		storageTrie := newTrie(txn, formattedAddress)
+		storageRoot := storageTrie.Commitment()
+		if err := storageTrie.Err(); err != nil {
+			return fmt.Errorf("storage of contract %s: %w", contract.Hex(), err)
+		}
+		if contractState(contractHash, storageRoot).Cmp(leaf) != 0 {
+			return fmt.Errorf("%w: contract %s", ErrUnknownNonce, contract.Hex())
+		}
+		return nil
+	})
+	if err != nil {
+		if txnErr != nil {
+			err = txnErr
+		}
+		return nil, err
+	}
+	return new(localTypes.Felt), nil
+}
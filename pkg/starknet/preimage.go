@@ -0,0 +1,93 @@
+package starknet
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/NethermindEth/juno/internal/db"
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+)
+
+// contractStatePrefix is the prefix of the keys of the preimages of the
+// contract leaves in the state database. The preimage of a contract is
+// stored under the prefix followed by its address in hexadecimal without
+// 0x.
+const contractStatePrefix = "contract_state_"
+
+// contractStatePreimage is the preimage of the leaf of a contract in the
+// state trie, h(h(h(ClassHash, StorageRoot), Nonce), 0). The nonces in
+// the state diffs aren't applied yet, so Nonce is always 0.
+type contractStatePreimage struct {
+	ClassHash   localTypes.Felt
+	StorageRoot localTypes.Felt
+	Nonce       localTypes.Felt
+}
+
+func contractStateKey(address *big.Int) []byte {
+	return []byte(contractStatePrefix + remove0x(localTypes.BigToFelt(address).Hex()))
+}
+
+// putContractState stores the leaf of the contract at the given address
+// in the state trie, along with its preimage, so that a proof of the
+// contract can give the class hash and storage root its leaf commits to.
+func putContractState(txn db.DatabaseOperations, stateTrie Trie, address, classHash, storageRoot *big.Int) error {
+	stateTrie.Put(address, contractState(classHash, storageRoot))
+	preimage := contractStatePreimage{
+		ClassHash:   localTypes.BigToFelt(classHash),
+		StorageRoot: localTypes.BigToFelt(storageRoot),
+	}
+	return putContractStatePreimage(txn, address, &preimage)
+}
+
+// putContractStatePreimage stores the preimage of the leaf of the
+// contract at the given address.
+func putContractStatePreimage(database db.DatabaseOperations, address *big.Int, preimage *contractStatePreimage) error {
+	value := make([]byte, 0, 3*localTypes.FeltLength)
+	value = append(value, preimage.ClassHash.Bytes()...)
+	value = append(value, preimage.StorageRoot.Bytes()...)
+	value = append(value, preimage.Nonce.Bytes()...)
+	if err := database.Put(contractStateKey(address), value); err != nil {
+		// notest
+		return fmt.Errorf("couldn't store the state preimage of contract %x: %w", address, err)
+	}
+	return nil
+}
+
+// deleteContractState removes the contract at the given address from the
+// state trie, along with the preimage of its leaf.
+func deleteContractState(txn db.DatabaseOperations, stateTrie Trie, address *big.Int) error {
+	stateTrie.Delete(address)
+	key := contractStateKey(address)
+	// Deleting a missing key is an error.
+	has, err := txn.Has(key)
+	if err == nil && has {
+		err = txn.Delete(key)
+	}
+	if err != nil {
+		// notest
+		return fmt.Errorf("couldn't delete the state preimage of contract %x: %w", address, err)
+	}
+	return nil
+}
+
+// getContractStatePreimage returns the preimage of the leaf of the
+// contract at the given address, or nil if none is stored, as for the
+// contracts whose leaf was last written before the preimages were.
+func getContractStatePreimage(txn db.DatabaseOperations, address *big.Int) (*contractStatePreimage, error) {
+	value, err := txn.Get(contractStateKey(address))
+	if db.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		// notest
+		return nil, err
+	}
+	if len(value) != 3*localTypes.FeltLength {
+		return nil, fmt.Errorf("state preimage of contract %x has %d bytes, want %d", address, len(value), 3*localTypes.FeltLength)
+	}
+	return &contractStatePreimage{
+		ClassHash:   localTypes.BytesToFelt(value[:localTypes.FeltLength]),
+		StorageRoot: localTypes.BytesToFelt(value[localTypes.FeltLength : 2*localTypes.FeltLength]),
+		Nonce:       localTypes.BytesToFelt(value[2*localTypes.FeltLength:]),
+	}, nil
+}
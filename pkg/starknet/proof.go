@@ -0,0 +1,93 @@
+package starknet
+
+import (
+	"fmt"
+
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/NethermindEth/juno/internal/services"
+	"github.com/NethermindEth/juno/pkg/trie"
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+)
+
+// StateProof proves the value of a storage slot of a contract, or that
+// the contract isn't deployed, against the local state root.
+type StateProof struct {
+	StateRoot localTypes.Felt
+	// ContractProof is the proof of the contract address in the state
+	// trie.
+	ContractProof []trie.ProofNode
+	// ContractData is nil if the contract isn't deployed.
+	ContractData *ContractData
+}
+
+// ContractData is the preimage of the leaf of a contract in the state
+// trie, h(h(h(ClassHash, StorageRoot), Nonce), 0), along with the proof
+// of a storage slot in the storage trie, whose root is StorageRoot.
+type ContractData struct {
+	ClassHash    localTypes.Felt
+	StorageRoot  localTypes.Felt
+	Nonce        localTypes.Felt
+	StorageProof []trie.ProofNode
+}
+
+// GetProof returns the proof of the storage slot key of the contract at
+// the given address in the local state. The proofs are checked with
+// trie.VerifyProof, with a key length of 251 bits: ContractProof against
+// StateRoot gives the leaf of the contract, which must be the contract
+// state of ContractData, and StorageProof against its StorageRoot gives
+// the value of the slot.
+func (s *Synchronizer) GetProof(contract string, key *localTypes.Felt) (*StateProof, error) {
+	address, err := localTypes.FeltFromHex(contract)
+	if err != nil {
+		return nil, fmt.Errorf("contract address: %w", err)
+	}
+	formattedAddress := remove0x(address.Hex())
+	// The contract hash database can't be read inside the transaction on
+	// the state database.
+	contractHash := services.ContractHashService.GetContractHash(formattedAddress)
+
+	proof := new(StateProof)
+	err = s.stateDatabase.RunTxn(func(txn db.DatabaseOperations) error {
+		stateTrie := newTrie(txn, "state_trie_")
+		proof.StateRoot = localTypes.BigToFelt(stateTrie.Commitment())
+		proof.ContractProof = stateTrie.Prove(address.Big())
+		_, ok := stateTrie.Get(address.Big())
+		if err := stateTrie.Err(); err != nil {
+			return fmt.Errorf("state trie: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+		storageTrie := newTrie(txn, formattedAddress)
+		preimage, err := getContractStatePreimage(txn, address.Big())
+		if err != nil {
+			// notest
+			return err
+		}
+		if preimage == nil {
+			// The leaf was written before the preimages were stored.
+			if contractHash == nil {
+				// notest
+				return fmt.Errorf("unknown class hash of contract %s", address.Hex())
+			}
+			preimage = &contractStatePreimage{
+				ClassHash:   localTypes.BigToFelt(contractHash),
+				StorageRoot: localTypes.BigToFelt(storageTrie.Commitment()),
+			}
+		}
+		proof.ContractData = &ContractData{
+			ClassHash:    preimage.ClassHash,
+			StorageRoot:  preimage.StorageRoot,
+			Nonce:        preimage.Nonce,
+			StorageProof: storageTrie.Prove(key.Big()),
+		}
+		if err := storageTrie.Err(); err != nil {
+			return fmt.Errorf("storage of contract %s: %w", address.Hex(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
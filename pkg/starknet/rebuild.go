@@ -0,0 +1,126 @@
+package starknet
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/NethermindEth/juno/internal/log"
+	"github.com/NethermindEth/juno/internal/services"
+	starknetTypes "github.com/NethermindEth/juno/pkg/starknet/types"
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// rebuildBatchSize is the number of contracts whose code is fetched
+// together by RebuildIndexes.
+const rebuildBatchSize = 100
+
+// RebuildIndexes fills the services from a state imported as trie nodes,
+// such as a trie snapshot, so that the node can serve queries about it
+// without replaying the blocks. fromRoot must be the root of the local
+// state trie. For every contract in the state trie, the class hash is
+// fetched from the feeder gateway and checked against the contract leaf,
+// then stored in the ContractHashService, as of the block of the state,
+// along with the preimage of the leaf, and the contract is recorded
+// as deployed in the StateService along with its code and ABI. The block
+// of the imported state is stored in the BlockService; the blocks before
+// it can't be derived from the state and aren't stored.
+//
+// The block of the imported state is the one of the latest state root if
+// it has been recorded, or the one before the configured start block.
+func (s *Synchronizer) RebuildIndexes(fromRoot *localTypes.Felt) error {
+	stateTrie := newTrie(s.stateDatabase, "state_trie_")
+	root := localTypes.BigToFelt(stateTrie.Commitment())
+	if err := stateTrie.Err(); err != nil {
+		return fmt.Errorf("state trie: %w", err)
+	}
+	if root != *fromRoot {
+		return fmt.Errorf("local state root is %s, want %s", root.Hex(), fromRoot.Hex())
+	}
+	blockNumber, err := s.importedBlock(fromRoot)
+	if err != nil {
+		return err
+	}
+	number := strconv.FormatUint(blockNumber, 10)
+
+	var batch []starknetTypes.DeployedContract
+	storeCodes := func() error {
+		codes, err := s.fetchCodes(batch, "", number)
+		if err != nil {
+			return fmt.Errorf("couldn't get the code of the contracts: %w", err)
+		}
+		for i, contract := range batch {
+			services.AbiService.StoreAbi(remove0x(contract.Address), toDbAbi(codes[i].Abi))
+			services.StateService.StoreCode(common.Hex2Bytes(remove0x(contract.Address)), byteCodeToStateCode(codes[i].Bytecode))
+		}
+		batch = batch[:0]
+		return nil
+	}
+	contracts := 0
+	err = stateTrie.Iterate(func(key, leaf *big.Int) error {
+		address := localTypes.BigToFelt(key)
+		hex, err := s.feederGatewayClient.GetClassHashAt(address.Hex(), "", number)
+		if err != nil {
+			return fmt.Errorf("couldn't get the class hash of contract %s: %w", address.Hex(), err)
+		}
+		classHash, err := localTypes.FeltFromHex(hex)
+		if err != nil {
+			return fmt.Errorf("class hash of contract %s: %w", address.Hex(), err)
+		}
+		storageRoot := newTrie(s.stateDatabase, remove0x(address.Hex())).Commitment()
+		if contractState(classHash.Big(), storageRoot).Cmp(leaf) != 0 {
+			return fmt.Errorf("class hash %s of contract %s doesn't match the state trie", classHash.Hex(), address.Hex())
+		}
+		preimage := contractStatePreimage{ClassHash: classHash, StorageRoot: localTypes.BigToFelt(storageRoot)}
+		if err := putContractStatePreimage(s.stateDatabase, key, &preimage); err != nil {
+			return err
+		}
+		services.ContractHashService.StoreContractHash(remove0x(address.Hex()), classHash.Big())
+		services.ContractHashService.StoreContractHashAt(remove0x(address.Hex()), blockNumber, classHash.Big())
+		services.StateService.StoreDeployedContract(address.Hex(), blockNumber)
+		batch = append(batch, starknetTypes.DeployedContract{Address: address.Hex(), ContractHash: classHash.Hex()})
+		contracts++
+		if len(batch) == rebuildBatchSize {
+			return storeCodes()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		if err := storeCodes(); err != nil {
+			return err
+		}
+	}
+
+	block, err := s.feederGatewayClient.GetBlock("", number)
+	if err != nil {
+		return fmt.Errorf("couldn't get block %d: %w", blockNumber, err)
+	}
+	services.BlockService.StoreBlock(localTypes.BlockHash(localTypes.HexToFelt(block.BlockHash)), feederBlockToDBBlock(block))
+	log.Default.With("Block Number", blockNumber, "State Root", fromRoot.Hex(), "Contracts", contracts).
+		Info("Rebuilt the indexes of the imported state")
+	return nil
+}
+
+// importedBlock returns the number of the block whose state has the
+// given root and was imported.
+func (s *Synchronizer) importedBlock(root *localTypes.Felt) (uint64, error) {
+	latestRoot, blockNumber, err := s.LatestStateRoot()
+	switch {
+	case err == nil && *latestRoot == *root:
+		return blockNumber, nil
+	case err == nil:
+		return 0, fmt.Errorf("latest state root %s of block %d isn't %s", latestRoot.Hex(), blockNumber, root.Hex())
+	case errors.Is(err, ErrNoStateRoot) && s.startBlock > 0:
+		return s.startBlock - 1, nil
+	case errors.Is(err, ErrNoStateRoot):
+		return 0, errors.New("the block of the imported state is unknown: no state root recorded and no start block")
+	default:
+		// notest
+		return 0, err
+	}
+}
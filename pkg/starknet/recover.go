@@ -0,0 +1,98 @@
+package starknet
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/NethermindEth/juno/internal/log"
+)
+
+// minRestartDelay is how long a sync goroutine that panicked waits before
+// its first restart. The delay doubles with every panic up to
+// maxRestartDelay.
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+)
+
+// recovered converts the value r recovered from a panic of the goroutine
+// called name into an error, which is logged with the stack and recorded
+// as the failure of the Synchronizer.
+func (s *Synchronizer) recovered(name string, r any) error {
+	err := fmt.Errorf("%s panicked: %v", name, r)
+	log.Default.With("Error", err, "Stack", string(debug.Stack())).Error("Sync goroutine panicked")
+	s.failureMu.Lock()
+	s.failure = err
+	s.failureMu.Unlock()
+	return err
+}
+
+// stopWithError records err, returned by the goroutine called name, as
+// the failure of the Synchronizer and stops the sync, so that UpdateState
+// returns it. An error caused by closing the Synchronizer isn't a
+// failure and is ignored.
+func (s *Synchronizer) stopWithError(name string, err error) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	err = fmt.Errorf("%s: %w", name, err)
+	log.Default.With("Error", err).Error("Stopping the sync")
+	s.failureMu.Lock()
+	s.failure = err
+	s.failureMu.Unlock()
+	s.cancel()
+}
+
+// lastFailure returns the error of the last panic recovered in the sync
+// goroutines or of the last goroutine stopped with an error, or nil if
+// there was none.
+func (s *Synchronizer) lastFailure() error {
+	s.failureMu.Lock()
+	defer s.failureMu.Unlock()
+	return s.failure
+}
+
+// runRecovered runs fn and recovers a panic in it. It returns whether fn
+// panicked.
+func (s *Synchronizer) runRecovered(name string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.recovered(name, r)
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// goRecovered runs fn in a new goroutine called name, converting a panic
+// in it into a failure of the Synchronizer instead of crashing the
+// process. If restarts are enabled, fn is run again after a backoff until
+// it returns without panicking or the Synchronizer is closed; otherwise
+// the sync is stopped and UpdateState returns the failure. The goroutine
+// is tracked by the wait group of the Synchronizer, so Close waits for it.
+// Note that log.Fatal exits the process and can't be recovered.
+func (s *Synchronizer) goRecovered(name string, fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		delay := minRestartDelay
+		for s.runRecovered(name, fn) {
+			if !s.restartOnPanic {
+				s.cancel()
+				return
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			log.Default.With("Goroutine", name).Info("Restarting sync goroutine after a panic")
+			delay *= 2
+			if delay > maxRestartDelay {
+				delay = maxRestartDelay
+			}
+		}
+	}()
+}
@@ -0,0 +1,173 @@
+package starknet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/NethermindEth/juno/internal/db"
+	"github.com/NethermindEth/juno/internal/services"
+	starknetTypes "github.com/NethermindEth/juno/pkg/starknet/types"
+	localTypes "github.com/NethermindEth/juno/pkg/types"
+)
+
+// ErrBlockNotReplayable is returned by DebugReplayBlock for a block other
+// than the next one to sync. Only the latest state is stored, so a block
+// can only be replayed on top of it.
+var ErrBlockNotReplayable = errors.New("only the next block to sync can be replayed")
+
+// errDryRun aborts the transaction a block is replayed in.
+var errDryRun = errors.New("dry run")
+
+// BlockReplayReport is the result of replaying a block with
+// DebugReplayBlock. Roots and values are hex strings.
+type BlockReplayReport struct {
+	BlockNumber uint64
+	// OldRoot is the root of the local state the block is applied on.
+	OldRoot string
+	// ExpectedRoot is the new root of the block given by the feeder
+	// gateway and ComputedRoot is the one of the local state after the
+	// block is applied.
+	ExpectedRoot string
+	ComputedRoot string
+	// Contracts are the contracts whose storage is updated by the block,
+	// in the order of the state diff.
+	Contracts []ContractReplay
+}
+
+// ContractReplay is the storage of a contract before and after a block
+// is replayed. The feeder gateway doesn't expose storage roots, so only
+// the local ones are reported.
+type ContractReplay struct {
+	Address        string
+	OldStorageRoot string
+	NewStorageRoot string
+	Slots          []SlotReplay
+}
+
+// SlotReplay is the value of a storage slot before and after a block is
+// replayed.
+type SlotReplay struct {
+	Key    string
+	Before string
+	After  string
+}
+
+// DebugReplayBlock applies the state diff of block n, fetched from the
+// feeder gateway, to the local state without committing it, and reports
+// the state root it computes against the expected one, along with the
+// storage roots and slots of the updated contracts before and after the
+// block. Since only the latest state is stored, n must be the next block
+// to sync; otherwise ErrBlockNotReplayable is returned. Nothing is
+// written to the database or to the storage root cache.
+func (s *Synchronizer) DebugReplayBlock(n uint64) (*BlockReplayReport, error) {
+	next, err := getNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced)
+	if err != nil {
+		// notest
+		return nil, err
+	}
+	if n != next {
+		return nil, fmt.Errorf("%w: block %d requested, next block is %d", ErrBlockNotReplayable, n, next)
+	}
+	update, _, err := s.getStateUpdate(n)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the state update of block %d: %w", n, err)
+	}
+	if update.NewRoot == "" {
+		return nil, fmt.Errorf("block %d is pending", n)
+	}
+	stateDiff, err := stateUpdateResponseToStateDiff(*update)
+	if err != nil {
+		return nil, fmt.Errorf("state update of block %d: %w", n, err)
+	}
+
+	// The contracts deployed in the block aren't in the contract hash
+	// service yet and must not be stored there by a dry run.
+	deployed := make(map[string]*big.Int)
+	for _, contract := range stateDiff.DeployedContracts {
+		hash, err := localTypes.FeltFromHex(contract.ContractHash)
+		if err != nil {
+			return nil, fmt.Errorf("contract hash of deployed contract %s: %w", contract.Address, err)
+		}
+		deployed[remove0x(localTypes.HexToFelt(contract.Address).Hex())] = hash.Big()
+	}
+	contractHashMap := make(map[string]*big.Int)
+	stateDiff.StorageDiffs.Range(func(address localTypes.Felt, _ []starknetTypes.KV) bool {
+		formattedAddress := remove0x(address.Hex())
+		if hash, ok := deployed[formattedAddress]; ok {
+			contractHashMap[formattedAddress] = hash
+		} else {
+			contractHashMap[formattedAddress] = services.ContractHashService.GetContractHash(formattedAddress)
+		}
+		return true
+	})
+
+	report := &BlockReplayReport{BlockNumber: n, ExpectedRoot: update.NewRoot}
+	replayed := false
+	err = s.stateDatabase.RunTxn(func(txn db.DatabaseOperations) error {
+		stateTrie := newTrie(txn, "state_trie_")
+		report.OldRoot = localTypes.BigToFelt(stateTrie.Commitment()).Hex()
+		if err := stateTrie.Err(); err != nil {
+			return fmt.Errorf("state trie: %w", err)
+		}
+		contracts, err := replayContracts(txn, &stateDiff, nil)
+		if err != nil {
+			return err
+		}
+		report.Contracts = contracts
+		root, err := updateState(context.Background(), txn, contractHashMap, nil, &stateDiff, "", n)
+		if err != nil {
+			return err
+		}
+		report.ComputedRoot = localTypes.HexToFelt(root).Hex()
+		report.Contracts, err = replayContracts(txn, &stateDiff, report.Contracts)
+		if err != nil {
+			return err
+		}
+		replayed = true
+		return errDryRun
+	})
+	if !replayed {
+		return nil, err
+	}
+	return report, nil
+}
+
+// replayContracts reads the storage root and the updated slots of the
+// contracts in stateDiff. If before is nil, it returns them as the state
+// before the block; otherwise, it fills in the state after the block. An
+// error is returned if a storage trie can't be read.
+func replayContracts(txn db.DatabaseOperations, stateDiff *starknetTypes.StateDiff, before []ContractReplay) ([]ContractReplay, error) {
+	contracts := before
+	i := 0
+	var err error
+	stateDiff.StorageDiffs.Range(func(address localTypes.Felt, kvs []starknetTypes.KV) bool {
+		storageTrie := newTrie(txn, remove0x(address.Hex()))
+		root := localTypes.BigToFelt(storageTrie.Commitment()).Hex()
+		if before == nil {
+			contracts = append(contracts, ContractReplay{Address: address.Hex(), OldStorageRoot: root})
+		} else {
+			contracts[i].NewStorageRoot = root
+		}
+		for j, kv := range kvs {
+			value, ok := storageTrie.Get(localTypes.HexToFelt(kv.Key).Big())
+			if !ok {
+				value = new(big.Int)
+			}
+			hex := localTypes.BigToFelt(value).Hex()
+			if before == nil {
+				contracts[i].Slots = append(contracts[i].Slots, SlotReplay{Key: kv.Key, Before: hex})
+			} else {
+				contracts[i].Slots[j].After = hex
+			}
+		}
+		if err = storageTrie.Err(); err != nil {
+			err = fmt.Errorf("storage of contract %s: %w", address.Hex(), err)
+			return false
+		}
+		i++
+		return true
+	})
+	return contracts, err
+}
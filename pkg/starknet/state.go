@@ -4,10 +4,14 @@ package starknet
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/NethermindEth/juno/internal/config"
@@ -18,6 +22,7 @@ import (
 	"github.com/NethermindEth/juno/pkg/feeder"
 	"github.com/NethermindEth/juno/pkg/starknet/abi"
 	starknetTypes "github.com/NethermindEth/juno/pkg/starknet/types"
+	"github.com/NethermindEth/juno/pkg/trie"
 	localTypes "github.com/NethermindEth/juno/pkg/types"
 	"github.com/ethereum/go-ethereum"
 	ethAbi "github.com/ethereum/go-ethereum/accounts/abi"
@@ -27,6 +32,77 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+// defaultEventBufferSize is the size of the buffer of the layer 1 log
+// subscription when none is configured.
+const defaultEventBufferSize = 256
+
+// defaultEventQueueSize is the number of layer 1 events that can wait to
+// be processed when none is configured.
+const defaultEventQueueSize = 256
+
+// The layer 1 chain ids of the networks the Synchronizer knows.
+const (
+	mainnetChainID = 1
+	goerliChainID  = 5
+)
+
+// defaultStorageRootCacheSize is the number of contract storage roots
+// kept in memory when none is configured.
+const defaultStorageRootCacheSize = 100000
+
+// maxCombinedStateUpdateErrors is the number of consecutive failures of
+// the combined state update and block endpoint after which it's given up.
+const maxCombinedStateUpdateErrors = 3
+
+// blockBatchSize is the number of blocks the API sync stores in one
+// transaction while it backfills.
+const blockBatchSize = 32
+
+// defaultCodeFetchLimit is the maximum number of concurrent code requests
+// made for a block when none is configured.
+const defaultCodeFetchLimit = 8
+
+// defaultPollInterval is the longest the API sync waits between polls of
+// the feeder gateway once it is synced when none is configured.
+const defaultPollInterval = 15 * time.Second
+
+// defaultBackfillSyncPeriod is the longest the commits of the backfill go
+// unflushed when no period is configured.
+const defaultBackfillSyncPeriod = 30 * time.Second
+
+// defaultWarmStateTrieLevels is the number of levels of the state trie
+// read on startup when none is configured.
+const defaultWarmStateTrieLevels = 16
+
+// minPollInterval is how long the API sync waits before polling the
+// feeder gateway again right after a new block.
+const minPollInterval = time.Second
+
+// logRetryDelay is how long the layer 1 backfill waits before retrying a
+// failed log request.
+const logRetryDelay = 5 * time.Second
+
+// contractAddressesAttempts is how many times the layer 1 sync asks the
+// feeder gateway for the contract addresses before giving up. The wait
+// between attempts starts at minRestartDelay and doubles up to
+// maxRestartDelay.
+const contractAddressesAttempts = 6
+
+// ErrReorg is returned when a block fetched from the feeder gateway does
+// not build on top of the local state, which means the chain has been
+// reorganised. If the parent block hash differs, ExpectedParent and
+// GotParent are block hashes; otherwise, they are the state roots the
+// block is applied on.
+type ErrReorg struct {
+	AtBlock        uint64
+	ExpectedParent string
+	GotParent      string
+}
+
+func (e *ErrReorg) Error() string {
+	return fmt.Sprintf("reorg at block %d: expected parent %s, got %s", e.AtBlock, e.ExpectedParent, e.GotParent)
+}
+
 // Synchronizer represents the base struct for Starknet Synchronization
 type Synchronizer struct {
 	ethereumClient      *ethclient.Client
@@ -35,19 +111,136 @@ type Synchronizer struct {
 	memoryPageHash      *starknetTypes.Dictionary
 	gpsVerifier         *starknetTypes.Dictionary
 	facts               *starknetTypes.Dictionary
+	processedFacts      *starknetTypes.Dictionary
 	chainID             int64
+	apiSync             bool
+	// l1Transactions maps the number of each block synced from layer 1 to
+	// the layer 1 transactions that registered its memory pages.
+	l1Transactions *starknetTypes.Dictionary
+	// stateDatabase holds the state and storage tries and the latest state
+	// root. It may be the same database as database.
+	stateDatabase db.DatabaseTransactional
+	// deepCheck enables the per-contract storage check when the state
+	// root of a block does not match the one provided.
+	deepCheck bool
+	// eventBufferSize is the size of the buffer of the layer 1 log
+	// subscription.
+	eventBufferSize int
+	// eventQueueSize is the number of decoded layer 1 events that can wait
+	// to be processed.
+	eventQueueSize int
+	// startBlock is the block the API sync starts from on a fresh
+	// database.
+	startBlock uint64
+	// codeFetchLimit is the maximum number of concurrent code requests
+	// made to the feeder gateway for a block.
+	codeFetchLimit int
+	// logChunkSize is the number of layer 1 blocks whose logs are
+	// requested at once.
+	logChunkSize int
+	// pollInterval is the longest the API sync waits between polls of the
+	// feeder gateway once it is synced.
+	pollInterval time.Duration
+	// restartOnPanic sets whether a sync goroutine that panics is started
+	// again, and failure is the error of the last panic recovered, guarded
+	// by failureMu.
+	restartOnPanic bool
+	failureMu      sync.Mutex
+	failure        error
+	// skipVerifiedBlocks sets whether the layer 1 sync skips the memory
+	// pages of the blocks already in the local state.
+	skipVerifiedBlocks bool
+	// verifyOldRoot enables the check of the old root of each block
+	// against the local state root before the block is applied.
+	verifyOldRoot bool
+	// backfillSafeNoSync sets whether the commits of the database
+	// environment are flushed every backfillSyncPeriod instead of one by
+	// one until the API sync catches up, and noSync is whether they
+	// currently are.
+	backfillSafeNoSync bool
+	backfillSyncPeriod time.Duration
+	noSync             bool
+	// warmStateTrie sets whether the top warmStateTrieLevels levels of the
+	// state trie are read before the sync starts.
+	warmStateTrie       bool
+	warmStateTrieLevels int
+	// diffRetention is the number of blocks whose state diff is kept.
+	diffRetention int
+	// prefetchStateTries sets whether the trie nodes a block updates are
+	// read before it is applied while backfilling, which is whether the
+	// API sync is catching up with the feeder gateway.
+	prefetchStateTries bool
+	backfilling        bool
+	// noCombinedStateUpdate is set, atomically, once the combined state
+	// update and block endpoint answered without a block that exists or
+	// failed maxCombinedStateUpdateErrors times in a row, so that it isn't
+	// tried again. combinedStateUpdateErrors counts those failures.
+	noCombinedStateUpdate     int32
+	combinedStateUpdateErrors int32
+	// storageRoots caches the storage roots of the contracts updated by
+	// previous blocks.
+	storageRoots *storageRootCache
+	// blocks holds the blocks fetched during the backfill that aren't
+	// stored yet, while batchBlocks is set, so that they are stored
+	// blockBatchSize at a time. Both are guarded by blocksMu.
+	blocksMu    sync.Mutex
+	blocks      []*localTypes.Block
+	batchBlocks bool
+	// ctx is cancelled when the Synchronizer is closed to stop the sync
+	// loops and the block being applied, and wg tracks the loops that are
+	// still running.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSynchronizer creates a new Synchronizer. The state tries are stored
+// in stateDb; if it's nil, they are stored in txnDb along with the rest of
+// the sync data.
+func NewSynchronizer(
+	txnDb db.DatabaseTransactional,
+	stateDb db.DatabaseTransactional,
+	client *ethclient.Client,
+	fClient *feeder.Client,
+) *Synchronizer {
+	cfg := SynchronizerConfig{CheckOldRoot: true, SkipVerifiedBlocks: true}
+	if config.Runtime != nil {
+		cfg.Network = config.Runtime.Starknet.Network
+		cfg.ApiSync = config.Runtime.Starknet.ApiSync
+		cfg.DeepCheck = config.Runtime.Starknet.DeepCheck
+		cfg.LogChunkSize = config.Runtime.Ethereum.LogChunkSize
+		cfg.EventBufferSize = config.Runtime.Starknet.EventBufferSize
+		cfg.EventQueueSize = config.Runtime.Starknet.EventQueueSize
+		cfg.CodeFetchLimit = config.Runtime.Starknet.CodeFetchLimit
+		cfg.StorageRootCacheSize = config.Runtime.Starknet.StorageRootCacheSize
+		cfg.NamespaceByChain = config.Runtime.Starknet.NamespaceByChain
+		cfg.StartBlock = config.Runtime.Starknet.StartBlock
+		cfg.CheckOldRoot = config.Runtime.Starknet.CheckOldRoot
+		cfg.PollInterval = time.Duration(config.Runtime.Starknet.PollInterval) * time.Second
+		cfg.RestartOnPanic = config.Runtime.Starknet.RestartOnPanic
+		cfg.SkipVerifiedBlocks = config.Runtime.Starknet.SkipVerifiedBlocks
+		cfg.BackfillSafeNoSync = config.Runtime.Starknet.BackfillSafeNoSync
+		cfg.BackfillSyncPeriod = time.Duration(config.Runtime.Starknet.BackfillSyncPeriod) * time.Second
+		cfg.WarmStateTrie = config.Runtime.Starknet.WarmStateTrie
+		cfg.WarmStateTrieLevels = config.Runtime.Starknet.WarmStateTrieLevels
+		cfg.DiffRetention = config.Runtime.Starknet.DiffRetention
+		cfg.PrefetchStateTries = config.Runtime.Starknet.PrefetchStateTries
+	}
+	return newSynchronizer(txnDb, stateDb, client, fClient, cfg)
 }
 
-// NewSynchronizer creates a new Synchronizer
-func NewSynchronizer(txnDb db.DatabaseTransactional, client *ethclient.Client, fClient *feeder.Client) *Synchronizer {
+// newSynchronizer creates a new Synchronizer for the network, sync mode
+// and checks set in cfg.
+func newSynchronizer(
+	txnDb db.DatabaseTransactional,
+	stateDb db.DatabaseTransactional,
+	client *ethclient.Client,
+	fClient *feeder.Client,
+	cfg SynchronizerConfig,
+) *Synchronizer {
 	var chainID *big.Int
 	if client == nil {
-		// notest
-		if config.Runtime.Starknet.Network == "mainnet" {
-			chainID = new(big.Int).SetInt64(1)
-		} else {
-			chainID = new(big.Int).SetInt64(0)
-		}
+		chainID = new(big.Int).SetInt64(FeederChainID(fClient, cfg.Network))
 	} else {
 		var err error
 		chainID, err = client.ChainID(context.Background())
@@ -56,31 +249,164 @@ func NewSynchronizer(txnDb db.DatabaseTransactional, client *ethclient.Client, f
 			log.Default.Panic("Unable to retrieve chain ID from Ethereum Node")
 		}
 	}
+	if cfg.NamespaceByChain {
+		// The namespace is the one of the chain actually synced, which
+		// the services must use as well.
+		namespace := ChainNamespace(chainID.Int64())
+		services.SetNamespace(namespace)
+		if stateDb != nil {
+			stateDb = db.NewNamespacedDatabase(stateDb, namespace)
+		}
+		txnDb = db.NewNamespacedDatabase(txnDb, namespace)
+	}
+	if stateDb == nil {
+		stateDb = txnDb
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Synchronizer{
 		ethereumClient:      client,
 		feederGatewayClient: fClient,
 		database:            txnDb,
+		stateDatabase:       stateDb,
 		memoryPageHash:      starknetTypes.NewDictionary(txnDb, "memory_pages"),
+		l1Transactions:      starknetTypes.NewDictionary(txnDb, "l1_transactions"),
 		gpsVerifier:         starknetTypes.NewDictionary(txnDb, "gps_verifier"),
 		facts:               starknetTypes.NewDictionary(txnDb, "facts"),
+		processedFacts:      starknetTypes.NewDictionary(txnDb, "processed_facts"),
 		chainID:             chainID.Int64(),
+		apiSync:             cfg.ApiSync,
+		deepCheck:           cfg.DeepCheck,
+		eventBufferSize:     cfg.EventBufferSize,
+		eventQueueSize:      cfg.EventQueueSize,
+		codeFetchLimit:      cfg.CodeFetchLimit,
+		logChunkSize:        cfg.LogChunkSize,
+		startBlock:          cfg.StartBlock,
+		verifyOldRoot:       cfg.CheckOldRoot,
+		pollInterval:        cfg.PollInterval,
+		restartOnPanic:      cfg.RestartOnPanic,
+		skipVerifiedBlocks:  cfg.SkipVerifiedBlocks,
+		backfillSafeNoSync:  cfg.BackfillSafeNoSync,
+		backfillSyncPeriod:  cfg.BackfillSyncPeriod,
+		warmStateTrie:       cfg.WarmStateTrie,
+		warmStateTrieLevels: cfg.WarmStateTrieLevels,
+		diffRetention:       cfg.DiffRetention,
+		prefetchStateTries:  cfg.PrefetchStateTries,
+		storageRoots:        newStorageRootCache(cfg.StorageRootCacheSize),
+		ctx:                 ctx,
+		cancel:              cancel,
+	}
+}
+
+// ChainNamespace returns the prefix of the keys of the network with the
+// given layer 1 chain id in the databases when they are namespaced by
+// chain. Any chain other than mainnet is taken to be goerli.
+func ChainNamespace(chainID int64) string {
+	if chainID == mainnetChainID {
+		return "mainnet/"
+	}
+	return "goerli/"
+}
+
+// FeederChainID returns the layer 1 chain id of the network served by the
+// feeder gateway, which sets the layer 1 contracts and deployment block
+// used by the Synchronizer. If the network can't be detected, the
+// configured one is used.
+func FeederChainID(fClient *feeder.Client, network string) int64 {
+	configured := int64(goerliChainID)
+	if network == "mainnet" {
+		configured = mainnetChainID
+	}
+	if fClient == nil {
+		// notest
+		return configured
+	}
+	chain, err := fClient.GetChainId()
+	if err != nil {
+		log.Default.With("Error", err, "Network", network).
+			Warn("Couldn't detect the network of the feeder gateway, using the configured one")
+		return configured
+	}
+	detected := int64(goerliChainID)
+	if chain == feeder.Mainnet {
+		detected = mainnetChainID
 	}
+	if detected != configured {
+		log.Default.With("Network", network, "Feeder Gateway Network", chain).
+			Warn("The configured network doesn't match the feeder gateway, using the feeder gateway one")
+	}
+	return detected
 }
 
 // UpdateState initiates network syncing. Syncing will occur against the
 // feeder gateway or Layer 1 depending on the configuration.
 // notest
-func (s *Synchronizer) UpdateState() error {
+func (s *Synchronizer) UpdateState() (err error) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			err = s.recovered("state update", r)
+		}
+	}()
+
 	log.Default.Info("Starting to update state")
-	if config.Runtime.Starknet.ApiSync {
-		return s.apiSync()
+	if err := s.checkStateDbLayout(); err != nil {
+		log.Default.With("Error", err).Error("Couldn't check the layout of the state database")
+		return err
+	}
+	if err := s.restoreLatestBlockSynced(); err != nil {
+		log.Default.With("Error", err).Error("Couldn't restore the latest block synced")
+		return err
+	}
+	if s.warmStateTrie {
+		s.warmUpStateTrie()
+	}
+	if s.apiSync {
+		err = s.syncWithAPI()
+	} else {
+		err = s.l1Sync()
+	}
+	if err == nil {
+		// The sync stops without an error when a goroutine it started
+		// panicked and wasn't restarted.
+		err = s.lastFailure()
+	}
+	return err
+}
+
+// getContractAddresses gets the addresses of the layer 1 contracts from
+// the feeder gateway, retrying failed requests with a backoff so that a
+// transient error of the gateway doesn't stop the sync. It gives up after
+// contractAddressesAttempts attempts, or when the Synchronizer is closed,
+// and returns the last error.
+func (s *Synchronizer) getContractAddresses() (*feeder.ContractAddresses, error) {
+	delay := minRestartDelay
+	for attempt := 1; ; attempt++ {
+		addresses, err := s.feederGatewayClient.GetContractAddresses()
+		if err == nil {
+			return addresses, nil
+		}
+		if attempt == contractAddressesAttempts {
+			return nil, fmt.Errorf("couldn't get the contract addresses after %d attempts: %w", attempt, err)
+		}
+		log.Default.With("Error", err, "Attempt", attempt, "Retry In", delay).
+			Warn("Couldn't get the contract addresses, retrying")
+		select {
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
 	}
-	return s.l1Sync()
 }
 
 // loadEvents sends all logs ever emitted by `contracts` and adds them
-// to `eventChan`. Once caught up with the main chain, it will listen
-// for events originating from `contracts` indefinitely.
+// to `eventChan`. Failed log requests are retried in smaller chunks, so
+// no history is skipped. Once caught up with the main chain, it will
+// listen for events originating from `contracts` indefinitely.
 // notest
 func (s *Synchronizer) loadEvents(
 	contracts map[common.Address]starknetTypes.ContractInfo,
@@ -91,57 +417,75 @@ func (s *Synchronizer) loadEvents(
 	topics := make([]common.Hash, 0)
 	for k, v := range contracts {
 		addresses = append(addresses, k)
-		topics = append(topics, crypto.Keccak256Hash([]byte(v.Contract.Events[v.EventName].Sig)))
-	}
-	latestBlockNumber, err := s.ethereumClient.BlockNumber(context.Background())
-	if err != nil {
-		log.Default.With("Error", err).Error("Couldn't get the latest block")
-		return err
-	}
-
-	initialBlock := initialBlockForStarknetContract(s.chainID)
-	increment := uint64(starknetTypes.MaxChunk)
-	i := uint64(initialBlock)
-	for i < latestBlockNumber {
-		log.Default.With("From Block", i, "To Block", i+increment).Info("Fetching logs....")
-		query := ethereum.FilterQuery{
-			FromBlock: new(big.Int).SetUint64(i),
-			ToBlock:   new(big.Int).SetUint64(i + increment),
-			Addresses: addresses,
-			Topics:    [][]common.Hash{topics},
+		for _, name := range v.EventNames {
+			topics = append(topics, v.Contract.Events[name].ID)
 		}
-
-		starknetLogs, err := s.ethereumClient.FilterLogs(context.Background(), query)
+	}
+	chunk := newLogChunk(s.logChunkSize)
+	from := uint64(initialBlockForStarknetContract(s.chainID))
+	// The head moves while the history is fetched, so the backfill is
+	// repeated until it reaches the current head before subscribing.
+	for {
+		head, err := s.ethereumClient.BlockNumber(context.Background())
 		if err != nil {
-			log.Default.With("Error", err, "Initial block", i, "End block", i+increment, "Addresses", addresses).
-				Info("Couldn't get logs")
+			log.Default.With("Error", err).Error("Couldn't get the latest block")
+			return err
+		}
+		if from >= head {
 			break
 		}
-		log.Default.With("Count", len(starknetLogs)).Info("Logs fetched")
-		for _, vLog := range starknetLogs {
-			log.Default.With("Log Fetched", contracts[vLog.Address].EventName, "BlockHash", vLog.BlockHash.Hex(), "BlockNumber", vLog.BlockNumber,
-				"TxHash", vLog.TxHash.Hex()).Info("Event Fetched")
-			event := map[string]interface{}{}
+		for from < head {
+			to := from + chunk.size - 1
+			if to >= head {
+				to = head - 1
+			}
+			log.Default.With("From Block", from, "To Block", to).Info("Fetching logs....")
+			query := ethereum.FilterQuery{
+				FromBlock: new(big.Int).SetUint64(from),
+				ToBlock:   new(big.Int).SetUint64(to),
+				Addresses: addresses,
+				Topics:    [][]common.Hash{topics},
+			}
 
-			err = contracts[vLog.Address].Contract.UnpackIntoMap(event, contracts[vLog.Address].EventName, vLog.Data)
+			starknetLogs, err := s.ethereumClient.FilterLogs(context.Background(), query)
 			if err != nil {
-				log.Default.With("Error", err).Info("Couldn't get LogStateTransitionFact from event")
+				// The range is retried in smaller chunks, since nodes
+				// often reject ranges with too many logs.
+				chunk.failed()
+				log.Default.With("Error", err, "Initial block", from, "End block", to, "Addresses", addresses,
+					"Chunk Size", chunk.size).Warn("Couldn't get logs, retrying")
+				select {
+				case <-s.ctx.Done():
+					return nil
+				case <-time.After(logRetryDelay):
+				}
 				continue
 			}
-			eventChan <- starknetTypes.EventInfo{
-				Block:           vLog.BlockNumber,
-				Event:           event,
-				Address:         contracts[vLog.Address].Address,
-				TransactionHash: vLog.TxHash,
+			chunk.succeeded()
+			log.Default.With("Count", len(starknetLogs)).Info("Logs fetched")
+			for _, vLog := range starknetLogs {
+				event, err := decodeLog(contracts[vLog.Address], vLog)
+				if err != nil {
+					log.Default.With("Error", err).Info("Couldn't get event from log")
+					continue
+				}
+				log.Default.With("Log Fetched", event.Name, "BlockHash", vLog.BlockHash.Hex(), "BlockNumber", vLog.BlockNumber,
+					"TxHash", vLog.TxHash.Hex()).Info("Event Fetched")
+				queueEvent(eventChan, event)
 			}
+			from = to + 1
 		}
-		i += increment
 	}
 	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(int64(latestBlockNumber)),
+		FromBlock: new(big.Int).SetUint64(from),
 		Addresses: addresses,
+		Topics:    [][]common.Hash{topics},
+	}
+	bufferSize := s.eventBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultEventBufferSize
 	}
-	hLog := make(chan types.Log)
+	hLog := make(chan types.Log, bufferSize)
 	sub, err := s.ethereumClient.SubscribeFilterLogs(context.Background(), query, hLog)
 	if err != nil {
 		log.Default.Info("Couldn't subscribe for incoming blocks")
@@ -152,25 +496,71 @@ func (s *Synchronizer) loadEvents(
 		case err := <-sub.Err():
 			log.Default.With("Error", err).Info("Error getting the latest logs")
 		case vLog := <-hLog:
-			log.Default.With("Log Fetched", contracts[vLog.Address].EventName, "BlockHash", vLog.BlockHash.Hex(),
-				"BlockNumber", vLog.BlockNumber, "TxHash", vLog.TxHash.Hex()).
-				Info("Event Fetched")
-			event := map[string]interface{}{}
-			err = contracts[vLog.Address].Contract.UnpackIntoMap(event, contracts[vLog.Address].EventName, vLog.Data)
+			metr.IncreaseL1EventsReceived()
+			// The log was taken from the buffer, so if it's still full the
+			// consumer is not keeping up with the subscription.
+			if len(hLog) == cap(hLog)-1 {
+				metr.IncreaseL1EventsBufferFull()
+				log.Default.With("Buffer Size", cap(hLog)).Warn("Layer 1 log buffer is full")
+			}
+			event, err := decodeLog(contracts[vLog.Address], vLog)
 			if err != nil {
 				log.Default.With("Error", err).Info("Couldn't get event from log")
 				continue
 			}
-			eventChan <- starknetTypes.EventInfo{
-				Block:           vLog.BlockNumber,
-				Event:           event,
-				Address:         contracts[vLog.Address].Address,
-				TransactionHash: vLog.TxHash,
-			}
+			log.Default.With("Log Fetched", event.Name, "BlockHash", vLog.BlockHash.Hex(),
+				"BlockNumber", vLog.BlockNumber, "TxHash", vLog.TxHash.Hex()).
+				Info("Event Fetched")
+			queueEvent(eventChan, event)
 		}
 	}
 }
 
+// logChunk is the number of layer 1 blocks whose logs are requested at
+// once during the backfill. It is halved, down to a single block, when a
+// request fails and doubled back up to the configured size when one
+// succeeds.
+type logChunk struct {
+	max, size uint64
+}
+
+// newLogChunk returns a logChunk of at most max blocks. If max is not
+// positive, config.DefaultLogChunkSize is used.
+func newLogChunk(max int) *logChunk {
+	if max <= 0 {
+		max = config.DefaultLogChunkSize
+	}
+	return &logChunk{max: uint64(max), size: uint64(max)}
+}
+
+// failed halves the chunk after a failed request.
+func (c *logChunk) failed() {
+	if c.size > 1 {
+		c.size /= 2
+	}
+}
+
+// succeeded grows the chunk back after a successful request.
+func (c *logChunk) succeeded() {
+	if c.size *= 2; c.size > c.max {
+		c.size = c.max
+	}
+}
+
+// queueEvent sends event to the queue of events to be processed, and
+// records when the queue is full and the sender has to wait.
+// notest
+func queueEvent(queue chan starknetTypes.EventInfo, event starknetTypes.EventInfo) {
+	select {
+	case queue <- event:
+	default:
+		metr.IncreaseL1EventsQueueFull()
+		log.Default.With("Queue Size", cap(queue)).Warn("Layer 1 event queue is full")
+		queue <- event
+	}
+	metr.SetL1EventQueueLength(len(queue))
+}
+
 // l1Sync syncs against the starknet data stored on layer 1. It calls
 // `loadEvents` to obtain events from three of the Starknet contracts on
 // Ethereum:
@@ -194,56 +584,64 @@ func (s *Synchronizer) loadEvents(
 // Once this function sees a `LogStateTransitionFact` event, it works
 // backward through the steps above to reconstruct the original Starknet
 // transactions.
+//
+// The Starknet contract also emits events as messages from layer 1 to
+// layer 2 are sent, consumed or cancelled. Their statuses are stored in
+// the MessageService by message hash.
 // notest
 func (s *Synchronizer) l1Sync() error {
 	log.Default.Info("Starting to update state")
 
-	contractAddresses, err := s.feederGatewayClient.GetContractAddresses()
+	contractAddresses, err := s.getContractAddresses()
 	if err != nil {
-		log.Default.With("Error", err).Panic("Couldn't get ContractInfo Address from Feeder Gateway")
+		if s.ctx.Err() != nil {
+			return nil
+		}
+		log.Default.With("Error", err).Error("Couldn't get ContractInfo Address from Feeder Gateway")
 		return err
 	}
-	event := make(chan starknetTypes.EventInfo)
+	queueSize := s.eventQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultEventQueueSize
+	}
+	// The queue lets the log fetcher keep reading from layer 1 while the
+	// events are processed.
+	event := make(chan starknetTypes.EventInfo, queueSize)
 	contracts := make(map[common.Address]starknetTypes.ContractInfo)
 
-	// Add Starknet contract
+	// Add Starknet contract, tracking the state transitions and the
+	// messages from layer 1 to layer 2
 	err = loadContractInfo(contractAddresses.Starknet,
-		abi.StarknetAbi,
-		"LogStateTransitionFact", contracts)
+		abi.StarknetAbi, contracts,
+		"LogStateTransitionFact", "LogMessageToL2", "ConsumedMessageToL2",
+		"MessageToL2CancellationStarted", "MessageToL2Canceled")
 	if err != nil {
-		log.Default.With("Address", contractAddresses.Starknet).
-			Panic("Couldn't load contract from disk ")
-		return err
+		return fmt.Errorf("couldn't load the ABI of the StarkNet contract %s: %w", contractAddresses.Starknet, err)
 	}
 
 	// Add Gps Statement Verifier contract
 	gpsAddress := getGpsVerifierContractAddress(s.chainID)
 	err = loadContractInfo(gpsAddress,
-		abi.GpsVerifierAbi,
-		"LogMemoryPagesHashes", contracts)
+		abi.GpsVerifierAbi, contracts,
+		"LogMemoryPagesHashes")
 	if err != nil {
-		log.Default.With("Address", gpsAddress).
-			Panic("Couldn't load contract from disk ")
-		return err
+		return fmt.Errorf("couldn't load the ABI of the GPS verifier contract %s: %w", gpsAddress, err)
 	}
 	// Add Memory Page Fact Registry contract
 	memoryPagesContractAddress := getMemoryPagesContractAddress(s.chainID)
 	err = loadContractInfo(memoryPagesContractAddress,
-		abi.MemoryPagesAbi,
-		"LogMemoryPageFactContinuous", contracts)
+		abi.MemoryPagesAbi, contracts,
+		"LogMemoryPageFactContinuous")
 	if err != nil {
-		log.Default.With("Address", memoryPagesContractAddress).
-			Panic("Couldn't load contract from disk ")
-		return err
+		return fmt.Errorf("couldn't load the ABI of the memory pages contract %s: %w", memoryPagesContractAddress, err)
 	}
 
-	go func() {
-		err = s.loadEvents(contracts, event)
-		if err != nil {
+	s.goRecovered("layer 1 event loader", func() {
+		if err := s.loadEvents(contracts, event); err != nil {
 			log.Default.With("Error", err).Info("Couldn't get events")
 			close(event)
 		}
-	}()
+	})
 
 	latestBlockSynced, err := getNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced)
 	if err != nil {
@@ -252,48 +650,111 @@ func (s *Synchronizer) l1Sync() error {
 	latestBlockSaved := latestBlockSynced
 
 	// Handle frequently if there is any fact that comes from L1 to handle
-	go func() {
+	s.goRecovered("fact processor", func() {
 		// Make sure this goroutine never gets moved to a new thread.
 		// MDBX transactions cannot be shared across threads (see updateAndCommitState and updateState).
 		runtime.LockOSThread()
 		ticker := time.NewTicker(time.Second * 5)
-		for range ticker.C {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
 			if !s.facts.Exist(strconv.FormatUint(latestBlockSynced, 10)) {
 				continue
 			}
 			f, _ := s.facts.Get(strconv.FormatUint(latestBlockSynced, 10), &starknetTypes.Fact{})
 			fact := f.(starknetTypes.Fact)
+			factKey := storedDictKey(s.gpsVerifier, common.FromHex(fact.Value))
+
+			if s.skipVerifiedBlocks && s.verifiedBlock(fact.SequenceNumber, fact.StateRoot) {
+				log.Default.With("Block Number", fact.SequenceNumber).
+					Info("Skipping the memory pages of a block already in the local state")
+				metr.IncreaseCountStarknetStateAlreadyVerified()
+				next, err := s.skipVerifiedFact(fact)
+				if err != nil {
+					s.stopWithError("fact processor", fmt.Errorf("couldn't update the latest block synced: %w", err))
+					return
+				}
+				latestBlockSynced = next
+				continue
+			}
 
-			if s.gpsVerifier.Exist(fact.Value) {
+			if s.gpsVerifier.Exist(factKey) {
 				// Get memory pages hashes using fact
-				pagesHashes, err := s.gpsVerifier.Get(fact.Value, starknetTypes.PagesHash{})
+				pagesHashes, err := s.gpsVerifier.Get(factKey, starknetTypes.PagesHash{})
 				if err != nil {
 					log.Default.With("Error").Panic("Fact has not been verified")
 				}
 				// If already exist the information related to the fact,
 				// fetch the memory pages and updated the State
-				pages := s.processPagesHashes(
+				pages, l1Txs := s.processPagesHashes(
 					pagesHashes.(starknetTypes.PagesHash).Bytes,
 					contracts[common.HexToAddress(memoryPagesContractAddress)].Contract,
 				)
+				if pages == nil {
+					// A memory page isn't known yet or couldn't be fetched,
+					// so the fact is kept and tried again on the next tick.
+					log.Default.With("Block Number", fact.SequenceNumber).
+						Warn("Couldn't get the memory pages of the block, retrying")
+					continue
+				}
 
-				stateDiff := parsePages(pages)
+				stateDiff, err := parsePages(pages, fact.SequenceNumber)
+				if err != nil {
+					s.stopWithError("fact processor", fmt.Errorf("couldn't get the state diff of block %d from the memory pages: %w",
+						fact.SequenceNumber, err))
+					return
+				}
 
 				// Update state
-				latestBlockSynced = s.updateAndCommitState(stateDiff, fact.StateRoot, fact.SequenceNumber)
+				latestBlockSynced, err = s.updateAndCommitState(s.ctx, stateDiff, "", fact.StateRoot, fact.SequenceNumber)
+				if err != nil {
+					s.stopWithError("fact processor", fmt.Errorf("couldn't apply block %d: %w", fact.SequenceNumber, err))
+					return
+				}
+
+				sequenceNumber := strconv.FormatUint(fact.SequenceNumber, 10)
+				s.l1Transactions.Add(sequenceNumber, starknetTypes.L1TransactionHashes{Hashes: l1Txs})
 
 				// update services
-				go s.updateServices(*stateDiff, "", strconv.FormatUint(fact.SequenceNumber, 10))
+				s.goRecovered("service update", func() {
+					s.updateServices(*stateDiff, nil, "", sequenceNumber)
+				})
 
 				isNoErr := s.facts.Remove(strconv.FormatUint(latestBlockSynced-1, 10))
 				if !isNoErr {
+					s.stopWithError("fact processor", fmt.Errorf("couldn't remove the fact of block %d", latestBlockSynced-1))
 					return
 				}
 			}
 		}
-	}()
+	})
 
-	for l := range event {
+	for {
+		var l starknetTypes.EventInfo
+		var ok bool
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case l, ok = <-event:
+			metr.SetL1EventQueueLength(len(event))
+		}
+		if !ok {
+			break
+		}
+		// Process messages from layer 1 to layer 2
+		if status, ok := l1ToL2MessageStatuses[l.Name]; ok {
+			messageHash, err := l1ToL2MessageHash(l.Event)
+			if err != nil {
+				log.Default.With("Error", err, "Event", l.Name).Info("Couldn't get the message hash")
+				continue
+			}
+			services.MessageService.StoreMessageStatus(messageHash, status)
+			continue
+		}
 		// Process GpsStatementVerifier contract
 		factHash, ok := l.Event["factHash"]
 		pagesHashes, ok1 := l.Event["pagesHashes"]
@@ -304,11 +765,11 @@ func (s *Synchronizer) l1Sync() error {
 				b = append(b, v)
 			}
 			value := starknetTypes.PagesHash{Bytes: pagesHashes.([][32]byte)}
-			s.gpsVerifier.Add(common.BytesToHash(b).Hex(), value)
+			s.gpsVerifier.Add(dictKey(b), value)
 		}
 		// Process MemoryPageFactRegistry contract
 		if memoryHash, ok := l.Event["memoryHash"]; ok {
-			key := common.BytesToHash(memoryHash.(*big.Int).Bytes()).Hex()
+			key := dictKey(memoryHash.(*big.Int).Bytes())
 			value := starknetTypes.TransactionHash{Hash: l.TransactionHash}
 			s.memoryPageHash.Add(key, value)
 		}
@@ -319,6 +780,13 @@ func (s *Synchronizer) l1Sync() error {
 			for _, v := range fact.([32]byte) {
 				b = append(b, v)
 			}
+			factHash := storedDictKey(s.processedFacts, b)
+			// The same fact can be received again after the subscription
+			// reconnects or from overlapping chunks of logs.
+			if s.processedFacts.Exist(factHash) {
+				log.Default.With("Fact", factHash).Debug("Skipping duplicate fact")
+				continue
+			}
 			contractAbi, _ := loadAbiOfContract(abi.StarknetAbi)
 			starknetAddress := common.HexToAddress(contractAddresses.Starknet)
 
@@ -341,52 +809,238 @@ func (s *Synchronizer) l1Sync() error {
 				log.Default.With("Error", err, "Initial block", l.Block, "End block", l.Block+1).
 					Info("Couldn't get logs")
 			}
-			fullFact, err := getFactInfo(starknetLogs, contractAbi, common.BytesToHash(b).Hex(), latestBlockSaved, l.TransactionHash)
+			fullFact, err := getFactInfo(starknetLogs, contractAbi, factHash, latestBlockSaved, l.TransactionHash)
 			if err != nil {
 				continue
 			}
 
 			// Safe Fact for block x
-			s.facts.Add(strconv.FormatUint(latestBlockSaved, 10), fullFact)
-			latestBlockSaved++
+			if s.enqueueFact(factHash, fullFact, latestBlockSaved) {
+				latestBlockSaved++
+			}
 		}
 	}
 	return errors.New("events channel closed")
 }
 
+// LatestStateRoot returns the most recently committed state root and the
+// number of the block that committed it. It only reads the database, so
+// it does not wait for the block being applied. If no block has been
+// committed yet, it returns ErrNoStateRoot.
+func (s *Synchronizer) LatestStateRoot() (*localTypes.Felt, uint64, error) {
+	return getLatestStateRoot(s.stateDatabase)
+}
+
+// L1TxForBlock returns the hashes of the layer 1 transactions that
+// registered the memory pages of block n, in the order of the pages. It
+// returns ErrNoL1Transactions if they weren't recorded, as for the
+// blocks synced from the feeder gateway.
+func (s *Synchronizer) L1TxForBlock(n uint64) ([]common.Hash, error) {
+	value, err := s.l1Transactions.Get(strconv.FormatUint(n, 10), starknetTypes.L1TransactionHashes{})
+	if err != nil {
+		if db.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: block %d", ErrNoL1Transactions, n)
+		}
+		// notest
+		return nil, err
+	}
+	return value.(starknetTypes.L1TransactionHashes).Hashes, nil
+}
+
+// Status is a snapshot of the progress of a Synchronizer.
+type Status struct {
+	// NextBlock is the number of the next block to sync.
+	NextBlock uint64
+	// FeederGateway is the URL of the feeder gateway the requests are
+	// currently sent to.
+	FeederGateway string
+	// FeederRequestsInFlight is the number of requests to the feeder
+	// gateway waiting for their response.
+	FeederRequestsInFlight int64
+	// Healthy is false once a sync goroutine has panicked, and Failure
+	// is then the error of the last panic.
+	Healthy bool
+	Failure string
+}
+
+// Status returns the progress of the sync and the feeder gateway in use.
+func (s *Synchronizer) Status() (Status, error) {
+	next, err := getNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced)
+	if err != nil {
+		// notest
+		return Status{}, err
+	}
+	status := Status{
+		NextBlock:              next,
+		FeederGateway:          s.feederGatewayClient.ActiveGateway(),
+		FeederRequestsInFlight: s.feederGatewayClient.InFlight(),
+		Healthy:                true,
+	}
+	if err := s.lastFailure(); err != nil {
+		status.Healthy = false
+		status.Failure = err.Error()
+	}
+	return status, nil
+}
+
+// checkContractStorage compares, for each contract updated in
+// `stateDiff`, the value of every updated storage slot in the local
+// storage trie against the one returned by the feeder gateway at the
+// given block, and logs the first divergent contract. The feeder gateway
+// does not expose the storage root of a contract, so the slots are
+// compared one by one instead.
+// notest
+func (s *Synchronizer) checkContractStorage(
+	txn db.DatabaseOperations,
+	stateDiff *starknetTypes.StateDiff,
+	blockNumber uint64,
+) {
+	number := strconv.FormatUint(blockNumber, 10)
+	stop := false
+	stateDiff.StorageDiffs.Range(func(contractAddress localTypes.Felt, kvs []starknetTypes.KV) bool {
+		address := contractAddress.Hex()
+		formattedAddress := remove0x(address)
+		storageTrie := newTrie(txn, formattedAddress)
+		for _, slot := range kvs {
+			key, ok := new(big.Int).SetString(remove0x(slot.Key), 16)
+			if !ok {
+				log.Default.With("Storage Slot Key", slot.Key).Error("Couldn't parse the storage slot key")
+				continue
+			}
+			local, ok := storageTrie.Get(key)
+			if err := storageTrie.Err(); err != nil {
+				log.Default.With("Error", err, "Address", address, "Key", slot.Key).
+					Error("Couldn't read the local storage")
+				stop = true
+				return false
+			}
+			if !ok {
+				local = new(big.Int)
+			}
+			info, err := s.feederGatewayClient.GetStorageAt(address, key.Text(10), "", number)
+			if err != nil {
+				log.Default.With("Error", err, "Address", address, "Key", slot.Key).
+					Error("Couldn't get storage from the feeder gateway")
+				stop = true
+				return false
+			}
+			remote, ok := new(big.Int).SetString(remove0x(string(*info)), 16)
+			if !ok {
+				log.Default.With("Address", address, "Key", slot.Key, "Value", string(*info)).
+					Error("Couldn't parse the storage value from the feeder gateway")
+				stop = true
+				return false
+			}
+			if local.Cmp(remote) != 0 {
+				log.Default.With(
+					"Block Number", blockNumber,
+					"Address", address,
+					"Storage Root", storageTrie.Commitment().Text(16),
+					"Key", slot.Key,
+					"Local Value", local.Text(16),
+					"Feeder Value", remote.Text(16),
+				).Error("Found divergent contract storage")
+				stop = true
+				return false
+			}
+		}
+		return true
+	})
+	if stop {
+		return
+	}
+	log.Default.With("Block Number", blockNumber).
+		Info("Storage of the updated contracts matches the feeder gateway")
+}
+
 // updateAndCommitState applies `stateDiff` to the local state and
-// commits the changes to the database.
+// commits the changes to the database. If the old root check is enabled
+// and `oldRoot` is not empty, it must match the root of the local state
+// before the diff is applied. If ctx is cancelled before the diff is
+// applied, the changes are rolled back and ctx's error is returned. Any
+// other error, such as errOldRootMismatch, errStateRootMismatch or
+// trie.ErrCorruptTrie, is returned wrapped and the state is left as it
+// was. The services are only updated once the state is committed, so a diff that
+// is malformed or rejected leaves them as they were.
 // notest
 func (s *Synchronizer) updateAndCommitState(
+	ctx context.Context,
 	stateDiff *starknetTypes.StateDiff,
+	oldRoot string,
 	newRoot string,
 	sequenceNumber uint64,
-) uint64 {
+) (uint64, error) {
 	start := time.Now()
-	// Save contract hashes of the new contracts
+	if err := stateDiff.Validate(); err != nil {
+		metr.IncreaseCountStarknetStateFailed()
+		return sequenceNumber, fmt.Errorf("invalid state diff of block %d: %w", sequenceNumber, err)
+	}
+	// Build contractAddress-contractHash map. The contracts deployed in
+	// the block aren't in the contract hash service until it's committed.
+	deployedHashes := make(map[localTypes.Felt]*big.Int, len(stateDiff.DeployedContracts))
 	for _, deployedContract := range stateDiff.DeployedContracts {
-		contractHash, ok := new(big.Int).SetString(remove0x(deployedContract.ContractHash), 16)
-		if !ok {
-			// notest
-			metr.IncreaseCountStarknetStateFailed()
-			log.Default.Panic("Couldn't get contract hash")
-		}
-		services.ContractHashService.StoreContractHash(remove0x(deployedContract.Address), contractHash)
+		deployedHashes[localTypes.HexToFelt(deployedContract.Address)] = localTypes.HexToFelt(deployedContract.ContractHash).Big()
 	}
-	// Build contractAddress-contractHash map
 	contractHashMap := make(map[string]*big.Int)
-	for contractAddress := range stateDiff.StorageDiffs {
-		formattedAddress := remove0x(contractAddress)
+	stateDiff.StorageDiffs.Range(func(contractAddress localTypes.Felt, _ []starknetTypes.KV) bool {
+		formattedAddress := remove0x(contractAddress.Hex())
+		if contractHash, ok := deployedHashes[contractAddress]; ok {
+			contractHashMap[formattedAddress] = contractHash
+			return true
+		}
 		contractHashMap[formattedAddress] = services.ContractHashService.GetContractHash(formattedAddress)
-	}
+		return true
+	})
 
-	err := s.database.RunTxn(func(txn db.DatabaseOperations) error {
-		_, err := updateState(txn, contractHashMap, stateDiff, newRoot, sequenceNumber)
-		return err
+	// RunTxn doesn't wrap the error of the transaction, so it's kept to be
+	// returned as is and the errors of the checks can be told apart.
+	var txnErr error
+	err := s.stateDatabase.RunTxn(func(txn db.DatabaseOperations) (err error) {
+		defer func() { txnErr = err }()
+		// Make sure the block is applied on top of the state it was built
+		// on, so that a skipped block or a corrupt checkpoint fails right
+		// away instead of producing a wrong state root.
+		if s.verifyOldRoot {
+			if err := checkOldRoot(txn, oldRoot); err != nil {
+				return fmt.Errorf("block %d: %w", sequenceNumber, err)
+			}
+		}
+		stateRoot, err := updateState(ctx, txn, contractHashMap, s.storageRoots, stateDiff, newRoot, sequenceNumber)
+		if err != nil {
+			if errors.Is(err, errStateRootMismatch) && s.deepCheck {
+				// notest
+				s.checkContractStorage(txn, stateDiff, sequenceNumber)
+			}
+			return err
+		}
+		if err := putLatestStateRoot(txn, localTypes.HexToFelt(stateRoot), sequenceNumber); err != nil {
+			// notest
+			return err
+		}
+		if err := putStateDiff(txn, sequenceNumber, stateDiff, s.diffRetention); err != nil {
+			// notest
+			return err
+		}
+		return s.putLatestBlockSynced(txn, sequenceNumber)
 	})
 	if err != nil {
+		s.storageRoots.discard()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			log.Default.With("Block Number", sequenceNumber).Info("State update cancelled")
+			return sequenceNumber, ctxErr
+		}
+		metr.IncreaseCountStarknetStateFailed()
+		if txnErr != nil {
+			err = txnErr
+		}
+		log.Default.With("Error", err, "Block Number", sequenceNumber).Error("Couldn't update the state")
+		return sequenceNumber, fmt.Errorf("couldn't update the state of block %d: %w", sequenceNumber, err)
+	}
+	s.storageRoots.commit()
+	if err := s.storeDeployedContracts(stateDiff, sequenceNumber); err != nil {
+		// notest
 		metr.IncreaseCountStarknetStateFailed()
-		log.Default.Fatal(err)
+		return sequenceNumber, err
 	}
 
 	metr.IncreaseCountStarknetStateSuccess()
@@ -394,11 +1048,212 @@ func (s *Synchronizer) updateAndCommitState(
 	metr.UpdateStarknetSyncTime(duration.Seconds())
 	log.Default.With("Block Number", sequenceNumber).Info("State updated")
 
-	err = updateNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced, sequenceNumber)
+	if s.stateDatabase != s.database {
+		err = updateNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced, sequenceNumber)
+		if err != nil {
+			log.Default.With("Error", err).Info("Couldn't save latest block queried")
+		}
+	}
+	return sequenceNumber + 1, nil
+}
+
+// storeDeployedContracts saves the contract hashes and deployment blocks
+// of the contracts deployed in the given block, along with the class
+// changes of the contracts already deployed.
+func (s *Synchronizer) storeDeployedContracts(stateDiff *starknetTypes.StateDiff, sequenceNumber uint64) error {
+	for _, deployedContract := range stateDiff.DeployedContracts {
+		hash, err := localTypes.FeltFromHex(deployedContract.ContractHash)
+		if err != nil {
+			return fmt.Errorf("contract hash of deployed contract %s: %w", deployedContract.Address, err)
+		}
+		contractHash := hash.Big()
+		address := remove0x(deployedContract.Address)
+		previous := services.ContractHashService.StoreContractHash(address, contractHash)
+		if previous == nil || previous.Cmp(contractHash) != 0 {
+			services.ContractHashService.StoreContractHashAt(address, sequenceNumber, contractHash)
+		}
+		if previous != nil && previous.Cmp(contractHash) != 0 {
+			log.Default.With("Contract Address", deployedContract.Address, "Block Number", sequenceNumber,
+				"Old Class Hash", previous.Text(16), "New Class Hash", contractHash.Text(16)).
+				Info("Contract class changed")
+			services.ContractHashService.StoreClassChange(address, services.ClassChange{
+				BlockNumber:  sequenceNumber,
+				OldClassHash: previous,
+				NewClassHash: contractHash,
+			})
+		}
+		services.StateService.StoreDeployedContract(localTypes.HexToFelt(deployedContract.Address).Hex(), sequenceNumber)
+	}
+	return nil
+}
+
+// putLatestBlockSynced records, in the transaction that commits the state
+// of the given block, that it is the latest block synced, if the state
+// and the rest of the sync data share a database. Otherwise, there is no
+// transaction across both and the caller records it once the state is
+// committed; a crash in between is repaired by restoreLatestBlockSynced.
+func (s *Synchronizer) putLatestBlockSynced(txn db.DatabaseOperations, blockNumber uint64) error {
+	if s.stateDatabase != s.database {
+		return nil
+	}
+	return updateNumericValueFromDB(txn, starknetTypes.LatestBlockSynced, blockNumber)
+}
+
+// restoreLatestBlockSynced makes the latest block synced match the
+// committed state. The block number of the latest state root is written
+// along with the state, so if the latest block synced was not recorded,
+// or recorded without the state being committed, it is set to the block
+// after the one of the latest state root.
+func (s *Synchronizer) restoreLatestBlockSynced() error {
+	next, err := getNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced)
+	if err != nil {
+		return err
+	}
+	_, rootBlock, err := s.LatestStateRoot()
+	if errors.Is(err, ErrNoStateRoot) {
+		return nil
+	}
 	if err != nil {
-		log.Default.With("Error", err).Info("Couldn't save latest block queried")
+		// notest
+		return err
+	}
+	if next == rootBlock+1 {
+		return nil
+	}
+	log.Default.With("Latest Block Synced", next, "State Root Block", rootBlock).
+		Warn("The latest block synced doesn't match the committed state, restoring it")
+	return updateNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced, rootBlock)
+}
+
+// checkStateDbLayout checks that the state is stored in the database it
+// was first stored in, a separate STATE one or the SYNCHRONIZER one,
+// and records the layout if it wasn't yet. Databases synced before the
+// layout was recorded have the state in the SYNCHRONIZER database. It
+// returns an ErrStateDbLayoutMismatch if the layout differs.
+func (s *Synchronizer) checkStateDbLayout() error {
+	layout := "shared"
+	if s.stateDatabase != s.database {
+		layout = "separate"
+	}
+	stored, err := s.database.Get([]byte(starknetTypes.StateDbLayout))
+	if err == nil {
+		if string(stored) != layout {
+			return fmt.Errorf("%w: the state is stored in a %s database, but %s was configured",
+				ErrStateDbLayoutMismatch, stored, layout)
+		}
+		return nil
+	}
+	if !db.IsNotFound(err) {
+		// notest
+		return err
+	}
+	if layout == "separate" {
+		_, _, err := getLatestStateRoot(s.database)
+		if err == nil {
+			return fmt.Errorf("%w: the state is stored in the SYNCHRONIZER database, but a separate one was configured",
+				ErrStateDbLayoutMismatch)
+		}
+		if !errors.Is(err, ErrNoStateRoot) {
+			// notest
+			return err
+		}
+	}
+	return s.database.Put([]byte(starknetTypes.StateDbLayout), []byte(layout))
+}
+
+// prefetching reports whether the trie nodes of the next block are read
+// before it's applied, which is while the sync is in the backfill.
+func (s *Synchronizer) prefetching() bool {
+	return s.prefetchStateTries && s.backfilling
+}
+
+// prefetchStateDiff reads the nodes of the state and storage tries that
+// applying the state diff reads, so that they are loaded concurrently
+// before the transaction applying it starts. The state database is read
+// outside of any transaction. Keys that aren't felts are skipped; they
+// fail the validation of the diff when it's applied.
+func (s *Synchronizer) prefetchStateDiff(stateDiff *starknetTypes.StateDiff) {
+	start := time.Now()
+	addresses := make([]*localTypes.Felt, 0, len(stateDiff.DeployedContracts))
+	for _, contract := range stateDiff.DeployedContracts {
+		if address, err := localTypes.FeltFromHex(contract.Address); err == nil {
+			addresses = append(addresses, &address)
+		}
+	}
+	stateDiff.StorageDiffs.Range(func(address localTypes.Felt, kvs []starknetTypes.KV) bool {
+		addresses = append(addresses, &address)
+		keys := make([]*localTypes.Felt, 0, len(kvs))
+		for _, kv := range kvs {
+			if key, err := localTypes.FeltFromHex(kv.Key); err == nil {
+				keys = append(keys, &key)
+			}
+		}
+		storageTrie := trie.New(db.NewKeyValueStore(s.stateDatabase, remove0x(address.Hex())), 251)
+		storageTrie.Prefetch(keys)
+		return true
+	})
+	stateTrie := trie.New(db.NewKeyValueStore(s.stateDatabase, "state_trie_"), 251)
+	stateTrie.Prefetch(addresses)
+	log.Default.With("Contracts", len(addresses), "Duration", time.Since(start)).
+		Debug("Prefetched the trie nodes of the state diff")
+}
+
+// warmUpStateTrie reads the top levels of the state trie so that the
+// first block applied after a restart doesn't wait for them to be loaded
+// from disk. It returns the number of nodes read.
+func (s *Synchronizer) warmUpStateTrie() int {
+	levels := s.warmStateTrieLevels
+	if levels <= 0 {
+		levels = defaultWarmStateTrieLevels
+	}
+	start := time.Now()
+	stateTrie := trie.New(db.NewKeyValueStore(s.stateDatabase, "state_trie_"), 251)
+	read := stateTrie.Warm(levels)
+	log.Default.With("Levels", levels, "Nodes", read, "Duration", time.Since(start)).
+		Info("Warmed up the state trie")
+	return read
+}
+
+// verifiedBlock reports whether block n has already been applied to the
+// local state with the given root, for example by the API sync, so that
+// its fact needn't be checked against the memory pages again. The root
+// of a block before the latest one is taken from the BlockService.
+func (s *Synchronizer) verifiedBlock(n uint64, root string) bool {
+	latestRoot, rootBlock, err := s.LatestStateRoot()
+	if err != nil || rootBlock < n {
+		return false
+	}
+	want := localTypes.HexToFelt(root)
+	if rootBlock == n {
+		return *latestRoot == want
 	}
-	return sequenceNumber + 1
+	block := services.BlockService.GetBlockByNumber(n)
+	return block != nil && block.NewRoot == want
+}
+
+// skipVerifiedFact records that the block of the fact, already in the
+// local state, is synced, and removes the fact. It returns the number of
+// the next block to sync.
+func (s *Synchronizer) skipVerifiedFact(fact starknetTypes.Fact) (uint64, error) {
+	// updateNumericValueFromDB stores the block after the given one.
+	if err := updateNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced, fact.SequenceNumber); err != nil {
+		return 0, err
+	}
+	s.facts.Remove(strconv.FormatUint(fact.SequenceNumber, 10))
+	return fact.SequenceNumber + 1, nil
+}
+
+// enqueueFact saves the fact to be applied as the given block, unless a
+// fact with the same hash has already been saved. The hashes of the saved
+// facts are kept in the database, so duplicates are also detected across
+// restarts. It returns true if the fact was saved.
+func (s *Synchronizer) enqueueFact(factHash string, fact *starknetTypes.Fact, blockNumber uint64) bool {
+	if s.processedFacts.Exist(factHash) {
+		return false
+	}
+	s.facts.Add(strconv.FormatUint(blockNumber, 10), fact)
+	s.processedFacts.Add(factHash, fact)
+	return true
 }
 
 // getFactInfo gets the state root and sequence number associated with
@@ -436,83 +1291,607 @@ func getFactInfo(starknetLogs []types.Log, contract ethAbi.ABI, fact string, lat
 	return nil, nil
 }
 
-// Close closes the client for the Layer 1 Ethereum node
-func (s *Synchronizer) Close(_ context.Context) {
+// Close stops the sync loops, waiting for them to finish until the
+// context is done, and closes the client for the Layer 1 Ethereum node
+// and the database.
+func (s *Synchronizer) Close(ctx context.Context) {
 	// notest
 	log.Default.Info("Closing Layer 1 Synchronizer")
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Default.Warn("Timed out waiting for the sync loops to stop")
+	}
 	if s.ethereumClient != nil {
 		s.ethereumClient.Close()
 	}
+	if s.stateDatabase != s.database {
+		s.stateDatabase.Close()
+	}
 	s.database.Close()
 }
 
-// apiSync syncs against the feeder gateway.
+// syncWithAPI syncs against the feeder gateway until the Synchronizer
+// is closed.
 // notest
-func (s *Synchronizer) apiSync() error {
+func (s *Synchronizer) syncWithAPI() error {
 	blockIterator, err := getNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced)
 	if err != nil {
 		log.Default.With("Error", err).Info("Couldn't get latest Block queried")
 		return err
 	}
+	if blockIterator == 0 && s.startBlock > 0 {
+		if err := s.checkStartBlock(); err != nil {
+			return err
+		}
+		blockIterator = s.startBlock
+	}
 	lastBlockHash := ""
+	poll := newPollBackoff(s.pollInterval)
+	s.backfilling = true
+	s.startBackfill()
+	defer s.endBackfill()
+	s.startBlockBatch()
+	defer s.endBlockBatch()
 	for {
-		newValueForIterator, newBlockHash := s.updateStateForOneBlock(blockIterator, lastBlockHash)
-		if newBlockHash == lastBlockHash {
-			// Assume we are completely synced or an error has occurred
-			time.Sleep(time.Minute * 2)
+		select {
+		case <-s.ctx.Done():
+			return nil
+		default:
+		}
+		var wait time.Duration
+		blockIterator, lastBlockHash, wait, err = s.syncStep(blockIterator, lastBlockHash, poll)
+		if s.ctx.Err() != nil {
+			return nil
 		}
-		blockIterator, lastBlockHash = newValueForIterator, newBlockHash
+		if err != nil {
+			return err
+		}
+		if wait > 0 {
+			select {
+			case <-s.ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+	}
+}
+
+// syncStep applies the block after lastBlockHash and returns the block to
+// apply next, its parent's hash and how long to wait before doing so. The
+// backfill ends only once the block is pending; if its state update
+// couldn't be fetched, it's fetched again after a wait and the sync stays
+// in the backfill.
+func (s *Synchronizer) syncStep(blockIterator uint64, lastBlockHash string, poll *pollBackoff) (uint64, string, time.Duration, error) {
+	next, hash, err := s.updateStateForOneBlock(blockIterator, lastBlockHash)
+	switch {
+	case err == nil:
+		poll.reset()
+		return next, hash, 0, nil
+	case errors.Is(err, errBlockPending):
+		s.backfilling = false
+		s.endBackfill()
+		s.endBlockBatch()
+		return blockIterator, lastBlockHash, poll.idle(), nil
+	case errors.Is(err, errFetchStateUpdate):
+		log.Default.With("Error", err, "Block Number", blockIterator).Info("Couldn't get state update")
+		return blockIterator, lastBlockHash, poll.idle(), nil
+	}
+	var reorg *ErrReorg
+	if errors.As(err, &reorg) {
+		log.Default.With("Block Number", reorg.AtBlock, "Expected Parent", reorg.ExpectedParent,
+			"Got Parent", reorg.GotParent).Error("Chain reorganisation detected")
+	}
+	return blockIterator, lastBlockHash, 0, err
+}
+
+// startBackfill stops flushing the commits of the database environment
+// one by one, if enabled, until endBackfill is called.
+func (s *Synchronizer) startBackfill() {
+	if !s.backfillSafeNoSync {
+		return
+	}
+	env, err := db.GetMDBXEnv()
+	if err != nil {
+		// notest
+		return
+	}
+	period := s.backfillSyncPeriod
+	if period <= 0 {
+		period = defaultBackfillSyncPeriod
+	}
+	if err := db.SetSafeNoSync(env, period); err != nil {
+		log.Default.With("Error", err).Warn("Couldn't stop flushing every commit during the backfill")
+		return
+	}
+	s.noSync = true
+	log.Default.With("Sync Period", period).Info("Flushing the commits periodically until the sync catches up")
+}
+
+// endBackfill flushes the commits not flushed yet and makes every
+// following commit flushed, if startBackfill stopped it.
+func (s *Synchronizer) endBackfill() {
+	if !s.noSync {
+		return
+	}
+	env, err := db.GetMDBXEnv()
+	if err != nil {
+		// notest
+		return
+	}
+	if err := db.SetDurable(env); err != nil {
+		log.Default.With("Error", err).Error("Couldn't flush the commits of the backfill")
+		return
+	}
+	s.noSync = false
+	log.Default.Info("Sync caught up, flushing every commit")
+}
+
+// pollBackoff is the wait between polls of the feeder gateway once the
+// API sync is synced. It starts at minPollInterval after a new block, so
+// that the next one is picked up quickly, and doubles on every poll that
+// finds no new block up to the configured interval.
+type pollBackoff struct {
+	max, next time.Duration
+}
+
+// newPollBackoff returns a pollBackoff that waits at most max. If max is
+// not positive, defaultPollInterval is used.
+func newPollBackoff(max time.Duration) *pollBackoff {
+	if max <= 0 {
+		max = defaultPollInterval
+	}
+	b := &pollBackoff{max: max}
+	b.reset()
+	return b
+}
+
+// idle returns how long to wait after a poll that found no new block.
+func (b *pollBackoff) idle() time.Duration {
+	wait := b.next
+	if b.next *= 2; b.next > b.max {
+		b.next = b.max
+	}
+	return wait
+}
+
+// reset makes the next wait the shortest one, after a new block.
+func (b *pollBackoff) reset() {
+	b.next = minPollInterval
+	if b.next > b.max {
+		b.next = b.max
 	}
 }
 
 // updateStateForOneBlock will fetch state transition from the feeder
-// gateway and apply it to the local state.
+// gateway and apply it to the local state. If the block does not build
+// on top of the local state, an *ErrReorg is returned and nothing is
+// applied. If the block is pending, errBlockPending is returned, and if
+// its state update couldn't be fetched, an errFetchStateUpdate.
 // notest
-func (s *Synchronizer) updateStateForOneBlock(blockIterator uint64, lastBlockHash string) (uint64, string) {
+func (s *Synchronizer) updateStateForOneBlock(blockIterator uint64, lastBlockHash string) (uint64, string, error) {
 	log.Default.With("Number", blockIterator).Info("Updating StarkNet State")
-	var update *feeder.StateUpdateResponse
-	var err error
-	if s.chainID == 1 {
-		update, err = s.feederGatewayClient.GetStateUpdate("", strconv.FormatUint(blockIterator, 10))
-		if err != nil {
-			log.Default.With("Error", err).Info("Couldn't get state update")
-			return blockIterator, lastBlockHash
-		}
-	} else {
-		update, err = s.feederGatewayClient.GetStateUpdateGoerli("", strconv.FormatUint(blockIterator, 10))
-		if err != nil {
-			log.Default.With("Error", err).Info("Couldn't get state update")
-			return blockIterator, lastBlockHash
-		}
+	update, block, err := s.getStateUpdate(blockIterator)
+	if err != nil {
+		return blockIterator, lastBlockHash, fmt.Errorf("%w of block %d: %v", errFetchStateUpdate, blockIterator, err)
 	}
 	if lastBlockHash == update.BlockHash || update.BlockHash == "" || update.NewRoot == "" {
 		log.Default.With("Block Number", blockIterator).Info("Block is pending ...")
-		return blockIterator, lastBlockHash
+		return blockIterator, lastBlockHash, errBlockPending
+	}
+	if err := s.checkParent(blockIterator, update, block, lastBlockHash); err != nil {
+		return blockIterator, lastBlockHash, err
 	}
 	log.Default.With("Block Hash", update.BlockHash, "New Root", update.NewRoot, "Old Root", update.OldRoot).
 		Info("Updating state")
 
-	upd := stateUpdateResponseToStateDiff(*update)
+	upd, err := stateUpdateResponseToStateDiff(*update)
+	if err != nil {
+		return blockIterator, lastBlockHash, fmt.Errorf("state update of block %d: %w", blockIterator, err)
+	}
+	if s.prefetching() {
+		s.prefetchStateDiff(&upd)
+	}
 
-	s.updateAndCommitState(&upd, update.NewRoot, blockIterator)
+	if _, err := s.updateAndCommitState(s.ctx, &upd, update.OldRoot, update.NewRoot, blockIterator); err != nil {
+		return blockIterator, lastBlockHash, err
+	}
 
 	// Update services
-	go s.updateServices(upd, update.BlockHash, strconv.FormatUint(blockIterator, 10))
+	blockNumber := strconv.FormatUint(blockIterator, 10)
+	s.goRecovered("service update", func() {
+		s.updateServices(upd, block, update.BlockHash, blockNumber)
+	})
+
+	return blockIterator + 1, update.BlockHash, nil
+}
 
-	return blockIterator + 1, update.BlockHash
+// checkStartBlock checks that the imported state is the one the start
+// block is applied on, and records it as the latest state root so the
+// following blocks are checked against it.
+func (s *Synchronizer) checkStartBlock() error {
+	update, _, err := s.getStateUpdate(s.startBlock)
+	if err != nil {
+		// notest
+		return fmt.Errorf("couldn't get the state update of start block %d: %w", s.startBlock, err)
+	}
+	return s.stateDatabase.RunTxn(func(txn db.DatabaseOperations) error {
+		stateTrie := newTrie(txn, "state_trie_")
+		root := stateTrie.Commitment()
+		if root.Sign() == 0 {
+			return fmt.Errorf("start block %d requires the state as of block %d to be imported", s.startBlock, s.startBlock-1)
+		}
+		if err := checkOldRoot(txn, update.OldRoot); err != nil {
+			return fmt.Errorf("imported state doesn't match start block %d: %w", s.startBlock, err)
+		}
+		log.Default.With("Start Block", s.startBlock, "State Root", root.Text(16)).
+			Info("Starting from the imported state")
+		return putLatestStateRoot(txn, localTypes.BigToFelt(root), s.startBlock-1)
+	})
+}
+
+// Rewind restores the local state to the one committed by block toBlock
+// and removes the blocks and transactions stored after it, so that the
+// sync resumes from toBlock + 1. Tries only keep their latest nodes, so
+// the storage slots updated after toBlock are reset to their values at
+// toBlock, fetched from the feeder gateway, the contracts whose class
+// changed after toBlock get their class hash at toBlock back, and the
+// contracts deployed after toBlock are removed. What the blocks after
+// toBlock changed is read from their retained state diffs, if any, and
+// the retained state diffs are removed along with them. Nothing is
+// changed in the state unless the resulting state root matches the one
+// of toBlock. The ABI, code and contract hash of the removed contracts
+// are kept; they are the same when the blocks are synced again. It must
+// not be called while the Synchronizer is running.
+func (s *Synchronizer) Rewind(toBlock uint64) error {
+	next, err := getNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced)
+	if err != nil {
+		// notest
+		return err
+	}
+	if toBlock+1 >= next {
+		return fmt.Errorf("block %d is not before the latest block synced", toBlock)
+	}
+	target, _, err := s.getStateUpdate(toBlock)
+	if err != nil {
+		// notest
+		return fmt.Errorf("couldn't get the state update of block %d: %w", toBlock, err)
+	}
+
+	// Collect what the blocks after toBlock changed. A contract in the
+	// deployed contracts of a block is either new or got a new class.
+	deployed := make(map[localTypes.Felt]bool)
+	updated := make(map[localTypes.Felt]map[localTypes.Felt]bool)
+	for blockNumber := toBlock + 1; blockNumber < next; blockNumber++ {
+		stateDiff, err := s.appliedStateDiff(blockNumber)
+		if err != nil {
+			// notest
+			return err
+		}
+		for _, contract := range stateDiff.DeployedContracts {
+			address, _ := localTypes.FeltFromHex(contract.Address)
+			deployed[address] = true
+		}
+		stateDiff.StorageDiffs.Range(func(address localTypes.Felt, kvs []starknetTypes.KV) bool {
+			if updated[address] == nil {
+				updated[address] = make(map[localTypes.Felt]bool)
+			}
+			for _, kv := range kvs {
+				key, _ := localTypes.FeltFromHex(kv.Key)
+				updated[address][key] = true
+			}
+			return true
+		})
+	}
+
+	// Find the class hash at toBlock of the contracts that already existed,
+	// leaving the new ones in deployed.
+	contractHashes := make(map[localTypes.Felt]*big.Int)
+	for address := range deployed {
+		contractHash, err := services.ContractHashService.GetContractHashAt(remove0x(address.Hex()), toBlock)
+		if errors.Is(err, services.ErrUnknownContractHash) {
+			continue
+		}
+		if err != nil {
+			// notest
+			return fmt.Errorf("couldn't get the class hash of contract %s at block %d: %w", address, toBlock, err)
+		}
+		contractHashes[address] = contractHash
+		delete(deployed, address)
+	}
+	for address := range updated {
+		if deployed[address] || contractHashes[address] != nil {
+			continue
+		}
+		contractHash, err := services.ContractHashService.GetContractHashAt(remove0x(address.Hex()), toBlock)
+		if err != nil {
+			// notest
+			return fmt.Errorf("couldn't get the class hash of contract %s at block %d: %w", address, toBlock, err)
+		}
+		contractHashes[address] = contractHash
+	}
+
+	// Fetch the storage at toBlock before the transaction is opened, so it
+	// isn't held open during the requests.
+	number := strconv.FormatUint(toBlock, 10)
+	values := make(map[localTypes.Felt]map[localTypes.Felt]*big.Int)
+	for address, keys := range updated {
+		if deployed[address] {
+			continue
+		}
+		values[address] = make(map[localTypes.Felt]*big.Int, len(keys))
+		for key := range keys {
+			info, err := s.feederGatewayClient.GetStorageAt(address.Hex(), key.Big().Text(10), "", number)
+			if err != nil {
+				// notest
+				return fmt.Errorf("couldn't get storage %s of contract %s: %w", key, address, err)
+			}
+			value, err := localTypes.FeltFromHex(string(*info))
+			if err != nil {
+				// notest
+				return fmt.Errorf("storage %s of contract %s: %w", key, address, err)
+			}
+			values[address][key] = value.Big()
+		}
+	}
+
+	err = s.stateDatabase.RunTxn(func(txn db.DatabaseOperations) error {
+		stateTrie := newTrie(txn, "state_trie_")
+		for address, contractHash := range contractHashes {
+			storageTrie := newTrie(txn, remove0x(address.Hex()))
+			for key, value := range values[address] {
+				storageTrie.Put(key.Big(), value)
+			}
+			storageRoot := storageTrie.Commitment()
+			if err := storageTrie.Err(); err != nil {
+				return fmt.Errorf("storage of contract %s: %w", address, err)
+			}
+			if err := putContractState(txn, stateTrie, address.Big(), contractHash, storageRoot); err != nil {
+				return err
+			}
+		}
+		for address := range deployed {
+			storageTrie := newTrie(txn, remove0x(address.Hex()))
+			for key := range updated[address] {
+				storageTrie.Delete(key.Big())
+			}
+			storageTrie.Commitment()
+			if err := storageTrie.Err(); err != nil {
+				return fmt.Errorf("storage of contract %s: %w", address, err)
+			}
+			if err := deleteContractState(txn, stateTrie, address.Big()); err != nil {
+				return err
+			}
+		}
+		root := stateTrie.Commitment()
+		if err := stateTrie.Err(); err != nil {
+			return fmt.Errorf("state trie: %w", err)
+		}
+		if remove0x(root.Text(16)) != remove0x(target.NewRoot) {
+			return fmt.Errorf("%w: rewound state root is 0x%s, block %d root is %s",
+				errStateRootMismatch, root.Text(16), toBlock, target.NewRoot)
+		}
+		if err := putLatestStateRoot(txn, localTypes.BigToFelt(root), toBlock); err != nil {
+			// notest
+			return err
+		}
+		for blockNumber := toBlock + 1; blockNumber < next; blockNumber++ {
+			if err := deleteStateDiff(txn, blockNumber); err != nil {
+				// notest
+				return err
+			}
+		}
+		return s.putLatestBlockSynced(txn, toBlock)
+	})
+	if err != nil {
+		return err
+	}
+	s.storageRoots.clear()
+
+	// The following blocks change the classes again when they are synced.
+	for address, contractHash := range contractHashes {
+		formattedAddress := remove0x(address.Hex())
+		services.ContractHashService.StoreContractHash(formattedAddress, contractHash)
+		services.ContractHashService.DeleteClassChangesAfter(formattedAddress, toBlock)
+		services.ContractHashService.DeleteContractHashesAfter(formattedAddress, toBlock)
+	}
+	for address := range deployed {
+		services.ContractHashService.DeleteContractHash(remove0x(address.Hex()))
+	}
+	services.StateService.DeleteDeployedContractsAfter(toBlock)
+
+	for blockNumber := toBlock + 1; blockNumber < next; blockNumber++ {
+		block := services.BlockService.DeleteBlock(blockNumber)
+		if block == nil {
+			continue
+		}
+		for _, txHash := range block.TxHashes {
+			services.TransactionService.DeleteTransaction(txHash)
+		}
+	}
+	log.Default.With("Block Number", toBlock, "State Root", target.NewRoot).Info("Rewound state")
+	if s.stateDatabase == s.database {
+		return nil
+	}
+	return updateNumericValueFromDB(s.database, starknetTypes.LatestBlockSynced, toBlock)
+}
+
+// checkParent returns an *ErrReorg if the block with the given number
+// does not build on top of the local state: either its parent is not the
+// last block applied, or its old root is not the latest committed state
+// root. The parent hash is only checked if both the block and the hash
+// of the last block applied are known, and the old root only if the old
+// root check is enabled.
+func (s *Synchronizer) checkParent(
+	blockNumber uint64,
+	update *feeder.StateUpdateResponse,
+	block *feeder.StarknetBlock,
+	lastBlockHash string,
+) error {
+	if block != nil && lastBlockHash != "" && remove0x(block.ParentBlockHash) != remove0x(lastBlockHash) {
+		return &ErrReorg{AtBlock: blockNumber, ExpectedParent: lastBlockHash, GotParent: block.ParentBlockHash}
+	}
+	if !s.verifyOldRoot || update.OldRoot == "" {
+		return nil
+	}
+	localRoot := "0x0"
+	root, _, err := s.LatestStateRoot()
+	switch {
+	case err == nil:
+		localRoot = root.Hex()
+	case errors.Is(err, ErrNoStateRoot) && blockNumber > 0:
+		// The state was committed before its root was stored, so there
+		// is nothing to compare with.
+		// notest
+		return nil
+	case !errors.Is(err, ErrNoStateRoot):
+		// notest
+		return err
+	}
+	if remove0x(update.OldRoot) != remove0x(localRoot) {
+		return &ErrReorg{AtBlock: blockNumber, ExpectedParent: localRoot, GotParent: update.OldRoot}
+	}
+	return nil
+}
+
+// getStateUpdate fetches the state update of the given block from the
+// feeder gateway. The combined state update and block endpoint is tried
+// first; if it fails or does not include the block, the state update is
+// fetched on its own and the returned block is nil, so it has to be
+// fetched separately. A gateway that doesn't support the combined
+// endpoint answers it without the block, so once it does for a block that
+// exists, the endpoint isn't tried again.
+func (s *Synchronizer) getStateUpdate(blockNumber uint64) (*feeder.StateUpdateResponse, *feeder.StarknetBlock, error) {
+	number := strconv.FormatUint(blockNumber, 10)
+	withoutBlock := false
+	if atomic.LoadInt32(&s.noCombinedStateUpdate) == 0 {
+		combined, err := s.feederGatewayClient.GetStateUpdateWithBlock(number)
+		if err != nil {
+			s.combinedStateUpdateFailed(err)
+		} else {
+			atomic.StoreInt32(&s.combinedStateUpdateErrors, 0)
+		}
+		if err == nil && combined.Block.BlockHash != "" {
+			if err := s.checkStateUpdate(blockNumber, &combined.StateUpdate); err != nil {
+				return nil, nil, err
+			}
+			return &combined.StateUpdate, &combined.Block, nil
+		}
+		withoutBlock = err == nil
+		log.Default.With("Block Number", blockNumber).
+			Debug("Combined state update not available, falling back to separate requests")
+	}
+
+	var update *feeder.StateUpdateResponse
+	var err error
+	if s.chainID == 1 {
+		update, err = s.feederGatewayClient.GetStateUpdate("", number)
+	} else {
+		update, err = s.feederGatewayClient.GetStateUpdateGoerli("", number)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkStateUpdate(blockNumber, update); err != nil {
+		return nil, nil, err
+	}
+	if withoutBlock && update.BlockHash != "" {
+		atomic.StoreInt32(&s.noCombinedStateUpdate, 1)
+		log.Default.Info("The feeder gateway doesn't support combined state updates, using separate requests from now on")
+	}
+	return update, nil, nil
+}
+
+// combinedStateUpdateFailed counts a failure of the combined state update
+// and block endpoint, and gives it up after maxCombinedStateUpdateErrors
+// in a row.
+func (s *Synchronizer) combinedStateUpdateFailed(err error) {
+	if atomic.AddInt32(&s.combinedStateUpdateErrors, 1) < maxCombinedStateUpdateErrors {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.noCombinedStateUpdate, 0, 1) {
+		log.Default.With("Error", err, "Failures", maxCombinedStateUpdateErrors).
+			Warn("The combined state update keeps failing, using separate requests from now on")
+	}
+}
+
+// checkStateUpdate checks that the hashes and roots of a state update
+// from the feeder gateway are felts in hex, or empty while the block is
+// pending. Otherwise, the raw update is logged, the gateway is reported
+// so the next one is used, and an error is returned for the block to be
+// fetched again.
+func (s *Synchronizer) checkStateUpdate(blockNumber uint64, update *feeder.StateUpdateResponse) error {
+	err := validateStateUpdate(update)
+	if err == nil {
+		return nil
+	}
+	payload, _ := json.Marshal(update)
+	log.Default.With("Error", err, "Block Number", blockNumber, "Payload", string(payload)).
+		Warn("Malformed state update from the feeder gateway")
+	s.feederGatewayClient.ReportInvalidResponse()
+	return fmt.Errorf("malformed state update of block %d: %w", blockNumber, err)
+}
+
+// validateStateUpdate checks that the block hash and the roots of update
+// are either empty or felts in hex.
+func validateStateUpdate(update *feeder.StateUpdateResponse) error {
+	for _, field := range [...]struct{ name, value string }{
+		{"block hash", update.BlockHash},
+		{"new root", update.NewRoot},
+		{"old root", update.OldRoot},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if _, err := localTypes.FeltFromHex(field.value); err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+// dictKey returns the key of a hash, such as a fact or a memory page
+// hash, in the dictionaries of the sync. It is the canonical hexadecimal
+// form of the hash as a Felt, without leading zeros, so equal numbers
+// always give the same key whatever their byte representation.
+func dictKey(hash []byte) string {
+	return localTypes.BytesToFelt(hash).Hex()
+}
+
+// storedDictKey returns the key the hash is stored under in dict. Older
+// databases keyed the dictionaries by the zero-padded hexadecimal form
+// of the hash, so that key is returned if the entry is only stored under
+// it. Otherwise, it returns dictKey(hash).
+func storedDictKey(dict *starknetTypes.Dictionary, hash []byte) string {
+	key := dictKey(hash)
+	if dict.Exist(key) {
+		return key
+	}
+	if legacyKey := common.BytesToHash(hash).Hex(); dict.Exist(legacyKey) {
+		return legacyKey
+	}
+	return key
 }
 
 // processPagesHashes takes an array of arrays of pages' hashes and
-// converts them into memory pages by querying an ethereum client.
+// converts them into memory pages by querying an ethereum client. It
+// also returns the hashes of the transactions that registered the
+// pages, without duplicates.
 // notest
-func (s *Synchronizer) processPagesHashes(pagesHashes [][32]byte, memoryContract ethAbi.ABI) [][]*big.Int {
+func (s *Synchronizer) processPagesHashes(pagesHashes [][32]byte, memoryContract ethAbi.ABI) ([][]*big.Int, []common.Hash) {
 	pages := make([][]*big.Int, 0)
+	txHashes := make([]common.Hash, 0)
 	for _, v := range pagesHashes {
 		// Get transactionsHash based on the memory page
-		hash := common.BytesToHash(v[:])
-		transactionHash, err := s.memoryPageHash.Get(hash.Hex(), starknetTypes.TransactionHash{})
+		transactionHash, err := s.memoryPageHash.Get(storedDictKey(s.memoryPageHash, v[:]), starknetTypes.TransactionHash{})
 		if err != nil {
-			return nil
+			return nil, nil
 		}
 		txHash := transactionHash.(starknetTypes.TransactionHash).Hash
 		log.Default.With("Hash", txHash.Hex()).Info("Getting transaction...")
@@ -520,7 +1899,10 @@ func (s *Synchronizer) processPagesHashes(pagesHashes [][32]byte, memoryContract
 		if err != nil {
 			log.Default.With("Error", err, "Transaction Hash", v).
 				Error("Couldn't retrieve transactions")
-			return nil
+			return nil, nil
+		}
+		if len(txHashes) == 0 || txHashes[len(txHashes)-1] != txHash {
+			txHashes = append(txHashes, txHash)
 		}
 
 		// Parse Ethereum transaction calldata for Starknet transaction information
@@ -529,43 +1911,91 @@ func (s *Synchronizer) processPagesHashes(pagesHashes [][32]byte, memoryContract
 		err = memoryContract.Methods["registerContinuousMemoryPage"].Inputs.UnpackIntoMap(inputs, data)
 		if err != nil {
 			log.Default.With("Error", err).Info("Couldn't unpack into map")
-			return nil
+			return nil, nil
 		}
 		// Append calldata to pages
 		pages = append(pages, inputs["values"].([]*big.Int))
 	}
-	return pages
+	return pages, txHashes
 }
 
+// updateServices stores the code, ABIs, block and transactions related
+// to the given state update. If block is nil, it is fetched from the
+// feeder gateway.
 // notest
-func (s *Synchronizer) updateServices(update starknetTypes.StateDiff, blockHash, blockNumber string) {
+func (s *Synchronizer) updateServices(update starknetTypes.StateDiff, block *feeder.StarknetBlock, blockHash, blockNumber string) {
 	s.updateAbiAndCode(update, blockHash, blockNumber)
-	s.updateBlocksAndTransactions(blockHash, blockNumber)
+	s.updateBlocksAndTransactions(block, blockHash, blockNumber)
 }
 
+// updateAbiAndCode fetches the code of the contracts deployed in the
+// block, with at most codeFetchLimit requests at a time, and stores their
+// ABI and code. Nothing is stored unless the code of every contract is
+// fetched.
 // notest
 func (s *Synchronizer) updateAbiAndCode(update starknetTypes.StateDiff, blockHash string, sequenceNumber string) {
-	for _, v := range update.DeployedContracts {
-		code, err := s.feederGatewayClient.GetCode(v.Address, blockHash, sequenceNumber)
-		if err != nil {
-			return
-		}
+	codes, err := s.fetchCodes(update.DeployedContracts, blockHash, sequenceNumber)
+	if err != nil {
+		log.Default.With("Error", err, "Block Number", sequenceNumber).
+			Error("Couldn't get the code of the deployed contracts")
+		return
+	}
+	for i, v := range update.DeployedContracts {
 		// Save the ABI
-		services.AbiService.StoreAbi(remove0x(v.Address), toDbAbi(code.Abi))
+		services.AbiService.StoreAbi(remove0x(v.Address), toDbAbi(codes[i].Abi))
 		// Save the contract code
-		services.StateService.StoreCode(common.Hex2Bytes(remove0x(v.Address)), byteCodeToStateCode(code.Bytecode))
+		services.StateService.StoreCode(common.Hex2Bytes(remove0x(v.Address)), byteCodeToStateCode(codes[i].Bytecode))
+	}
+}
+
+// fetchCodes gets the code of the given contracts from the feeder
+// gateway, with at most codeFetchLimit requests at a time. The codes are
+// returned in the same order as the contracts. If any request fails, the
+// first error is returned.
+func (s *Synchronizer) fetchCodes(
+	contracts []starknetTypes.DeployedContract,
+	blockHash, blockNumber string,
+) ([]*feeder.CodeInfo, error) {
+	limit := s.codeFetchLimit
+	if limit <= 0 {
+		limit = defaultCodeFetchLimit
+	}
+	codes := make([]*feeder.CodeInfo, len(contracts))
+	errs := make([]error, len(contracts))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, contract := range contracts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, address string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			codes[i], errs[i] = s.feederGatewayClient.GetCode(address, blockHash, blockNumber)
+		}(i, contract.Address)
 	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
 }
 
 // notest
-func (s *Synchronizer) updateBlocksAndTransactions(blockHash, blockNumber string) {
-	block, err := s.feederGatewayClient.GetBlock(blockHash, blockNumber)
-	if err != nil {
-		return
+func (s *Synchronizer) updateBlocksAndTransactions(block *feeder.StarknetBlock, blockHash, blockNumber string) {
+	if block == nil {
+		var err error
+		block, err = s.feederGatewayClient.GetBlock(blockHash, blockNumber)
+		if err != nil {
+			return
+		}
 	}
 	log.Default.With("Block Hash", block.BlockHash).
 		Info("Got block")
-	services.BlockService.StoreBlock(localTypes.BlockHash(localTypes.HexToFelt(block.BlockHash)), feederBlockToDBBlock(block))
+	s.storeBlock(feederBlockToDBBlock(block))
 
 	for _, bTxn := range block.Transactions {
 		transactionInfo, err := s.feederGatewayClient.GetTransaction(bTxn.TransactionHash, "")
@@ -579,10 +2009,83 @@ func (s *Synchronizer) updateBlocksAndTransactions(blockHash, blockNumber string
 	}
 }
 
+// startBlockBatch makes storeBlock keep the blocks and store them
+// blockBatchSize at a time, until endBlockBatch is called.
+func (s *Synchronizer) startBlockBatch() {
+	s.blocksMu.Lock()
+	defer s.blocksMu.Unlock()
+	s.batchBlocks = true
+}
+
+// endBlockBatch stores the blocks kept by storeBlock, and makes it store
+// the following ones right away.
+func (s *Synchronizer) endBlockBatch() {
+	s.blocksMu.Lock()
+	defer s.blocksMu.Unlock()
+	s.batchBlocks = false
+	s.flushBlocks()
+}
+
+// storeBlock stores the given block, or keeps it to be stored with the
+// following ones in one transaction during the backfill. The blocks kept
+// can't be read until they are stored, and aren't stored if the process
+// dies.
+func (s *Synchronizer) storeBlock(block *localTypes.Block) {
+	s.blocksMu.Lock()
+	defer s.blocksMu.Unlock()
+	if !s.batchBlocks {
+		services.BlockService.StoreBlock(block.BlockHash, block)
+		return
+	}
+	s.blocks = append(s.blocks, block)
+	if len(s.blocks) >= blockBatchSize {
+		s.flushBlocks()
+	}
+}
+
+// flushBlocks stores the blocks kept by storeBlock. It must be called with
+// blocksMu held.
+func (s *Synchronizer) flushBlocks() {
+	if len(s.blocks) == 0 {
+		return
+	}
+	if err := services.BlockService.StoreBlocks(s.blocks); err != nil {
+		log.Default.With("Error", err, "Blocks", len(s.blocks)).Error("Couldn't store the blocks")
+	}
+	s.blocks = nil
+}
+
+// errTruncatedPages is returned by parsePages when the memory pages end
+// before the state diff they hold.
+var errTruncatedPages = errors.New("memory pages end before the state diff")
+
+// errPagesBlockMismatch is returned by parsePages when the first memory
+// page is of another block than the expected one, which means the pages
+// were put together from the wrong fact.
+var errPagesBlockMismatch = errors.New("memory pages are of another block")
+
+// firstPageHeaderLen is the number of cells parsePages reads at the start
+// of the first memory page: the state root before the block, the state
+// root after it and the block number. The rest of the page, the messages
+// between the layers and, in later versions of the StarkNet OS, the hash
+// of its config, differs across versions and isn't read.
+const firstPageHeaderLen = 3
+
 // parsePages converts an array of memory pages into a state diff that
-// can be used to update the local state.
-func parsePages(pages [][]*big.Int) *starknetTypes.StateDiff {
-	// Remove first page
+// can be used to update the local state. The first page doesn't hold the
+// state diff, but its block number is checked against blockNumber.
+func parsePages(pages [][]*big.Int, blockNumber uint64) (*starknetTypes.StateDiff, error) {
+	if len(pages) < 1 {
+		return nil, errors.New("no memory pages")
+	}
+	firstPage := pages[0]
+	if len(firstPage) < firstPageHeaderLen {
+		return nil, fmt.Errorf("%w: the first page has %d cells, want at least %d",
+			errTruncatedPages, len(firstPage), firstPageHeaderLen)
+	}
+	if pagesBlock := firstPage[2]; !pagesBlock.IsUint64() || pagesBlock.Uint64() != blockNumber {
+		return nil, fmt.Errorf("%w: block %s, want %d", errPagesBlockMismatch, pagesBlock, blockNumber)
+	}
 	pagesWithoutFirst := pages[1:]
 
 	// Flatter the pages recovered from Layer 1
@@ -590,74 +2093,104 @@ func parsePages(pages [][]*big.Int) *starknetTypes.StateDiff {
 	for _, page := range pagesWithoutFirst {
 		pagesFlatter = append(pagesFlatter, page...)
 	}
+	// take consumes the next n cells of data.
+	take := func(data *[]*big.Int, n int64) ([]*big.Int, error) {
+		if n < 0 || n > int64(len(*data)) {
+			return nil, errTruncatedPages
+		}
+		cells := (*data)[:n]
+		*data = (*data)[n:]
+		return cells, nil
+	}
+	// count consumes the next cell of data as a number of items.
+	count := func(data *[]*big.Int) (int64, error) {
+		cells, err := take(data, 1)
+		if err != nil {
+			return 0, err
+		}
+		if !cells[0].IsInt64() {
+			return 0, errTruncatedPages
+		}
+		return cells[0].Int64(), nil
+	}
 
 	// Get the number of contracts deployed in this block
-	deployedContractsInfoLen := pagesFlatter[0].Int64()
-	pagesFlatter = pagesFlatter[1:]
+	deployedContractsInfoLen, err := count(&pagesFlatter)
+	if err != nil {
+		return nil, err
+	}
 	deployedContracts := make([]starknetTypes.DeployedContract, 0)
 
 	// Get the info of the deployed contracts
-	deployedContractsData := pagesFlatter[:deployedContractsInfoLen]
+	deployedContractsData, err := take(&pagesFlatter, deployedContractsInfoLen)
+	if err != nil {
+		return nil, err
+	}
 
 	// Iterate while contains contract data to be processed
 	for len(deployedContractsData) > 0 {
-		// Parse the Address of the contract
-		address := common.Bytes2Hex(deployedContractsData[0].Bytes())
-		deployedContractsData = deployedContractsData[1:]
-
-		// Parse the ContractInfo Hash
-		contractHash := common.Bytes2Hex(deployedContractsData[0].Bytes())
-		deployedContractsData = deployedContractsData[1:]
+		// Parse the Address and the ContractInfo Hash of the contract
+		contract, err := take(&deployedContractsData, 2)
+		if err != nil {
+			return nil, err
+		}
 
 		// Parse the number of Arguments the constructor contains
-		constructorArgumentsLen := deployedContractsData[0].Int64()
-		deployedContractsData = deployedContractsData[1:]
+		constructorArgumentsLen, err := count(&deployedContractsData)
+		if err != nil {
+			return nil, err
+		}
 
 		// Parse constructor arguments
-		constructorArguments := make([]*big.Int, 0)
-		for i := int64(0); i < constructorArgumentsLen; i++ {
-			constructorArguments = append(constructorArguments, deployedContractsData[0])
-			deployedContractsData = deployedContractsData[1:]
+		constructorArguments, err := take(&deployedContractsData, constructorArgumentsLen)
+		if err != nil {
+			return nil, err
 		}
 
 		// Store deployed ContractInfo information
 		deployedContracts = append(deployedContracts, starknetTypes.DeployedContract{
-			Address:             address,
-			ContractHash:        contractHash,
-			ConstructorCallData: constructorArguments,
+			Address:             common.Bytes2Hex(contract[0].Bytes()),
+			ContractHash:        common.Bytes2Hex(contract[1].Bytes()),
+			ConstructorCallData: append([]*big.Int{}, constructorArguments...),
 		})
 	}
-	pagesFlatter = pagesFlatter[deployedContractsInfoLen:]
 
 	// Parse the number of contracts updates
-	numContractsUpdate := pagesFlatter[0].Int64()
-	pagesFlatter = pagesFlatter[1:]
+	numContractsUpdate, err := count(&pagesFlatter)
+	if err != nil {
+		return nil, err
+	}
 
-	storageDiffs := make(map[string][]starknetTypes.KV, 0)
+	stateDiff := &starknetTypes.StateDiff{DeployedContracts: deployedContracts}
 
 	// Iterate over all the contracts that had been updated and collect the needed information
 	for i := int64(0); i < numContractsUpdate; i++ {
 		// Parse the Address of the contract
-		address := common.Bytes2Hex(pagesFlatter[0].Bytes())
-		pagesFlatter = pagesFlatter[1:]
+		cells, err := take(&pagesFlatter, 1)
+		if err != nil {
+			return nil, err
+		}
+		address := localTypes.BigToFelt(cells[0])
 
 		// Parse the number storage updates
-		numStorageUpdates := pagesFlatter[0].Int64()
-		pagesFlatter = pagesFlatter[1:]
+		numStorageUpdates, err := count(&pagesFlatter)
+		if err != nil {
+			return nil, err
+		}
+		updates, err := take(&pagesFlatter, 2*numStorageUpdates)
+		if err != nil {
+			return nil, err
+		}
 
 		kvs := make([]starknetTypes.KV, 0)
-		for k := int64(0); k < numStorageUpdates; k++ {
+		for k := 0; k < len(updates); k += 2 {
 			kvs = append(kvs, starknetTypes.KV{
-				Key:   common.Bytes2Hex(pagesFlatter[0].Bytes()),
-				Value: common.Bytes2Hex(pagesFlatter[1].Bytes()),
+				Key:   common.Bytes2Hex(updates[k].Bytes()),
+				Value: common.Bytes2Hex(updates[k+1].Bytes()),
 			})
-			pagesFlatter = pagesFlatter[2:]
 		}
-		storageDiffs[address] = kvs
+		stateDiff.StorageDiffs.Put(address, kvs)
 	}
 
-	return &starknetTypes.StateDiff{
-		DeployedContracts: deployedContracts,
-		StorageDiffs:      storageDiffs,
-	}
+	return stateDiff, nil
 }
@@ -2,17 +2,21 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
 
+	"github.com/NethermindEth/juno/pkg/types"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 )
 
 const (
 	LatestBlockSynced                        = "latestBlockSynced"
+	LatestStateRoot                          = "latestStateRoot"
+	StateDbLayout                            = "stateDbLayout"
 	BlockOfStarknetDeploymentContractMainnet = 13627000
 	BlockOfStarknetDeploymentContractGoerli  = 5853000
-	MaxChunk                                 = 10000
 
 	MemoryPagesContractAddressMainnet = "0x96375087b2f6efc59e5e0dd5111b4d090ebfdd8b"
 	MemoryPagesContractAddressGoerli  = "0x743789ff2ff82bfb907009c9911a7da636d34fa7"
@@ -35,21 +39,115 @@ type DeployedContract struct {
 }
 
 // StateDiff Represent the deployed contracts and the storage diffs for those and
-// for the one's already deployed
+// for the one's already deployed. The storage diffs are keyed by contract
+// address and iterated in address order.
 type StateDiff struct {
-	DeployedContracts []DeployedContract `json:"deployed_contracts"`
-	StorageDiffs      map[string][]KV    `json:"storage_diffs"`
+	DeployedContracts []DeployedContract  `json:"deployed_contracts"`
+	StorageDiffs      types.FeltMap[[]KV] `json:"-"`
 }
 
-// ContractInfo represent the info associated to one contract
+var (
+	// ErrMissingContractHash is returned by StateDiff.Validate when a
+	// deployed contract has no contract hash.
+	ErrMissingContractHash = errors.New("missing contract hash")
+	// ErrMissingAddress is returned by StateDiff.Validate when a deployed
+	// contract has no address.
+	ErrMissingAddress = errors.New("missing address")
+)
+
+// Validate checks that every address, contract hash, storage key and
+// storage value in the diff is a well-formed hexadecimal felt, so that a
+// malformed diff is rejected before any of it is applied. The addresses
+// of the storage diffs are felts already.
+func (d *StateDiff) Validate() error {
+	for i, contract := range d.DeployedContracts {
+		if contract.Address == "" {
+			return fmt.Errorf("deployed contract %d: %w", i, ErrMissingAddress)
+		}
+		if _, err := types.FeltFromHex(contract.Address); err != nil {
+			return fmt.Errorf("address of deployed contract %d: %w", i, err)
+		}
+		if contract.ContractHash == "" {
+			return fmt.Errorf("deployed contract %s: %w", contract.Address, ErrMissingContractHash)
+		}
+		if _, err := types.FeltFromHex(contract.ContractHash); err != nil {
+			return fmt.Errorf("contract hash of deployed contract %s: %w", contract.Address, err)
+		}
+	}
+	var err error
+	d.StorageDiffs.Range(func(address types.Felt, kvs []KV) bool {
+		for _, kv := range kvs {
+			if _, err = types.FeltFromHex(kv.Key); err != nil {
+				err = fmt.Errorf("storage key of contract %s: %w", address, err)
+				return false
+			}
+			if _, err = types.FeltFromHex(kv.Value); err != nil {
+				err = fmt.Errorf("storage value of contract %s at %s: %w", address, kv.Key, err)
+				return false
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// MergeStateDiffs merges consecutive state diffs into a single one that
+// has the same effect when applied on the state the first diff applies
+// on. The deployed contracts are the union of the deployed contracts of
+// the diffs, in the order they are first deployed, with the contract hash
+// of the last deployment. Each storage slot takes the last value written
+// to it. The diffs must be valid; see StateDiff.Validate.
+func MergeStateDiffs(diffs ...StateDiff) StateDiff {
+	var merged StateDiff
+	deployed := make(map[types.Felt]int)
+	for _, diff := range diffs {
+		for _, contract := range diff.DeployedContracts {
+			address := types.HexToFelt(contract.Address)
+			if i, ok := deployed[address]; ok {
+				merged.DeployedContracts[i] = contract
+				continue
+			}
+			deployed[address] = len(merged.DeployedContracts)
+			merged.DeployedContracts = append(merged.DeployedContracts, contract)
+		}
+	}
+
+	// slots maps each contract to the index of each of its storage keys
+	// in the merged diff.
+	slots := make(map[types.Felt]map[types.Felt]int)
+	for _, diff := range diffs {
+		diff.StorageDiffs.Range(func(address types.Felt, kvs []KV) bool {
+			if slots[address] == nil {
+				slots[address] = make(map[types.Felt]int)
+			}
+			merging, _ := merged.StorageDiffs.Get(address)
+			for _, kv := range kvs {
+				key := types.HexToFelt(kv.Key)
+				if i, ok := slots[address][key]; ok {
+					merging[i] = kv
+					continue
+				}
+				slots[address][key] = len(merging)
+				merging = append(merging, kv)
+			}
+			merged.StorageDiffs.Put(address, merging)
+			return true
+		})
+	}
+	return merged
+}
+
+// ContractInfo represent the info associated to one contract and the
+// events tracked from it
 type ContractInfo struct {
-	Contract  abi.ABI
-	EventName string
-	Address   common.Address
+	Contract   abi.ABI
+	EventNames []string
+	Address    common.Address
 }
 
 // EventInfo represent the information retrieved from events that comes from L1
 type EventInfo struct {
+	Name            string
 	Block           uint64
 	Address         common.Address
 	Event           map[string]interface{}
@@ -89,6 +187,25 @@ func (t TransactionHash) UnMarshal(bytes []byte) (IValue, error) {
 	}, nil
 }
 
+// L1TransactionHashes are the hashes of the layer 1 transactions that
+// registered the memory pages of a block.
+type L1TransactionHashes struct {
+	Hashes []common.Hash
+}
+
+func (l L1TransactionHashes) Marshal() ([]byte, error) {
+	return json.Marshal(l.Hashes)
+}
+
+func (l L1TransactionHashes) UnMarshal(bytes []byte) (IValue, error) {
+	var val L1TransactionHashes
+	err := json.Unmarshal(bytes, &val.Hashes)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
 type PagesHash struct {
 	Bytes [][32]byte
 }
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/NethermindEth/juno/pkg/types"
+)
+
+// storageDiffs returns the storage diffs of a single contract with the
+// given slots.
+func storageDiffs(kvs ...KV) types.FeltMap[[]KV] {
+	var m types.FeltMap[[]KV]
+	m.Put(types.HexToFelt("0x1"), kvs)
+	return m
+}
+
+func TestStateDiffValidate(t *testing.T) {
+	tests := [...]struct {
+		name string
+		diff StateDiff
+		want error
+	}{
+		{
+			name: "valid",
+			diff: StateDiff{
+				DeployedContracts: []DeployedContract{{Address: "0x1", ContractHash: "0x2"}},
+				StorageDiffs:      storageDiffs(KV{Key: "0x3", Value: "0x4"}),
+			},
+		},
+		{
+			name: "empty",
+			diff: StateDiff{},
+		},
+		{
+			name: "missing deployed address",
+			diff: StateDiff{DeployedContracts: []DeployedContract{{ContractHash: "0x2"}}},
+			want: ErrMissingAddress,
+		},
+		{
+			name: "missing contract hash",
+			diff: StateDiff{DeployedContracts: []DeployedContract{{Address: "0x1"}}},
+			want: ErrMissingContractHash,
+		},
+		{
+			name: "invalid contract hash",
+			diff: StateDiff{DeployedContracts: []DeployedContract{{Address: "0x1", ContractHash: "0xz"}}},
+			want: types.ErrInvalidFeltHex,
+		},
+		{
+			name: "invalid storage key",
+			diff: StateDiff{StorageDiffs: storageDiffs(KV{Key: "key", Value: "0x4"})},
+			want: types.ErrInvalidFeltHex,
+		},
+		{
+			name: "storage value out of range",
+			diff: StateDiff{StorageDiffs: storageDiffs(KV{
+				Key:   "0x3",
+				Value: "0x800000000000011000000000000000000000000000000000000000000000001",
+			})},
+			want: types.ErrFeltOutOfRange,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.diff.Validate()
+			if test.want == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, test.want) {
+				t.Errorf("got error %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeStateDiffs(t *testing.T) {
+	var first, second StateDiff
+	first.DeployedContracts = []DeployedContract{{Address: "0x1", ContractHash: "0xa"}, {Address: "0x2", ContractHash: "0xb"}}
+	first.StorageDiffs.Put(types.HexToFelt("0x1"), []KV{{Key: "0x5", Value: "0x1"}, {Key: "0x6", Value: "0x2"}})
+	second.DeployedContracts = []DeployedContract{{Address: "0x3", ContractHash: "0xc"}, {Address: "0x01", ContractHash: "0xd"}}
+	second.StorageDiffs.Put(types.HexToFelt("0x1"), []KV{{Key: "0x05", Value: "0x0"}, {Key: "0x7", Value: "0x3"}})
+	second.StorageDiffs.Put(types.HexToFelt("0x2"), []KV{{Key: "0x5", Value: "0x4"}})
+
+	merged := MergeStateDiffs(first, second)
+
+	wantDeployed := []DeployedContract{
+		{Address: "0x01", ContractHash: "0xd"},
+		{Address: "0x2", ContractHash: "0xb"},
+		{Address: "0x3", ContractHash: "0xc"},
+	}
+	if !reflect.DeepEqual(merged.DeployedContracts, wantDeployed) {
+		t.Errorf("merged deployed contracts = %v, want %v", merged.DeployedContracts, wantDeployed)
+	}
+	wantStorage := map[string][]KV{
+		"0x1": {{Key: "0x05", Value: "0x0"}, {Key: "0x6", Value: "0x2"}, {Key: "0x7", Value: "0x3"}},
+		"0x2": {{Key: "0x5", Value: "0x4"}},
+	}
+	if merged.StorageDiffs.Len() != len(wantStorage) {
+		t.Errorf("merged storage diffs of %d contracts, want %d", merged.StorageDiffs.Len(), len(wantStorage))
+	}
+	for address, want := range wantStorage {
+		got, _ := merged.StorageDiffs.Get(types.HexToFelt(address))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("merged storage diff of %s = %v, want %v", address, got, want)
+		}
+	}
+
+	// The merged diff doesn't share memory with the merged ones.
+	kvs, _ := first.StorageDiffs.Get(types.HexToFelt("0x1"))
+	if kvs[0].Value != "0x1" {
+		t.Errorf("merging changed the first diff: %v", kvs)
+	}
+	if got := MergeStateDiffs(); got.DeployedContracts != nil || got.StorageDiffs.Len() != 0 {
+		t.Errorf("MergeStateDiffs() = %v, want an empty diff", got)
+	}
+}
@@ -1,9 +1,13 @@
 package starknet
 
 import (
-	"bytes"
+	"container/list"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"math/big"
 	"strings"
 
@@ -11,6 +15,9 @@ import (
 	dbAbi "github.com/NethermindEth/juno/internal/db/abi"
 	"github.com/NethermindEth/juno/internal/db/state"
 	"github.com/NethermindEth/juno/internal/log"
+	metr "github.com/NethermindEth/juno/internal/metrics/prometheus"
+	"github.com/NethermindEth/juno/internal/services"
+	"github.com/NethermindEth/juno/pkg/crypto/keccak"
 	"github.com/NethermindEth/juno/pkg/crypto/pedersen"
 	"github.com/NethermindEth/juno/pkg/feeder"
 	feederAbi "github.com/NethermindEth/juno/pkg/feeder/abi"
@@ -19,28 +26,333 @@ import (
 	"github.com/NethermindEth/juno/pkg/types"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
-// newTrie returns a new Trie
-func newTrie(database db.DatabaseOperations, prefix string) trie.Trie {
+// errStateRootMismatch is returned by updateState when the computed state
+// commitment differs from the state root provided.
+var errStateRootMismatch = errors.New("state root mismatch")
+
+// ErrNoStateRoot is returned when no block has been committed yet.
+var ErrNoStateRoot = errors.New("no state root has been committed")
+
+// ErrNoL1Transactions is returned by L1TxForBlock when the layer 1
+// transactions of a block weren't recorded.
+var ErrNoL1Transactions = errors.New("no layer 1 transactions recorded")
+
+// errOldRootMismatch is returned by checkOldRoot when the root of the
+// local state differs from the old root of the block being applied.
+var errOldRootMismatch = errors.New("old state root mismatch")
+
+// ErrStateDbLayoutMismatch is returned by UpdateState when the state is
+// stored in the other database than the one SeparateStateDb sets.
+var ErrStateDbLayoutMismatch = errors.New("state database layout mismatch")
+
+// errBlockPending is returned by updateStateForOneBlock when the block
+// isn't out yet, so the API sync is at the tip of the chain.
+var errBlockPending = errors.New("block is pending")
+
+// errFetchStateUpdate is returned by updateStateForOneBlock when the
+// state update of the block couldn't be fetched from the feeder gateway.
+// The block is fetched again after a wait.
+var errFetchStateUpdate = errors.New("couldn't fetch the state update")
+
+// errCorruptValue is returned by getNumericValueFromDB when the stored
+// value can't be a counter written by updateNumericValueFromDB.
+var errCorruptValue = errors.New("corrupt numeric value")
+
+// storageAddressBound is the exclusive upper bound of storage addresses,
+// 2²⁵¹ - 256.
+var storageAddressBound = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 251), big.NewInt(256))
+
+// StorageVarSelector returns the selector of the storage variable with the
+// given name, its StarkNet Keccak hash.
+func StorageVarSelector(name string) *big.Int {
+	return keccak.Digest250([]byte(name))
+}
+
+// The entry points called when a transaction or a message from layer 1
+// calls a function a contract doesn't have. Their selector is 0.
+const (
+	defaultEntryPointName   = "__default__"
+	defaultL1EntryPointName = "__l1_default__"
+)
+
+// SelectorFromName returns the selector of the function, event or
+// layer 1 handler with the given name, its StarkNet Keccak hash. The
+// selector of the default entry points is 0. The hash is 250 bits long,
+// so it's already a field element.
+func SelectorFromName(name string) *big.Int {
+	if name == defaultEntryPointName || name == defaultL1EntryPointName {
+		return new(big.Int)
+	}
+	return keccak.Digest250([]byte(name))
+}
+
+// SelectorFeltFromName is SelectorFromName returning a Felt.
+func SelectorFeltFromName(name string) types.Felt {
+	return types.BigToFelt(SelectorFromName(name))
+}
+
+// StorageKey returns the storage address of the entry of a storage
+// variable with the given keys, as used by get_storage_at. The selector
+// is hashed with each key in turn, pedersen(...pedersen(varSelector,
+// keys[0])..., keys[n-1]), and the result is reduced modulo 2²⁵¹ - 256,
+// like Cairo's normalize_address. Note that this is not a mask to 251
+// bits: hashes in [2²⁵¹ - 256, 2²⁵¹) wrap around to the first 256
+// addresses. With no keys, it's the address of a plain storage variable.
+func StorageKey(varSelector *big.Int, keys ...*big.Int) *big.Int {
+	key := new(big.Int).Set(varSelector)
+	for _, k := range keys {
+		key = pedersen.Digest(key, k)
+	}
+	return key.Mod(key, storageAddressBound)
+}
+
+// Trie is the binary trie the state and contract storage are kept in.
+// The Synchronizer only depends on this interface, so that the trie can
+// be replaced, for instance by a mock in tests.
+type Trie interface {
+	// Get returns the value of the key and whether it's in the trie.
+	Get(key *big.Int) (*big.Int, bool)
+	// Put sets the value of the key. Putting 0 deletes the key.
+	Put(key, val *big.Int)
+	// Delete removes the key from the trie.
+	Delete(key *big.Int)
+	// Commitment returns the root hash of the trie, which is 0 if the
+	// trie is empty.
+	Commitment() *big.Int
+	// Prove returns the nodes on the path from the root to the key, as
+	// checked by trie.VerifyProof.
+	Prove(key *big.Int) []trie.ProofNode
+	// Iterate calls fn with every key-value pair in increasing order of
+	// the keys until fn returns an error, which is returned.
+	Iterate(fn func(key, val *big.Int) error) error
+	// Err returns the first error reading the trie from its store, after
+	// which the trie can't be trusted and mustn't be committed.
+	Err() error
+}
+
+var _ Trie = (*trie.Trie)(nil)
+
+// newTrie returns the trie stored in the database under the given
+// prefix. It's a variable so that tests can swap the implementation.
+//
+// The state trie is stored under "state_trie_", which isn't hex, and the
+// storage trie of a contract under its address in hex, without 0x nor
+// leading zeros. The node paths, made of 0 and 1 digits, follow the
+// prefix with no separator, so the storage tries of two contracts share
+// keys when the address of one is the address of the other followed by 0
+// and 1 digits, as for 0x1 and 0x10. The nodes of one then overwrite the
+// nodes of the other. Random addresses are very unlikely to do this;
+// telling the tries apart needs a separator and a migration of the
+// stored tries.
+var newTrie = func(database db.DatabaseOperations, prefix string) Trie {
 	store := db.NewKeyValueStore(database, prefix)
-	return trie.New(store, 251)
+	t := trie.New(store, 251)
+	return &t
+}
+
+// storageRootCache caches the storage root of contracts across blocks so
+// that the storage trie of a contract does not need to be reopened to
+// read its root. Roots computed while applying a block are staged and
+// only become visible once the block has been committed, so an aborted
+// transaction never leaves stale roots behind. At most size roots are
+// kept; the least recently used ones are evicted and read from their
+// storage trie on the next access. A nil *storageRootCache is valid and
+// caches nothing.
+type storageRootCache struct {
+	size int
+	// roots maps a contract address to its element in order, which holds
+	// a *storageRootEntry and is kept from most to least recently used.
+	roots   map[string]*list.Element
+	order   *list.List
+	pending map[string]*big.Int
+}
+
+type storageRootEntry struct {
+	address string
+	root    *big.Int
+}
+
+// newStorageRootCache returns a new, empty storageRootCache that keeps at
+// most size roots. If size is not positive, defaultStorageRootCacheSize is
+// used.
+func newStorageRootCache(size int) *storageRootCache {
+	if size <= 0 {
+		size = defaultStorageRootCacheSize
+	}
+	return &storageRootCache{
+		size:    size,
+		roots:   make(map[string]*list.Element),
+		order:   list.New(),
+		pending: make(map[string]*big.Int),
+	}
+}
+
+// get returns the cached storage root of the given contract address and
+// true if it was found.
+func (c *storageRootCache) get(address string) (*big.Int, bool) {
+	if c == nil {
+		return nil, false
+	}
+	if root, ok := c.pending[address]; ok {
+		return root, true
+	}
+	e, ok := c.roots[address]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*storageRootEntry).root, true
+}
+
+// put stages the storage root of the given contract address. The root
+// replaces any previously cached value once commit is called.
+func (c *storageRootCache) put(address string, root *big.Int) {
+	if c == nil {
+		return
+	}
+	c.pending[address] = root
+}
+
+// commit makes all the staged roots visible, evicting the least recently
+// used roots beyond the size of the cache.
+func (c *storageRootCache) commit() {
+	if c == nil {
+		return
+	}
+	for address, root := range c.pending {
+		if e, ok := c.roots[address]; ok {
+			e.Value.(*storageRootEntry).root = root
+			c.order.MoveToFront(e)
+			continue
+		}
+		c.roots[address] = c.order.PushFront(&storageRootEntry{address, root})
+	}
+	c.pending = make(map[string]*big.Int)
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.roots, e.Value.(*storageRootEntry).address)
+	}
+	metr.SetStorageRootCacheEntries(c.order.Len())
+}
+
+// discard drops all the staged roots.
+func (c *storageRootCache) discard() {
+	if c == nil {
+		return
+	}
+	c.pending = make(map[string]*big.Int)
+}
+
+// clear drops all the cached and staged roots.
+func (c *storageRootCache) clear() {
+	if c == nil {
+		return
+	}
+	c.roots = make(map[string]*list.Element)
+	c.order.Init()
+	c.pending = make(map[string]*big.Int)
+	metr.SetStorageRootCacheEntries(0)
 }
 
 // loadContractInfo loads a contract ABI and set the events that later we are going to use
-func loadContractInfo(contractAddress, abiValue, logName string, contracts map[common.Address]starknetTypes.ContractInfo) error {
+func loadContractInfo(
+	contractAddress, abiValue string,
+	contracts map[common.Address]starknetTypes.ContractInfo,
+	logNames ...string,
+) error {
 	contractAddressHash := common.HexToAddress(contractAddress)
 	contractFromAbi, err := loadAbiOfContract(abiValue)
 	if err != nil {
 		return err
 	}
 	contracts[contractAddressHash] = starknetTypes.ContractInfo{
-		Contract:  contractFromAbi,
-		EventName: logName,
+		Contract:   contractFromAbi,
+		EventNames: logNames,
 	}
 	return nil
 }
 
+// decodeLog decodes a log emitted by one of the tracked contracts. The
+// event is identified by the first topic of the log, and both its indexed
+// and non-indexed arguments are decoded.
+func decodeLog(contract starknetTypes.ContractInfo, vLog ethTypes.Log) (starknetTypes.EventInfo, error) {
+	if len(vLog.Topics) == 0 {
+		return starknetTypes.EventInfo{}, errors.New("log without topics")
+	}
+	event, err := contract.Contract.EventByID(vLog.Topics[0])
+	if err != nil {
+		return starknetTypes.EventInfo{}, err
+	}
+	values := map[string]interface{}{}
+	if err := contract.Contract.UnpackIntoMap(values, event.Name, vLog.Data); err != nil {
+		return starknetTypes.EventInfo{}, err
+	}
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(values, indexed, vLog.Topics[1:]); err != nil {
+		return starknetTypes.EventInfo{}, err
+	}
+	return starknetTypes.EventInfo{
+		Name:            event.Name,
+		Block:           vLog.BlockNumber,
+		Event:           values,
+		Address:         contract.Address,
+		TransactionHash: vLog.TxHash,
+	}, nil
+}
+
+// l1ToL2MessageStatuses maps the events of the StarkNet contract about
+// messages from layer 1 to layer 2 to the status they set.
+var l1ToL2MessageStatuses = map[string]services.MessageStatus{
+	"LogMessageToL2":                 services.MessageStatusSent,
+	"MessageToL2CancellationStarted": services.MessageStatusCancellationStarted,
+	"ConsumedMessageToL2":            services.MessageStatusConsumed,
+	"MessageToL2Canceled":            services.MessageStatusCancelled,
+}
+
+// l1ToL2MessageHash computes the hash of a message from layer 1 to layer 2
+// out of the arguments of one of the message events of the StarkNet
+// contract, the same way the contract does:
+//
+//	keccak256(fromAddress, toAddress, nonce, selector, len(payload), payload...)
+//
+// where every value is encoded as a 32-byte word.
+func l1ToL2MessageHash(event map[string]interface{}) (common.Hash, error) {
+	fromAddress, ok := event["fromAddress"].(common.Address)
+	if !ok {
+		return common.Hash{}, errors.New("missing fromAddress")
+	}
+	words := []*big.Int{new(big.Int).SetBytes(fromAddress.Bytes())}
+	for _, name := range []string{"toAddress", "nonce", "selector"} {
+		value, ok := event[name].(*big.Int)
+		if !ok {
+			return common.Hash{}, fmt.Errorf("missing %s", name)
+		}
+		words = append(words, value)
+	}
+	payload, ok := event["payload"].([]*big.Int)
+	if !ok {
+		return common.Hash{}, errors.New("missing payload")
+	}
+	words = append(words, big.NewInt(int64(len(payload))))
+	words = append(words, payload...)
+
+	data := make([]byte, 0, len(words)*common.HashLength)
+	for _, word := range words {
+		data = append(data, common.BigToHash(word).Bytes()...)
+	}
+	return crypto.Keccak256Hash(data), nil
+}
+
 // loadAbiOfContract loads the ABI of the contract from the
 func loadAbiOfContract(abiVal string) (abi.ABI, error) {
 	contractAbi, err := abi.JSON(strings.NewReader(abiVal))
@@ -50,6 +362,22 @@ func loadAbiOfContract(abiVal string) (abi.ABI, error) {
 	return contractAbi, nil
 }
 
+// checkOldRoot checks that `oldRoot` is the root of the local state
+// before a block is applied on top of it. An empty state, as on a fresh
+// database, has a root of 0, so the first block must have an old root of
+// 0x0. If `oldRoot` is empty, nothing is checked.
+func checkOldRoot(txn db.DatabaseOperations, oldRoot string) error {
+	if oldRoot == "" {
+		return nil
+	}
+	stateTrie := newTrie(txn, "state_trie_")
+	current := remove0x(stateTrie.Commitment().Text(16))
+	if current != remove0x(oldRoot) {
+		return fmt.Errorf("%w: local state root is 0x%s, block old root is %s", errOldRootMismatch, current, oldRoot)
+	}
+	return nil
+}
+
 // contractState define the function that calculates the values stored in the
 // leaf of the Merkle Patricia Tree that represent the State in StarkNet
 func contractState(contractHash, storageRoot *big.Int) *big.Int {
@@ -77,8 +405,9 @@ func remove0x(s string) string {
 	return answer
 }
 
-// stateUpdateResponseToStateDiff convert the input feeder.StateUpdateResponse to StateDiff
-func stateUpdateResponseToStateDiff(update feeder.StateUpdateResponse) starknetTypes.StateDiff {
+// stateUpdateResponseToStateDiff convert the input feeder.StateUpdateResponse to StateDiff.
+// It returns an error if the address of a storage diff is not a felt.
+func stateUpdateResponseToStateDiff(update feeder.StateUpdateResponse) (starknetTypes.StateDiff, error) {
 	var stateDiff starknetTypes.StateDiff
 	stateDiff.DeployedContracts = make([]starknetTypes.DeployedContract, len(update.StateDiff.DeployedContracts))
 	for i, v := range update.StateDiff.DeployedContracts {
@@ -87,9 +416,11 @@ func stateUpdateResponseToStateDiff(update feeder.StateUpdateResponse) starknetT
 			ContractHash: v.ContractHash,
 		}
 	}
-	stateDiff.StorageDiffs = make(map[string][]starknetTypes.KV)
 	for addressDiff, keyVals := range update.StateDiff.StorageDiffs {
-		address := addressDiff
+		address, err := types.FeltFromHex(addressDiff)
+		if err != nil {
+			return starknetTypes.StateDiff{}, fmt.Errorf("address of storage diff: %w", err)
+		}
 		kvs := make([]starknetTypes.KV, 0)
 		for _, kv := range keyVals {
 			kvs = append(kvs, starknetTypes.KV{
@@ -97,10 +428,10 @@ func stateUpdateResponseToStateDiff(update feeder.StateUpdateResponse) starknetT
 				Value: kv.Value,
 			})
 		}
-		stateDiff.StorageDiffs[address] = kvs
+		stateDiff.StorageDiffs.Put(address, kvs)
 	}
 
-	return stateDiff
+	return stateDiff, nil
 }
 
 // getGpsVerifierAddress returns the address of the GpsVerifierStatement in the current chain
@@ -127,7 +458,9 @@ func initialBlockForStarknetContract(id int64) int64 {
 	return starknetTypes.BlockOfStarknetDeploymentContractGoerli
 }
 
-// getNumericValueFromDB get the value associated to a key and convert it to integer
+// getNumericValueFromDB get the value associated to a key and convert it to integer.
+// A value that isn't 8 bytes long or doesn't fit in an int64 is reported
+// as corrupt instead of being used.
 func getNumericValueFromDB(database db.Database, key string) (uint64, error) {
 	value, err := database.Get([]byte(key))
 	if err != nil {
@@ -141,11 +474,14 @@ func getNumericValueFromDB(database db.Database, key string) (uint64, error) {
 		// notest
 		return 0, nil
 	}
-	var ret uint64
-	buf := bytes.NewBuffer(value)
-	err = binary.Read(buf, binary.BigEndian, &ret)
-	if err != nil {
-		return 0, err
+	if len(value) != 8 {
+		return 0, fmt.Errorf("%w: %s is %d bytes long, want 8", errCorruptValue, key, len(value))
+	}
+	ret := binary.BigEndian.Uint64(value)
+	// The values are block numbers, which are converted to int in some
+	// places, so one that doesn't fit can only come from corrupt data.
+	if ret > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %s is %d", errCorruptValue, key, ret)
 	}
 	return ret, nil
 }
@@ -163,77 +499,141 @@ func updateNumericValueFromDB(database db.DatabaseOperations, key string, value
 	return nil
 }
 
+// putLatestStateRoot stores the state root committed by the block with
+// the given number. The block number and the root are stored together
+// under the same key so they are always read consistently.
+func putLatestStateRoot(txn db.DatabaseOperations, stateRoot types.Felt, blockNumber uint64) error {
+	value := make([]byte, 8+types.FeltLength)
+	binary.BigEndian.PutUint64(value, blockNumber)
+	copy(value[8:], stateRoot.Bytes())
+	return txn.Put([]byte(starknetTypes.LatestStateRoot), value)
+}
+
+// getLatestStateRoot returns the state root stored by putLatestStateRoot
+// and its block number. If no state root has been stored, it returns
+// ErrNoStateRoot.
+func getLatestStateRoot(database db.DatabaseOperations) (*types.Felt, uint64, error) {
+	value, err := database.Get([]byte(starknetTypes.LatestStateRoot))
+	if err != nil {
+		if db.IsNotFound(err) {
+			return nil, 0, ErrNoStateRoot
+		}
+		// notest
+		return nil, 0, err
+	}
+	if value == nil {
+		// notest
+		return nil, 0, ErrNoStateRoot
+	}
+	if len(value) != 8+types.FeltLength {
+		// notest
+		return nil, 0, fmt.Errorf("unexpected length %d of the latest state root", len(value))
+	}
+	stateRoot := types.BytesToFelt(value[8:])
+	return &stateRoot, binary.BigEndian.Uint64(value), nil
+}
+
 // updateState is a pure function (besides logging) that applies the
-// `update` StateDiff to the database transaction `txn`.
+// `update` StateDiff to the database transaction `txn`. The diff is
+// validated before any change is made. Cancellation of
+// ctx is checked between contracts, in which case ctx's error is returned
+// and the transaction should be aborted.
 func updateState(
+	ctx context.Context,
 	txn db.DatabaseOperations,
 	contractHashMap map[string]*big.Int,
+	storageRoots *storageRootCache,
 	update *starknetTypes.StateDiff,
 	stateRoot string,
 	sequenceNumber uint64,
 ) (string, error) {
 	log.Default.With("Block Number", sequenceNumber).Info("Processing block")
 
+	if err := update.Validate(); err != nil {
+		return "", fmt.Errorf("invalid state diff of block %d: %w", sequenceNumber, err)
+	}
+
 	stateTrie := newTrie(txn, "state_trie_")
 
 	log.Default.With("Block Number", sequenceNumber).Info("Processing deployed contracts")
 	for _, deployedContract := range update.DeployedContracts {
-		contractHash, ok := new(big.Int).SetString(remove0x(deployedContract.ContractHash), 16)
-		if !ok {
-			// notest
-			log.Default.Panic("Couldn't get contract hash")
+		if err := ctx.Err(); err != nil {
+			return "", err
 		}
-		storageTrie := newTrie(txn, remove0x(deployedContract.Address))
-		storageRoot := storageTrie.Commitment()
-		address, ok := new(big.Int).SetString(remove0x(deployedContract.Address), 16)
+		contractHash, err := types.FeltFromHex(deployedContract.ContractHash)
+		if err != nil {
+			return "", fmt.Errorf("contract hash of deployed contract %s: %w", deployedContract.Address, err)
+		}
+		address, err := types.FeltFromHex(deployedContract.Address)
+		if err != nil {
+			return "", fmt.Errorf("address of deployed contract: %w", err)
+		}
+		storageRoot, ok := storageRoots.get(remove0x(deployedContract.Address))
 		if !ok {
-			// notest
-			log.Default.With("Address", deployedContract.Address).
-				Panic("Couldn't convert Address to Big.Int ")
+			storageTrie := newTrie(txn, remove0x(deployedContract.Address))
+			storageRoot = storageTrie.Commitment()
+			if err := storageTrie.Err(); err != nil {
+				return "", fmt.Errorf("storage of deployed contract %s: %w", deployedContract.Address, err)
+			}
+		}
+		if err := putContractState(txn, stateTrie, address.Big(), contractHash.Big(), storageRoot); err != nil {
+			return "", err
 		}
-		contractStateValue := contractState(contractHash, storageRoot)
-		stateTrie.Put(address, contractStateValue)
 	}
 
 	log.Default.With("Block Number", sequenceNumber).Info("Processing storage diffs")
-	for k, v := range update.StorageDiffs {
-		formattedAddress := remove0x(k)
+	var err error
+	update.StorageDiffs.Range(func(address types.Felt, kvs []starknetTypes.KV) bool {
+		if err = ctx.Err(); err != nil {
+			return false
+		}
+		formattedAddress := remove0x(address.Hex())
 		storageTrie := newTrie(txn, formattedAddress)
-		for _, storageSlots := range v {
-			key, ok := new(big.Int).SetString(remove0x(storageSlots.Key), 16)
-			if !ok {
-				// notest
-				log.Default.With("Storage Slot Key", storageSlots.Key).
-					Panic("Couldn't get the ")
+		for _, storageSlots := range kvs {
+			var key, val types.Felt
+			key, err = types.FeltFromHex(storageSlots.Key)
+			if err != nil {
+				err = fmt.Errorf("storage key of contract %s: %w", address, err)
+				return false
 			}
-			val, ok := new(big.Int).SetString(remove0x(storageSlots.Value), 16)
-			if !ok {
-				// notest
-				log.Default.With("Storage Slot Value", storageSlots.Value).
-					Panic("Couldn't get the contract Hash")
+			val, err = types.FeltFromHex(storageSlots.Value)
+			if err != nil {
+				err = fmt.Errorf("storage value of contract %s: %w", address, err)
+				return false
 			}
-			storageTrie.Put(key, val)
+			storageTrie.Put(key.Big(), val.Big())
 		}
+		// The cached root isn't read here: a Put rehashes the path of its
+		// key from the leaf up without reading the old root, and the new
+		// root is a single read after the Puts, next to nothing against
+		// the hashing (about 4µs against 200ms per slot on a trie of 1000
+		// slots). It's cached for the deployed contracts of later blocks.
 		storageRoot := storageTrie.Commitment()
-
-		address, ok := new(big.Int).SetString(formattedAddress, 16)
-		if !ok {
-			// notest
-			log.Default.With("Address", formattedAddress).
-				Panic("Couldn't convert Address to Big.Int ")
+		if err = storageTrie.Err(); err != nil {
+			err = fmt.Errorf("storage of contract %s: %w", address, err)
+			return false
 		}
-		contractHash := contractHashMap[formattedAddress]
-		contractStateValue := contractState(contractHash, storageRoot)
+		storageRoots.put(formattedAddress, storageRoot)
 
-		stateTrie.Put(address, contractStateValue)
+		contractHash := contractHashMap[formattedAddress]
+		if err = putContractState(txn, stateTrie, address.Big(), contractHash, storageRoot); err != nil {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
 	}
 
 	stateCommitment := remove0x(stateTrie.Commitment().Text(16))
+	if err := stateTrie.Err(); err != nil {
+		return "", fmt.Errorf("state trie: %w", err)
+	}
 
 	if stateRoot != "" && stateCommitment != remove0x(stateRoot) {
-		// notest
 		log.Default.With("State Commitment", stateCommitment, "State Root from API", remove0x(stateRoot)).
-			Panic("stateRoot not equal to the one provided")
+			Error("stateRoot not equal to the one provided")
+		return "", fmt.Errorf("%w: got %s, want %s", errStateRootMismatch, stateCommitment, remove0x(stateRoot))
 	}
 	log.Default.With("State Root", stateCommitment).
 		Info("Got State commitment")
@@ -259,11 +659,13 @@ func feederTransactionToDBTransaction(info *feeder.TransactionInfo) types.IsTran
 		calldata = append(calldata, types.HexToFelt(data))
 	}
 
-	if info.Transaction.Type == "INVOKE" {
-		signature := make([]types.Felt, 0)
-		for _, data := range info.Transaction.Signature {
-			signature = append(signature, types.HexToFelt(data))
-		}
+	signature := make([]types.Felt, 0)
+	for _, data := range info.Transaction.Signature {
+		signature = append(signature, types.HexToFelt(data))
+	}
+
+	switch info.Transaction.Type {
+	case "INVOKE":
 		return &types.TransactionInvoke{
 			Hash:               types.HexToTransactionHash(info.Transaction.TransactionHash),
 			ContractAddress:    types.HexToAddress(info.Transaction.ContractAddress),
@@ -272,6 +674,21 @@ func feederTransactionToDBTransaction(info *feeder.TransactionInfo) types.IsTran
 			Signature:          signature,
 			MaxFee:             types.Felt{},
 		}
+	case "DEPLOY_ACCOUNT":
+		constructorCalldata := make([]types.Felt, 0)
+		for _, data := range info.Transaction.ConstructorCalldata {
+			constructorCalldata = append(constructorCalldata, types.HexToFelt(data))
+		}
+		return &types.TransactionDeployAccount{
+			Hash:                types.HexToTransactionHash(info.Transaction.TransactionHash),
+			ContractAddress:     types.HexToAddress(info.Transaction.ContractAddress),
+			ClassHash:           types.HexToFelt(info.Transaction.ClassHash),
+			ContractAddressSalt: types.HexToFelt(info.Transaction.ContractAddressSalt),
+			ConstructorCallData: constructorCalldata,
+			Signature:           signature,
+			Nonce:               types.HexToFelt(info.Transaction.Nonce),
+			MaxFee:              types.HexToFelt(info.Transaction.MaxFee),
+		}
 	}
 
 	// Is a DEPLOY Transaction
@@ -282,18 +699,26 @@ func feederTransactionToDBTransaction(info *feeder.TransactionInfo) types.IsTran
 	}
 }
 
-// feederBlockToDBBlock convert the feeder block to the block stored in the database
+// feederBlockToDBBlock convert the feeder block to the block stored in the database.
+// A status that isn't a types.BlockStatus is logged and kept as RawStatus.
 func feederBlockToDBBlock(b *feeder.StarknetBlock) *types.Block {
 	txnsHash := make([]types.TransactionHash, 0)
 	for _, data := range b.Transactions {
 		txnsHash = append(txnsHash, types.TransactionHash(types.HexToFelt(data.TransactionHash)))
 	}
-	status, _ := types.BlockStatusValue[b.Status]
+	status, err := types.ParseBlockStatus(b.Status)
+	rawStatus := ""
+	if err != nil {
+		log.Default.With("Block Number", b.BlockNumber, "Status", b.Status).
+			Warn("Unknown block status, storing it as received")
+		rawStatus = b.Status
+	}
 	return &types.Block{
 		BlockHash:   types.HexToBlockHash(b.BlockHash),
 		BlockNumber: uint64(b.BlockNumber),
 		ParentHash:  types.HexToBlockHash(b.ParentBlockHash),
 		Status:      status,
+		RawStatus:   rawStatus,
 		Sequencer:   types.HexToAddress(b.SequencerAddress),
 		NewRoot:     types.HexToFelt(b.StateRoot),
 		OldRoot:     types.HexToFelt(b.OldStateRoot),
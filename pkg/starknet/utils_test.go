@@ -1,12 +1,19 @@
 package starknet
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/NethermindEth/juno/pkg/types"
@@ -15,12 +22,17 @@ import (
 
 	"github.com/NethermindEth/juno/internal/db"
 	dbAbi "github.com/NethermindEth/juno/internal/db/abi"
+	"github.com/NethermindEth/juno/pkg/crypto/pedersen"
 	"github.com/NethermindEth/juno/pkg/feeder"
 	feederAbi "github.com/NethermindEth/juno/pkg/feeder/abi"
+	starknetAbi "github.com/NethermindEth/juno/pkg/starknet/abi"
 	starknetTypes "github.com/NethermindEth/juno/pkg/starknet/types"
 	"github.com/NethermindEth/juno/pkg/store"
 	"github.com/NethermindEth/juno/pkg/trie"
+	"github.com/NethermindEth/juno/pkg/trie/trietest"
 	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 func TestRemove0x(t *testing.T) {
@@ -85,7 +97,7 @@ func TestStateUpdateResponseToStateDiff(t *testing.T) {
 			},
 		},
 		StorageDiffs: map[string][]feeder.KV{
-			"key_address": kvs,
+			"0x1": kvs,
 		},
 	}
 	feederVal := feeder.StateUpdateResponse{
@@ -95,7 +107,10 @@ func TestStateUpdateResponseToStateDiff(t *testing.T) {
 		StateDiff: diff,
 	}
 
-	value := stateUpdateResponseToStateDiff(feederVal)
+	value, err := stateUpdateResponseToStateDiff(feederVal)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(value.DeployedContracts) != len(feederVal.StateDiff.DeployedContracts) {
 		t.Fail()
@@ -107,11 +122,11 @@ func TestStateUpdateResponseToStateDiff(t *testing.T) {
 		t.Fail()
 	}
 
-	val, ok := diff.StorageDiffs["key_address"]
+	val, ok := value.StorageDiffs.Get(types.HexToFelt("0x1"))
 	if !ok {
 		t.Fail()
 	}
-	val2, ok := feederVal.StateDiff.StorageDiffs["key_address"]
+	val2, ok := feederVal.StateDiff.StorageDiffs["0x1"]
 	if !ok {
 		t.Fail()
 	}
@@ -160,6 +175,20 @@ func TestGetAndUpdateValueOnDB(t *testing.T) {
 	if zero != 0 {
 		t.Fail()
 	}
+
+	corrupt := map[string][]byte{
+		"short":    {1, 2, 3},
+		"long":     make([]byte, 9),
+		"negative": {0x80, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for key, value := range corrupt {
+		if err := database.Put([]byte(key), value); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := getNumericValueFromDB(database, key); !errors.Is(err, errCorruptValue) {
+			t.Errorf("getNumericValueFromDB(%q) returned %v, want %v", key, err, errCorruptValue)
+		}
+	}
 }
 
 func TestFixedValues(t *testing.T) {
@@ -218,7 +247,7 @@ func TestLoadContractInfo(t *testing.T) {
 
 	contracts := make(map[common.Address]starknetTypes.ContractInfo)
 
-	err = loadContractInfo(contractAddress, string(abiAsBytes), "logName", contracts)
+	err = loadContractInfo(contractAddress, string(abiAsBytes), contracts, "logName")
 	if err != nil {
 		t.Fail()
 		return
@@ -242,6 +271,26 @@ func TestLoadContractInfo(t *testing.T) {
 	}
 }
 
+func TestLoadContractInfoInvalidAbi(t *testing.T) {
+	contracts := make(map[common.Address]starknetTypes.ContractInfo)
+	if err := loadContractInfo("0x0", "{not an abi", contracts, "logName"); err == nil {
+		t.Error("loadContractInfo did not fail with an invalid ABI")
+	}
+	if len(contracts) != 0 {
+		t.Errorf("loadContractInfo added %d contracts with an invalid ABI", len(contracts))
+	}
+}
+
+// newStorageDiffs builds the storage diffs of a StateDiff from a map keyed
+// by hexadecimal contract addresses.
+func newStorageDiffs(diffs map[string][]starknetTypes.KV) types.FeltMap[[]starknetTypes.KV] {
+	var m types.FeltMap[[]starknetTypes.KV]
+	for address, kvs := range diffs {
+		m.Put(types.HexToFelt(address), kvs)
+	}
+	return m
+}
+
 func TestUpdateState(t *testing.T) {
 	// Note: `contract` in `DeployedContracts` and `StorageDiffs`.
 	// This will never happen in practice, but we do that here so we can test the DeployedContract
@@ -254,9 +303,9 @@ func TestUpdateState(t *testing.T) {
 	storageDiff := starknetTypes.KV{Key: "a", Value: "b"}
 	stateDiff := starknetTypes.StateDiff{
 		DeployedContracts: []starknetTypes.DeployedContract{contract},
-		StorageDiffs: map[string][]starknetTypes.KV{
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
 			contract.Address: {storageDiff},
-		},
+		}),
 	}
 
 	// Want
@@ -284,7 +333,7 @@ func TestUpdateState(t *testing.T) {
 
 	var stateCommitment string
 	err = database.RunTxn(func(txn db.DatabaseOperations) (err error) {
-		stateCommitment, err = updateState(txn, contractHashMap, &stateDiff, "", 0)
+		stateCommitment, err = updateState(context.Background(), txn, contractHashMap, nil, &stateDiff, "", 0)
 		return err
 	})
 	if err != nil {
@@ -298,6 +347,52 @@ func TestUpdateState(t *testing.T) {
 	}
 }
 
+// TestUpdateStateFreshContractStorage checks that a contract deployed in a
+// block whose constructor writes its first storage slot in the same block
+// starts from an empty storage trie, even if an empty value was left
+// under the root key of its storage trie.
+func TestUpdateStateFreshContractStorage(t *testing.T) {
+	contract := starknetTypes.DeployedContract{Address: "0x2", ContractHash: "0x3"}
+	stateDiff := starknetTypes.StateDiff{
+		DeployedContracts: []starknetTypes.DeployedContract{contract},
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
+			contract.Address: {{Key: "0x4", Value: "0x5"}},
+		}),
+	}
+
+	stateTrie := trie.New(store.New(), 251)
+	storageTrie := trie.New(store.New(), 251)
+	storageTrie.Put(big.NewInt(4), big.NewInt(5))
+	stateTrie.Put(big.NewInt(2), contractState(big.NewInt(3), storageTrie.Commitment()))
+	want := remove0x(stateTrie.Commitment().Text(16))
+
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cache := range []*storageRootCache{nil, newStorageRootCache(10)} {
+		var root string
+		var updateErr error
+		// The transaction is aborted so that every run starts from the
+		// empty value.
+		_ = database.RunTxn(func(txn db.DatabaseOperations) error {
+			if err := txn.Put([]byte("2root"), []byte{}); err != nil {
+				return err
+			}
+			contractHashMap := map[string]*big.Int{"2": big.NewInt(3)}
+			root, updateErr = updateState(context.Background(), txn, contractHashMap, cache, &stateDiff, want, 0)
+			return errors.New("abort")
+		})
+		if updateErr != nil || root != want {
+			t.Errorf("updateState() = %s, %v, want root %s", root, updateErr, want)
+		}
+	}
+}
+
 func TestToDbAbi(t *testing.T) {
 	inputAbi := feederAbi.Abi{
 		Functions: []feederAbi.Function{
@@ -414,6 +509,34 @@ func TestTransactionToDBTransactionDeploy(t *testing.T) {
 	TxnTest(t, "DEPLOY")
 }
 
+func TestTransactionToDBTransactionDeployAccount(t *testing.T) {
+	var info feeder.TransactionInfo
+	info.Transaction = feeder.TxnSpecificInfo{
+		Type:                "DEPLOY_ACCOUNT",
+		TransactionHash:     "0x32b272b6d0d584305a460197aa849b5c7a9a85903b66e9d3e1afa2427ef093e",
+		ContractAddress:     "0x4c05e6bb8de0e9a6d4d4dbf0a2c5ee4bfd1eb47dd8bb5b4e8ec3fc0ce0bd1d2",
+		ClassHash:           "0x25ec026985a3bf9d0cc1fe17326b245dfdc3ff89b8fde106542a3ea56c5a918",
+		ContractAddressSalt: "0x3f5ba0c4",
+		ConstructorCalldata: []string{"0x33434ad8", "0x1"},
+		Signature:           []string{"0x6a9e5bf9", "0x1c5c0a7a"},
+		Nonce:               "0x0",
+		MaxFee:              "0x2386f26fc10000",
+	}
+	want := &types.TransactionDeployAccount{
+		Hash:                types.HexToTransactionHash(info.Transaction.TransactionHash),
+		ContractAddress:     types.HexToAddress(info.Transaction.ContractAddress),
+		ClassHash:           types.HexToFelt(info.Transaction.ClassHash),
+		ContractAddressSalt: types.HexToFelt("0x3f5ba0c4"),
+		ConstructorCallData: []types.Felt{types.HexToFelt("0x33434ad8"), types.HexToFelt("0x1")},
+		Signature:           []types.Felt{types.HexToFelt("0x6a9e5bf9"), types.HexToFelt("0x1c5c0a7a")},
+		Nonce:               types.HexToFelt("0x0"),
+		MaxFee:              types.HexToFelt("0x2386f26fc10000"),
+	}
+	if got := feederTransactionToDBTransaction(&info); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
 func randomHex(n int) (string, error) {
 	bytes := make([]byte, n)
 	if _, err := rand.Read(bytes); err != nil {
@@ -452,6 +575,7 @@ func TestFeederBlockToBlock(t *testing.T) {
 	b.BlockHash = blockHash
 	newRoot, _ := randomHex(20)
 	b.StateRoot = newRoot
+	b.Status = "ACCEPTED_ON_L1"
 	block := feederBlockToDBBlock(&b)
 
 	if remove0x(block.BlockHash.Hex()) != remove0x(b.BlockHash) {
@@ -460,4 +584,805 @@ func TestFeederBlockToBlock(t *testing.T) {
 	if remove0x(block.NewRoot.Hex()) != remove0x(b.StateRoot) {
 		t.Fail()
 	}
+	if block.Status != types.BlockStatusAcceptedOnL1 || block.RawStatus != "" {
+		t.Errorf("status = %v, raw %q, want %v", block.Status, block.RawStatus, types.BlockStatusAcceptedOnL1)
+	}
+
+	b.Status = "NEW_STATUS"
+	block = feederBlockToDBBlock(&b)
+	if block.Status != types.BlockStatusUnknown || block.RawStatus != b.Status {
+		t.Errorf("unknown status = %v, raw %q, want %v, raw %q", block.Status, block.RawStatus, types.BlockStatusUnknown, b.Status)
+	}
+}
+
+func TestStorageKey(t *testing.T) {
+	bound := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 251), big.NewInt(256))
+	account := big.NewInt(0x1234)
+	balances := StorageVarSelector("ERC20_balances")
+	tests := [...]struct {
+		name     string
+		selector *big.Int
+		keys     []*big.Int
+		want     *big.Int
+	}{
+		{
+			// The balance variable of the StarkNet documentation contract.
+			"plain variable",
+			StorageVarSelector("balance"),
+			nil,
+			types.HexToFelt("0x206f38f7e4f15e87567361213c28f235cccdaa1d7fd34c9db1dfe9489c6a091").Big(),
+		},
+		{
+			"mapping entry",
+			balances,
+			[]*big.Int{account},
+			new(big.Int).Mod(pedersen.Digest(balances, account), bound),
+		},
+		{
+			"two keys",
+			balances,
+			[]*big.Int{account, big.NewInt(1)},
+			new(big.Int).Mod(pedersen.Digest(pedersen.Digest(balances, account), big.NewInt(1)), bound),
+		},
+		{
+			"below the bound",
+			new(big.Int).Sub(bound, big.NewInt(1)),
+			nil,
+			new(big.Int).Sub(bound, big.NewInt(1)),
+		},
+		{
+			"wraps at the bound",
+			new(big.Int).Add(bound, big.NewInt(5)),
+			nil,
+			big.NewInt(5),
+		},
+	}
+	for _, test := range tests {
+		if got := StorageKey(test.selector, test.keys...); got.Cmp(test.want) != 0 {
+			t.Errorf("%s: StorageKey() = %x, want %x", test.name, got, test.want)
+		}
+	}
+	if selector := balances.Text(16); selector != "3a4e8ec16e258a799fe707996fd5d21d42b29adc1499a370edf7f809d8c458a" {
+		t.Errorf("StorageVarSelector(ERC20_balances) = %s", selector)
+	}
+}
+
+func TestSelectorFromName(t *testing.T) {
+	tests := [...]struct {
+		name string
+		want string
+	}{
+		{"transfer", "0x83afd3f4caedc6eebf44246fe54e38c95e3179a5ec9ea81740eca5b482d12e"},
+		{"Transfer", "0x99cd8bde557814842a3121e8ddfd433a539b8c9f14bf31ebf108d12e6196e9"},
+		{"__default__", "0x0"},
+		{"__l1_default__", "0x0"},
+	}
+	for _, test := range tests {
+		if got := SelectorFeltFromName(test.name); got.Hex() != test.want {
+			t.Errorf("SelectorFeltFromName(%q) = %s, want %s", test.name, got.Hex(), test.want)
+		}
+		if got := SelectorFromName(test.name); got.Cmp(types.HexToFelt(test.want).Big()) != 0 {
+			t.Errorf("SelectorFromName(%q) = %x, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+// TestMergeStateDiffsRoot checks that applying merged state diffs gives
+// the same state root as applying them one after the other, including
+// slots that are cleared and contracts deployed after their storage is
+// written.
+func TestMergeStateDiffsRoot(t *testing.T) {
+	diffs := []starknetTypes.StateDiff{
+		{
+			DeployedContracts: []starknetTypes.DeployedContract{{Address: "0x1", ContractHash: "0xa"}},
+			StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
+				"0x1": {{Key: "0x5", Value: "0x1"}, {Key: "0x6", Value: "0x2"}},
+			}),
+		},
+		{
+			StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
+				"0x1": {{Key: "0x5", Value: "0x0"}},
+				"0x2": {{Key: "0x7", Value: "0x3"}},
+			}),
+		},
+		{
+			DeployedContracts: []starknetTypes.DeployedContract{{Address: "0x2", ContractHash: "0xb"}},
+			StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
+				"0x1": {{Key: "0x6", Value: "0x4"}},
+			}),
+		},
+	}
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(0xa), "2": big.NewInt(0xb)}
+
+	env, err := db.NewMDBXEnv(t.TempDir(), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(name string, diffs ...starknetTypes.StateDiff) string {
+		database, err := db.NewMDBXDatabase(env, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var root string
+		err = database.RunTxn(func(txn db.DatabaseOperations) error {
+			for i := range diffs {
+				if root, err = updateState(context.Background(), txn, contractHashMap, nil, &diffs[i], "", uint64(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+
+	sequential := apply("SEQUENTIAL", diffs...)
+	merged := apply("MERGED", starknetTypes.MergeStateDiffs(diffs...))
+	if merged != sequential {
+		t.Errorf("state root of the merged diffs = %s, want %s", merged, sequential)
+	}
+}
+
+func TestStorageRootCache(t *testing.T) {
+	cache := newStorageRootCache(0)
+	root := big.NewInt(1)
+
+	cache.put("1", root)
+	if got, ok := cache.get("1"); !ok || got.Cmp(root) != 0 {
+		t.Errorf("get(1) = %v, %v after put, want %v, true", got, ok, root)
+	}
+	cache.discard()
+	if _, ok := cache.get("1"); ok {
+		t.Error("get(1) found a root after discard")
+	}
+
+	cache.put("1", root)
+	cache.commit()
+	if got, ok := cache.get("1"); !ok || got.Cmp(root) != 0 {
+		t.Errorf("get(1) = %v, %v after commit, want %v, true", got, ok, root)
+	}
+
+	// A staged root shadows the committed one until it is discarded.
+	cache.put("1", big.NewInt(2))
+	cache.discard()
+	if got, _ := cache.get("1"); got.Cmp(root) != 0 {
+		t.Errorf("get(1) = %v after discard, want %v", got, root)
+	}
+
+	cache.clear()
+	if _, ok := cache.get("1"); ok {
+		t.Error("get(1) found a root after clear")
+	}
+
+	var nilCache *storageRootCache
+	nilCache.put("1", root)
+	nilCache.commit()
+	if _, ok := nilCache.get("1"); ok {
+		t.Error("nil cache returned a root")
+	}
+}
+
+func TestStorageRootCacheEviction(t *testing.T) {
+	cache := newStorageRootCache(2)
+	cache.put("1", big.NewInt(1))
+	cache.put("2", big.NewInt(2))
+	cache.commit()
+
+	// Reading 1 makes 2 the least recently used root.
+	cache.get("1")
+	cache.put("3", big.NewInt(3))
+	cache.commit()
+	if _, ok := cache.get("2"); ok {
+		t.Error("least recently used root was not evicted")
+	}
+	for _, address := range []string{"1", "3"} {
+		if _, ok := cache.get(address); !ok {
+			t.Errorf("root of %s was evicted", address)
+		}
+	}
+
+	// Updating a cached root doesn't grow the cache.
+	cache.put("1", big.NewInt(4))
+	cache.commit()
+	if got, ok := cache.get("1"); !ok || got.Int64() != 4 || cache.order.Len() != 2 {
+		t.Errorf("get(1) = %v, %t with %d roots cached, want 4, true with 2", got, ok, cache.order.Len())
+	}
+}
+
+func TestUpdateStateWithStorageRootCache(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(1)}
+	cache := newStorageRootCache(0)
+
+	// The first block writes to the storage of contract 1.
+	storageUpdate := starknetTypes.StateDiff{
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{"1": {{Key: "a", Value: "b"}}}),
+	}
+	err = database.RunTxn(func(txn db.DatabaseOperations) error {
+		_, err := updateState(context.Background(), txn, contractHashMap, cache, &storageUpdate, "", 0)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.commit()
+
+	storageTrie := trietest.BuildTrie(t, map[*types.Felt]*types.Felt{
+		feltPtr(big.NewInt(0xa)): feltPtr(big.NewInt(0xb)),
+	}, 251)
+	if got, ok := cache.get("1"); !ok || got.Cmp(storageTrie.Commitment()) != 0 {
+		t.Fatalf("cached storage root = %v, want %v", got, storageTrie.Commitment())
+	}
+
+	// The second block redeploys contract 1, whose storage root is read
+	// from the cache.
+	deploy := starknetTypes.StateDiff{
+		DeployedContracts: []starknetTypes.DeployedContract{{Address: "1", ContractHash: "1"}},
+	}
+	var commitment string
+	err = database.RunTxn(func(txn db.DatabaseOperations) (err error) {
+		commitment, err = updateState(context.Background(), txn, contractHashMap, cache, &deploy, "", 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateTrie := trietest.BuildTrie(t, map[*types.Felt]*types.Felt{
+		feltPtr(big.NewInt(1)): feltPtr(contractState(big.NewInt(1), storageTrie.Commitment())),
+	}, 251)
+	trietest.AssertRoot(t, stateTrie, commitment)
+}
+
+// feltPtr returns a pointer to the felt of n, for the entries of
+// trietest.BuildTrie.
+func feltPtr(n *big.Int) *types.Felt {
+	f := types.BigToFelt(n)
+	return &f
+}
+
+func TestUpdateStateRootMismatch(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(1)}
+	update := starknetTypes.StateDiff{
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{"1": {{Key: "a", Value: "b"}}}),
+	}
+	var updateErr error
+	_ = database.RunTxn(func(txn db.DatabaseOperations) error {
+		_, updateErr = updateState(context.Background(), txn, contractHashMap, nil, &update, "0x1", 0)
+		return updateErr
+	})
+	if !errors.Is(updateErr, errStateRootMismatch) {
+		t.Errorf("got error %v, want %v", updateErr, errStateRootMismatch)
+	}
+}
+
+// mockTrie is an in-memory Trie whose commitment is the number of keys.
+type mockTrie map[string]*big.Int
+
+func (m mockTrie) Get(key *big.Int) (*big.Int, bool) {
+	val, ok := m[key.Text(16)]
+	return val, ok
+}
+
+func (m mockTrie) Put(key, val *big.Int) {
+	if val.Sign() == 0 {
+		m.Delete(key)
+		return
+	}
+	m[key.Text(16)] = val
+}
+
+func (m mockTrie) Delete(key *big.Int) {
+	delete(m, key.Text(16))
+}
+
+func (m mockTrie) Commitment() *big.Int {
+	return big.NewInt(int64(len(m)))
+}
+
+func (m mockTrie) Prove(*big.Int) []trie.ProofNode {
+	return nil
+}
+
+func (m mockTrie) Err() error {
+	return nil
+}
+
+func (m mockTrie) Iterate(fn func(key, val *big.Int) error) error {
+	keys := make([]*big.Int, 0, len(m))
+	for k := range m {
+		key, _ := new(big.Int).SetString(k, 16)
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Cmp(keys[j]) < 0 })
+	for _, key := range keys {
+		if err := fn(key, m[key.Text(16)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestUpdateStateMockTrie checks how updateState applies a state diff to
+// the tries, independently of the trie implementation.
+func TestUpdateStateMockTrie(t *testing.T) {
+	tries := make(map[string]mockTrie)
+	defer func(original func(db.DatabaseOperations, string) Trie) { newTrie = original }(newTrie)
+	newTrie = func(_ db.DatabaseOperations, prefix string) Trie {
+		if _, ok := tries[prefix]; !ok {
+			tries[prefix] = make(mockTrie)
+		}
+		return tries[prefix]
+	}
+
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(0xa)}
+	update := starknetTypes.StateDiff{
+		DeployedContracts: []starknetTypes.DeployedContract{{Address: "0x1", ContractHash: "0xa"}},
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
+			"0x1": {{Key: "0x5", Value: "0x1"}, {Key: "0x6", Value: "0x2"}, {Key: "0x6", Value: "0x0"}},
+		}),
+	}
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The transaction only holds the preimages of the contract leaves.
+	var root string
+	err = database.RunTxn(func(txn db.DatabaseOperations) (err error) {
+		root, err = updateState(context.Background(), txn, contractHashMap, nil, &update, "", 0)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := tries["1"]
+	if val, ok := storage.Get(big.NewInt(5)); !ok || val.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("storage slot 0x5 = %v, %t, want 0x1", val, ok)
+	}
+	if _, ok := storage.Get(big.NewInt(6)); ok {
+		t.Error("storage slot 0x6 was not cleared")
+	}
+	want := contractState(big.NewInt(0xa), storage.Commitment())
+	if val, ok := tries["state_trie_"].Get(big.NewInt(1)); !ok || val.Cmp(want) != 0 {
+		t.Errorf("state of contract 0x1 = %v, %t, want %v", val, ok, want)
+	}
+	if root != "1" {
+		t.Errorf("updateState returned root %s, want 1", root)
+	}
+}
+
+// failingTrie is a mockTrie whose store can't be read.
+type failingTrie struct{ mockTrie }
+
+var errTrieRead = errors.New("read failed")
+
+func (failingTrie) Err() error {
+	return errTrieRead
+}
+
+// TestUpdateStateTrieError checks that updateState fails, rather than
+// returning a root, when a trie can't be read.
+func TestUpdateStateTrieError(t *testing.T) {
+	defer func(original func(db.DatabaseOperations, string) Trie) { newTrie = original }(newTrie)
+	for _, failing := range []string{"1", "state_trie_"} {
+		newTrie = func(_ db.DatabaseOperations, prefix string) Trie {
+			if prefix == failing {
+				return failingTrie{make(mockTrie)}
+			}
+			return make(mockTrie)
+		}
+		update := starknetTypes.StateDiff{
+			StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
+				"0x1": {{Key: "0x5", Value: "0x1"}},
+			}),
+		}
+		env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		database, err := db.NewMDBXDatabase(env, "TEST-DB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = updateState(context.Background(), database, map[string]*big.Int{"1": big.NewInt(0xa)}, nil, &update, "", 0)
+		if !errors.Is(err, errTrieRead) {
+			t.Errorf("updateState with trie %s failing returned %v, want %v", failing, err, errTrieRead)
+		}
+		database.Close()
+	}
+}
+
+// replayBases maps the fixtures of TestReplayStateUpdates that don't start
+// at block 0 to the fixtures of the blocks they are applied on top of.
+var replayBases = map[string]string{"synthetic": "mainnet"}
+
+// TestReplayStateUpdates applies the state updates in
+// testdata/state_updates/<network>/<block number>.json in block order and
+// checks that every computed state root matches the one in the fixture.
+//
+// Only mainnet block 0 is recorded from the feeder gateway. The updates in
+// synthetic were written by hand on top of it: block 1 changes a slot and
+// writes a new one, block 2 reverts the change and zeroes the new slot, and
+// block 3 zeroes a slot that was never written. The root of block 1 was
+// computed by this package, but the roots of blocks 2 and 3 are the
+// recorded root of block 0, so they check that zeroed slots are removed
+// from the storage trie.
+func TestReplayStateUpdates(t *testing.T) {
+	networks, err := os.ReadDir(filepath.Join("testdata", "state_updates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, network := range networks {
+		network := network.Name()
+		t.Run(network, func(t *testing.T) {
+			blocks := replayFixtures(t, network)
+			if base, ok := replayBases[network]; ok {
+				var baseBlocks []replayFixture
+				for _, block := range replayFixtures(t, base) {
+					if block.number < blocks[0].number {
+						baseBlocks = append(baseBlocks, block)
+					}
+				}
+				blocks = append(baseBlocks, blocks...)
+			}
+
+			env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			database, err := db.NewMDBXDatabase(env, "TEST-DB")
+			if err != nil {
+				t.Fatal(err)
+			}
+			contractHashMap := make(map[string]*big.Int)
+			for _, block := range blocks {
+				raw, err := os.ReadFile(block.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var update feeder.StateUpdateResponse
+				if err := json.Unmarshal(raw, &update); err != nil {
+					t.Fatal(err)
+				}
+				stateDiff, err := stateUpdateResponseToStateDiff(update)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, deployed := range stateDiff.DeployedContracts {
+					contractHashMap[remove0x(deployed.Address)], _ = new(big.Int).SetString(remove0x(deployed.ContractHash), 16)
+				}
+
+				var root string
+				err = database.RunTxn(func(txn db.DatabaseOperations) (err error) {
+					if err := checkOldRoot(txn, update.OldRoot); err != nil {
+						return err
+					}
+					root, err = updateState(context.Background(), txn, contractHashMap, nil, &stateDiff, "", block.number)
+					return err
+				})
+				if err != nil {
+					t.Fatalf("block %d: %s", block.number, err)
+				}
+				if root != remove0x(update.NewRoot) {
+					t.Fatalf("block %d: state root = %s, want %s", block.number, root, remove0x(update.NewRoot))
+				}
+			}
+		})
+	}
+}
+
+// replayFixture is a state update fixture of TestReplayStateUpdates.
+type replayFixture struct {
+	number uint64
+	path   string
+}
+
+// replayFixtures returns the state update fixtures of network in block
+// order.
+func replayFixtures(t *testing.T, network string) []replayFixture {
+	t.Helper()
+	dir := filepath.Join("testdata", "state_updates", network)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := make([]replayFixture, 0, len(files))
+	for _, file := range files {
+		number, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), ".json"), 10, 64)
+		if err != nil {
+			t.Fatalf("unexpected fixture %s", file.Name())
+		}
+		blocks = append(blocks, replayFixture{number, filepath.Join(dir, file.Name())})
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].number < blocks[j].number })
+	return blocks
+}
+
+func TestCheckOldRoot(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(1)}
+	update := starknetTypes.StateDiff{
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{"1": {{Key: "a", Value: "b"}}}),
+	}
+
+	var root string
+	err = database.RunTxn(func(txn db.DatabaseOperations) (err error) {
+		// A fresh database holds the empty state.
+		for _, oldRoot := range []string{"", "0x0", "0"} {
+			if err := checkOldRoot(txn, oldRoot); err != nil {
+				t.Errorf("checkOldRoot(%q) on an empty state: %s", oldRoot, err)
+			}
+		}
+		if err := checkOldRoot(txn, "0x1"); !errors.Is(err, errOldRootMismatch) {
+			t.Errorf("checkOldRoot(0x1) on an empty state = %v, want %v", err, errOldRootMismatch)
+		}
+
+		root, err = updateState(context.Background(), txn, contractHashMap, nil, &update, "", 0)
+		if err != nil {
+			return err
+		}
+		if err := checkOldRoot(txn, "0x"+root); err != nil {
+			t.Errorf("checkOldRoot(0x%s) after applying the block: %s", root, err)
+		}
+		if err := checkOldRoot(txn, "0x0"); !errors.Is(err, errOldRootMismatch) {
+			t.Errorf("checkOldRoot(0x0) after applying the block = %v, want %v", err, errOldRootMismatch)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateStateInvalidStorageValue(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(1)}
+	update := starknetTypes.StateDiff{
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{"1": {{Key: "a", Value: "not hex"}}}),
+	}
+	var updateErr error
+	_ = database.RunTxn(func(txn db.DatabaseOperations) error {
+		_, updateErr = updateState(context.Background(), txn, contractHashMap, nil, &update, "", 0)
+		return updateErr
+	})
+	if !errors.Is(updateErr, types.ErrInvalidFeltHex) {
+		t.Errorf("got error %v, want %v", updateErr, types.ErrInvalidFeltHex)
+	}
+}
+
+func TestUpdateStateCancelled(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(1)}
+	update := starknetTypes.StateDiff{
+		StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{"1": {{Key: "a", Value: "b"}}}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var updateErr error
+	_ = database.RunTxn(func(txn db.DatabaseOperations) error {
+		_, updateErr = updateState(ctx, txn, contractHashMap, nil, &update, "", 0)
+		return updateErr
+	})
+	if !errors.Is(updateErr, context.Canceled) {
+		t.Errorf("got error %v, want %v", updateErr, context.Canceled)
+	}
+}
+
+func TestStateUpdateResponseToStateDiffInvalidAddress(t *testing.T) {
+	update := feeder.StateUpdateResponse{
+		StateDiff: feeder.StateDiff{
+			StorageDiffs: map[string][]feeder.KV{"key_address": {{Key: "0x1", Value: "0x2"}}},
+		},
+	}
+	if _, err := stateUpdateResponseToStateDiff(update); !errors.Is(err, types.ErrInvalidFeltHex) {
+		t.Errorf("got error %v, want %v", err, types.ErrInvalidFeltHex)
+	}
+}
+
+func TestDecodeLogMessageToL2(t *testing.T) {
+	contracts := make(map[common.Address]starknetTypes.ContractInfo)
+	if err := loadContractInfo("0x1", starknetAbi.StarknetAbi, contracts, "LogMessageToL2"); err != nil {
+		t.Fatal(err)
+	}
+	contract := contracts[common.HexToAddress("0x1")]
+	event := contract.Contract.Events["LogMessageToL2"]
+
+	fromAddress := common.HexToAddress("0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419")
+	toAddress, selector := big.NewInt(0x73314940), big.NewInt(0x2d757788)
+	payload := []*big.Int{big.NewInt(1), big.NewInt(2)}
+	nonce := big.NewInt(7)
+	data, err := event.Inputs.NonIndexed().Pack(payload, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vLog := ethTypes.Log{
+		Topics: []common.Hash{
+			event.ID,
+			common.BytesToHash(fromAddress.Bytes()),
+			common.BigToHash(toAddress),
+			common.BigToHash(selector),
+		},
+		Data:        data,
+		BlockNumber: 10,
+	}
+
+	info, err := decodeLog(contract, vLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "LogMessageToL2" || info.Block != 10 {
+		t.Errorf("decodeLog returned event %s at block %d", info.Name, info.Block)
+	}
+	if got := info.Event["fromAddress"]; got != fromAddress {
+		t.Errorf("fromAddress = %v, want %v", got, fromAddress)
+	}
+
+	hash, err := l1ToL2MessageHash(info.Event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []byte
+	for _, word := range []*big.Int{
+		new(big.Int).SetBytes(fromAddress.Bytes()), toAddress, nonce, selector, big.NewInt(2), payload[0], payload[1],
+	} {
+		want = append(want, common.BigToHash(word).Bytes()...)
+	}
+	if hash != crypto.Keccak256Hash(want) {
+		t.Errorf("message hash = %s, want %s", hash, crypto.Keccak256Hash(want))
+	}
+
+	if _, err := decodeLog(contract, ethTypes.Log{}); err == nil {
+		t.Error("decodeLog did not fail on a log without topics")
+	}
+	if _, err := l1ToL2MessageHash(map[string]interface{}{}); err == nil {
+		t.Error("l1ToL2MessageHash did not fail without the event arguments")
+	}
+}
+
+func TestUpdateStateNamespaced(t *testing.T) {
+	env, err := db.NewMDBXEnv(t.TempDir(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.NewMDBXDatabase(env, "TEST-DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractHashMap := map[string]*big.Int{"1": big.NewInt(1)}
+
+	// The same contract is updated with different values on each chain.
+	for _, tc := range []struct {
+		chainID int64
+		value   int64
+	}{{mainnetChainID, 0xb}, {goerliChainID, 0xc}} {
+		chainDb := db.NewNamespacedDatabase(database, ChainNamespace(tc.chainID))
+		update := starknetTypes.StateDiff{
+			DeployedContracts: []starknetTypes.DeployedContract{{Address: "1", ContractHash: "1"}},
+			StorageDiffs: newStorageDiffs(map[string][]starknetTypes.KV{
+				"1": {{Key: "a", Value: big.NewInt(tc.value).Text(16)}},
+			}),
+		}
+		var commitment string
+		err = chainDb.RunTxn(func(txn db.DatabaseOperations) (err error) {
+			commitment, err = updateState(context.Background(), txn, contractHashMap, nil, &update, "", 0)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		storageTrie := trietest.BuildTrie(t, map[*types.Felt]*types.Felt{
+			feltPtr(big.NewInt(0xa)): feltPtr(big.NewInt(tc.value)),
+		}, 251)
+		stateTrie := trietest.BuildTrie(t, map[*types.Felt]*types.Felt{
+			feltPtr(big.NewInt(1)): feltPtr(contractState(big.NewInt(1), storageTrie.Commitment())),
+		}, 251)
+		trietest.AssertRoot(t, stateTrie, commitment)
+	}
+
+	// Each chain still sees its own storage.
+	for chainID, want := range map[int64]int64{mainnetChainID: 0xb, goerliChainID: 0xc} {
+		chainDb := db.NewNamespacedDatabase(database, ChainNamespace(chainID))
+		err = chainDb.RunTxn(func(txn db.DatabaseOperations) error {
+			if got, ok := newTrie(txn, "1").Get(big.NewInt(0xa)); !ok || got.Int64() != want {
+				t.Errorf("storage value on chain %d = %v, want %d", chainID, got, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyTxCommitment(t *testing.T) {
+	felts := func(values ...int64) []*types.Felt {
+		out := make([]*types.Felt, len(values))
+		for i, v := range values {
+			f := types.BigToFelt(big.NewInt(v))
+			out[i] = &f
+		}
+		return out
+	}
+	hashes := felts(0x10, 0x11, 0x12)
+	signatures := [][]*types.Felt{felts(0x1, 0x2), nil, felts()}
+
+	want := trie.New(store.New(), 64)
+	want.Put(big.NewInt(0), pedersen.Digest(big.NewInt(0x10), pedersen.ArrayDigest(big.NewInt(1), big.NewInt(2))))
+	want.Put(big.NewInt(1), pedersen.Digest(big.NewInt(0x11), pedersen.ArrayDigest()))
+	want.Put(big.NewInt(2), pedersen.Digest(big.NewInt(0x12), pedersen.ArrayDigest()))
+	commitment := TxCommitment(hashes, signatures)
+	if commitment.Big().Cmp(want.Commitment()) != 0 {
+		t.Fatalf("TxCommitment() = %s, want %x", commitment.Hex(), want.Commitment())
+	}
+
+	block := &types.Block{BlockNumber: 1, TxCount: 3, TxCommitment: *commitment}
+	tests := []struct {
+		name       string
+		hashes     []*types.Felt
+		signatures [][]*types.Felt
+		want       bool
+	}{
+		{"complete", hashes, signatures, true},
+		{"missing empty signatures", hashes, signatures[:1], true},
+		{"truncated", hashes[:2], signatures, false},
+		{"reordered", []*types.Felt{hashes[1], hashes[0], hashes[2]}, signatures, false},
+		{"wrong signature", hashes, [][]*types.Felt{felts(0x1)}, false},
+	}
+	for _, test := range tests {
+		if ok, err := VerifyTxCommitment(block, test.hashes, test.signatures); err != nil || ok != test.want {
+			t.Errorf("%s: VerifyTxCommitment() = %t, %v, want %t", test.name, ok, err, test.want)
+		}
+	}
+
+	unknown := &types.Block{BlockNumber: 1, TxCount: 3}
+	if _, err := VerifyTxCommitment(unknown, hashes, signatures); !errors.Is(err, ErrUnknownTxCommitment) {
+		t.Errorf("VerifyTxCommitment() of a block without commitment = %v, want %v", err, ErrUnknownTxCommitment)
+	}
+	if ok, err := VerifyTxCommitment(&types.Block{}, nil, nil); err != nil || !ok {
+		t.Errorf("VerifyTxCommitment() of an empty block = %t, %v, want true", ok, err)
+	}
 }
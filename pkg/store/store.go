@@ -3,10 +3,18 @@
 // beyond the running program is not required.
 package store
 
+import "errors"
+
+// ErrNotFound is returned by Get when the key isn't in the store. Any
+// other error means the store couldn't be read, and says nothing about
+// whether the key is in it.
+var ErrNotFound = errors.New("store: key not found")
+
 // Storer specifies the API for a []byte key-value store.
 type Storer interface {
 	Delete(key []byte)
-	Get(key []byte) ([]byte, bool)
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
 	Put(key, val []byte)
 }
 
@@ -28,14 +36,77 @@ func (e Ephemeral) Delete(key []byte) {
 	delete(e.table, string(key))
 }
 
-// Get retrieves a value associated with the given key and a bool
-// indicating whether the item was found.
-func (e Ephemeral) Get(key []byte) (item []byte, ok bool) {
-	item, ok = e.table[string(key)]
-	return
+// Get retrieves a value associated with the given key, or ErrNotFound
+// if the item isn't in ephemeral storage.
+func (e Ephemeral) Get(key []byte) ([]byte, error) {
+	item, ok := e.table[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return item, nil
+}
+
+// Has returns true if the given key is in ephemeral storage. It never
+// fails.
+func (e Ephemeral) Has(key []byte) (bool, error) {
+	_, ok := e.table[string(key)]
+	return ok, nil
 }
 
 // Put commits a key-value pair to ephemeral storage.
 func (e Ephemeral) Put(key, val []byte) {
 	e.table[string(key)] = val
 }
+
+// Overlay is a key-value store whose writes are kept in memory on top
+// of a base store, which is read but never modified.
+type Overlay struct {
+	base    Storer
+	table   map[string][]byte
+	deleted map[string]struct{}
+}
+
+// NewOverlay creates an overlay on top of base. A nil base is an empty
+// store.
+func NewOverlay(base Storer) Overlay {
+	return Overlay{base: base, table: make(map[string][]byte), deleted: make(map[string]struct{})}
+}
+
+// Delete removes a key and associated value from the overlay. The key
+// is hidden from the base store.
+func (o Overlay) Delete(key []byte) {
+	delete(o.table, string(key))
+	o.deleted[string(key)] = struct{}{}
+}
+
+// Get retrieves a value associated with the given key from the overlay,
+// or from the base store if it hasn't been written or deleted. It
+// returns ErrNotFound if the item is in neither, and the error of the
+// base store if it can't be read.
+func (o Overlay) Get(key []byte) ([]byte, error) {
+	if item, ok := o.table[string(key)]; ok {
+		return item, nil
+	}
+	if _, ok := o.deleted[string(key)]; ok || o.base == nil {
+		return nil, ErrNotFound
+	}
+	return o.base.Get(key)
+}
+
+// Has returns true if the given key is in the overlay or, unless it has
+// been deleted, in the base store.
+func (o Overlay) Has(key []byte) (bool, error) {
+	if _, ok := o.table[string(key)]; ok {
+		return true, nil
+	}
+	if _, ok := o.deleted[string(key)]; ok || o.base == nil {
+		return false, nil
+	}
+	return o.base.Has(key)
+}
+
+// Put commits a key-value pair to the overlay.
+func (o Overlay) Put(key, val []byte) {
+	delete(o.deleted, string(key))
+	o.table[string(key)] = val
+}
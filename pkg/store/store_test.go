@@ -2,6 +2,7 @@ package store
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -23,8 +24,7 @@ func TestDelete(t *testing.T) {
 	for _, test := range tests {
 		t.Run(fmt.Sprintf("delete(%#v)", test.key), func(t *testing.T) {
 			store.Delete(test.key)
-			_, ok := store.Get(test.key)
-			if ok {
+			if _, err := store.Get(test.key); !errors.Is(err, ErrNotFound) {
 				t.Errorf("key %#v not successfully removed from storage", test.key)
 			}
 		})
@@ -39,12 +39,15 @@ func TestGet(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(fmt.Sprintf("get(%#v) = %#v", test.key, test.val), func(t *testing.T) {
-			got, _ := store.Get(test.key)
-			if !bytes.Equal(got, test.val) {
-				t.Errorf("get(%#v) = %#v, want %#v", test.key, got, test.val)
+			got, err := store.Get(test.key)
+			if err != nil || !bytes.Equal(got, test.val) {
+				t.Errorf("get(%#v) = %#v, %v, want %#v", test.key, got, err, test.val)
 			}
 		})
 	}
+	if _, err := store.Get([]byte{7}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get(%#v) error = %v, want %v", []byte{7}, err, ErrNotFound)
+	}
 }
 
 func TestPut(t *testing.T) {
@@ -55,3 +58,94 @@ func TestPut(t *testing.T) {
 		})
 	}
 }
+
+func TestHas(t *testing.T) {
+	store := New()
+	for _, test := range tests {
+		store.Put(test.key, test.val)
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("has(%#v)", test.key), func(t *testing.T) {
+			if has, _ := store.Has(test.key); !has {
+				t.Errorf("has(%#v) = false, want true", test.key)
+			}
+		})
+	}
+	if has, _ := store.Has([]byte{7}); has {
+		t.Errorf("has(%#v) = true, want false", []byte{7})
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	base := New()
+	for _, test := range tests {
+		base.Put(test.key, test.val)
+	}
+	overlay := NewOverlay(base)
+	overlay.Put([]byte{2}, []byte{9})
+	overlay.Put([]byte{7}, []byte{1})
+	overlay.Delete([]byte{3})
+
+	for _, test := range []struct {
+		key, val []byte
+		ok       bool
+	}{
+		{[]byte{2}, []byte{9}, true},
+		{[]byte{3}, nil, false},
+		{[]byte{5}, []byte{1}, true},
+		{[]byte{7}, []byte{1}, true},
+	} {
+		got, err := overlay.Get(test.key)
+		if ok := err == nil; ok != test.ok || !bytes.Equal(got, test.val) {
+			t.Errorf("get(%#v) = %#v, %v, want %#v, %t", test.key, got, err, test.val, test.ok)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			t.Errorf("get(%#v) error = %v, want %v", test.key, err, ErrNotFound)
+		}
+		if has, _ := overlay.Has(test.key); has != test.ok {
+			t.Errorf("has(%#v) = %t, want %t", test.key, has, test.ok)
+		}
+	}
+	// The base store is never modified.
+	for _, test := range tests {
+		if got, _ := base.Get(test.key); !bytes.Equal(got, test.val) {
+			t.Errorf("base get(%#v) = %#v, want %#v", test.key, got, test.val)
+		}
+	}
+	if has, _ := base.Has([]byte{7}); has {
+		t.Errorf("base has(%#v) = true, want false", []byte{7})
+	}
+
+	if _, err := NewOverlay(nil).Get([]byte{2}); !errors.Is(err, ErrNotFound) {
+		t.Error("an overlay without a base must be empty")
+	}
+}
+
+// failingStore is a store whose reads always fail.
+type failingStore struct{ Ephemeral }
+
+var errRead = errors.New("read failed")
+
+func (failingStore) Get([]byte) ([]byte, error) { return nil, errRead }
+func (failingStore) Has([]byte) (bool, error)   { return false, errRead }
+
+func TestOverlayBaseError(t *testing.T) {
+	overlay := NewOverlay(failingStore{New()})
+	overlay.Put([]byte{2}, []byte{1})
+	overlay.Delete([]byte{3})
+
+	if _, err := overlay.Get([]byte{5}); !errors.Is(err, errRead) {
+		t.Errorf("get from a failing base returned %v, want %v", err, errRead)
+	}
+	if _, err := overlay.Has([]byte{5}); !errors.Is(err, errRead) {
+		t.Errorf("has from a failing base returned %v, want %v", err, errRead)
+	}
+	// Keys written or deleted in the overlay don't read the base.
+	if _, err := overlay.Get([]byte{2}); err != nil {
+		t.Errorf("get(%#v) returned %v, want nil", []byte{2}, err)
+	}
+	if _, err := overlay.Get([]byte{3}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get(%#v) returned %v, want %v", []byte{3}, err, ErrNotFound)
+	}
+}
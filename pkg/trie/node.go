@@ -2,11 +2,28 @@ package trie
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/NethermindEth/juno/pkg/crypto/pedersen"
 )
 
+// Stored nodes are prefixed with a version byte that identifies the
+// format of the rest of the value, so that nodes in different formats can
+// coexist in storage while they are migrated. Nodes stored before the
+// version byte was introduced are plain JSON objects. Nodes are only
+// rewritten in the current format when the trie is updated, so reading a
+// trie never writes to storage.
+const (
+	// nodeVersionJSON is a version byte followed by the JSON encoding of
+	// the node.
+	nodeVersionJSON byte = 1
+	// nodeVersion is the version used to store new nodes.
+	nodeVersion = nodeVersionJSON
+)
+
 // Encoding represents the Encoding of a node in a binary tree
 // represented by the triplet (length, path, bottom).
 type Encoding struct {
@@ -21,10 +38,42 @@ type Node struct {
 	Hash *big.Int `json:"hash"`
 }
 
-// bytes returns a JSON byte representation of a node.
+// bytes returns the byte representation of a node in the current
+// version.
 func (n *Node) bytes() []byte {
 	b, _ := json.Marshal(n)
-	return b
+	return append([]byte{nodeVersion}, b...)
+}
+
+// decodeNode decodes a stored node in any known version. maxLength is
+// the longest edge the node can have, that is, the number of levels below
+// it, and a node with a longer edge or without a bottom or hash is
+// rejected.
+func decodeNode(b []byte, maxLength int) (n Node, err error) {
+	if len(b) == 0 {
+		return Node{}, errors.New("empty node")
+	}
+	switch b[0] {
+	case '{':
+		// Unversioned JSON node.
+		err = json.Unmarshal(b, &n)
+	case nodeVersionJSON:
+		err = json.Unmarshal(b[1:], &n)
+	default:
+		return Node{}, fmt.Errorf("unknown node version %d", b[0])
+	}
+	if err != nil {
+		return Node{}, err
+	}
+	switch {
+	case int(n.Length) > maxLength:
+		return Node{}, fmt.Errorf("edge of length %d below which there are %d levels", n.Length, maxLength)
+	case n.Bottom == nil:
+		return Node{}, errors.New("missing bottom")
+	case n.Hash == nil:
+		return Node{}, errors.New("missing hash")
+	}
+	return n, nil
 }
 
 // hash updates the node hash.
@@ -36,3 +85,71 @@ func (n *Node) hash() {
 	h := pedersen.Digest(n.Bottom, n.Path)
 	n.Hash = h.Add(h, new(big.Int).SetUint64(uint64(n.Length)))
 }
+
+// ErrPathBounds is returned when a bit outside of the path of an edge is
+// accessed, or when an edge would grow longer than its length can hold.
+var ErrPathBounds = errors.New("trie: bit out of the edge path")
+
+// checkBit returns an error if i isn't the index of a bit of the path.
+// Bits are numbered from the bottom of the edge, so bit Length-1 is the
+// first bit below the node.
+func (e *Encoding) checkBit(i int) error {
+	if i < 0 || i >= int(e.Length) {
+		return fmt.Errorf("%w: bit %d of a path of length %d", ErrPathBounds, i, e.Length)
+	}
+	return nil
+}
+
+// Bit returns bit i of the path, where bit Length-1 is the first bit
+// below the node.
+func (e *Encoding) Bit(i int) (uint, error) {
+	if err := e.checkBit(i); err != nil {
+		return 0, err
+	}
+	if e.Path == nil {
+		return 0, nil
+	}
+	return e.Path.Bit(i), nil
+}
+
+// SetBit sets bit i of the path to 1, where bit Length-1 is the first bit
+// below the node.
+func (e *Encoding) SetBit(i int) error {
+	return e.setBit(i, 1)
+}
+
+// ClearBit sets bit i of the path to 0, where bit Length-1 is the first
+// bit below the node.
+func (e *Encoding) ClearBit(i int) error {
+	return e.setBit(i, 0)
+}
+
+func (e *Encoding) setBit(i int, b uint) error {
+	if err := e.checkBit(i); err != nil {
+		return err
+	}
+	if e.Path == nil {
+		e.Path = new(big.Int)
+	}
+	e.Path.SetBit(e.Path, i, b)
+	return nil
+}
+
+// extend returns the encoding of the edge to the bottom of e from the
+// parent of its node, whose path starts with bit b. The path of e isn't
+// modified.
+func (e *Encoding) extend(b uint) (Encoding, error) {
+	if e.Length == math.MaxUint8 {
+		return Encoding{}, fmt.Errorf("%w: edge longer than %d bits", ErrPathBounds, math.MaxUint8)
+	}
+	path := new(big.Int)
+	if e.Path != nil {
+		path.Set(e.Path)
+	}
+	ext := Encoding{e.Length + 1, path, new(big.Int).Set(e.Bottom)}
+	if err := ext.setBit(int(e.Length), b); err != nil {
+		// notest
+		return Encoding{}, err
+	}
+	return ext, nil
+}
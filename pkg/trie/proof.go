@@ -0,0 +1,133 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/NethermindEth/juno/pkg/crypto/pedersen"
+)
+
+// ErrInvalidProof is returned by VerifyProof when a proof doesn't lead
+// from the root to the key.
+var ErrInvalidProof = errors.New("trie: invalid proof")
+
+// BinaryNode is a node with two children in a proof, given by their
+// hashes.
+type BinaryNode struct {
+	Left  *big.Int `json:"left"`
+	Right *big.Int `json:"right"`
+}
+
+// EdgeNode is a node in a proof that compresses a path of Length bits,
+// most significant first, down to the node whose hash is Child.
+type EdgeNode struct {
+	Child  *big.Int `json:"child"`
+	Path   *big.Int `json:"path"`
+	Length uint8    `json:"length"`
+}
+
+// ProofNode is a node of a proof. Exactly one of Binary and Edge is set.
+type ProofNode struct {
+	Binary *BinaryNode `json:"binary,omitempty"`
+	Edge   *EdgeNode   `json:"edge,omitempty"`
+}
+
+// hash returns the hash of the node, which is the one its parent commits
+// to.
+func (n *ProofNode) hash() *big.Int {
+	if n.Binary != nil {
+		return pedersen.Digest(n.Binary.Left, n.Binary.Right)
+	}
+	h := pedersen.Digest(n.Edge.Child, n.Edge.Path)
+	return h.Add(h, new(big.Int).SetUint64(uint64(n.Edge.Length)))
+}
+
+// edgePath returns the bits of the path of an edge node in the format of
+// the stored paths.
+func edgePath(path *big.Int, length uint8) []byte {
+	return Prefix(Reversed(path, int(length)), int(length))
+}
+
+// Prove returns the nodes on the path from the root of the trie to the
+// key, which prove the value of the key or, if the path leaves the key
+// on an edge, that the key isn't in the trie. The proof of a key in an
+// empty trie is empty.
+func (t *Trie) Prove(key *big.Int) []ProofNode {
+	path := Prefix(Reversed(key, t.keyLen), t.keyLen)
+	var proof []ProofNode
+	for height := 0; height < t.keyLen; {
+		n, ok := t.retrieve(path[:height])
+		if !ok {
+			// Only the root of an empty trie is missing.
+			return proof
+		}
+		if n.Length == 0 {
+			left, _, right, _ := t.childNodes(path[:height])
+			proof = append(proof, ProofNode{Binary: &BinaryNode{Left: left.Hash, Right: right.Hash}})
+			height++
+			continue
+		}
+		proof = append(proof, ProofNode{Edge: &EdgeNode{
+			Child: new(big.Int).Set(n.Bottom), Path: new(big.Int).Set(n.Path), Length: n.Length,
+		}})
+		end := height + int(n.Length)
+		if string(path[height:end]) != string(edgePath(n.Path, n.Length)) {
+			return proof
+		}
+		height = end
+	}
+	return proof
+}
+
+// VerifyProof checks a proof returned by Prove for a key in a trie of
+// the given key length and commitment root. It returns the value of the
+// key, or nil if the proof shows the key isn't in the trie.
+func VerifyProof(root, key *big.Int, keyLen int, proof []ProofNode) (*big.Int, error) {
+	if len(proof) == 0 {
+		if root.Sign() != 0 {
+			return nil, fmt.Errorf("%w: empty proof of a non-empty trie", ErrInvalidProof)
+		}
+		return nil, nil
+	}
+	path := Prefix(Reversed(key, keyLen), keyLen)
+	expected := root
+	height := 0
+	for i := range proof {
+		n := &proof[i]
+		if (n.Binary == nil) == (n.Edge == nil) {
+			return nil, fmt.Errorf("%w: node %d is neither binary nor edge", ErrInvalidProof, i)
+		}
+		if height >= keyLen {
+			return nil, fmt.Errorf("%w: node %d is below the leaves", ErrInvalidProof, i)
+		}
+		if n.hash().Cmp(expected) != 0 {
+			return nil, fmt.Errorf("%w: hash of node %d doesn't match its parent", ErrInvalidProof, i)
+		}
+		if n.Binary != nil {
+			if path[height] == 48 /* "0" */ {
+				expected = n.Binary.Left
+			} else {
+				expected = n.Binary.Right
+			}
+			height++
+			continue
+		}
+		end := height + int(n.Edge.Length)
+		if end > keyLen {
+			return nil, fmt.Errorf("%w: edge of node %d is longer than the key", ErrInvalidProof, i)
+		}
+		if string(path[height:end]) != string(edgePath(n.Edge.Path, n.Edge.Length)) {
+			if i != len(proof)-1 {
+				return nil, fmt.Errorf("%w: nodes after the edge leaving the key", ErrInvalidProof)
+			}
+			return nil, nil
+		}
+		expected = n.Edge.Child
+		height = end
+	}
+	if height != keyLen {
+		return nil, fmt.Errorf("%w: proof ends above the leaves", ErrInvalidProof)
+	}
+	return expected, nil
+}
@@ -0,0 +1,197 @@
+package trie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/NethermindEth/juno/pkg/store"
+)
+
+// A snapshot is a single file with every node reachable from the root of
+// a trie, meant to be kept apart from the live database as a cold copy of
+// the state. It is written front to back, so it can be streamed, and is
+// laid out as follows (integers are big-endian):
+//
+//	header:  snapshotMagic, height (uint16), number of nodes (uint64)
+//	index:   for each node, key length (uint16), key, offset of the value
+//	         from the start of the data (uint64), value length (uint32)
+//	data:    the values of the nodes, in index order
+//
+// Keys and values are the ones the trie stores, so a snapshot is read
+// back through a store with the same keys.
+var snapshotMagic = [8]byte{'j', 'u', 'n', 'o', 't', 'r', 'i', 'e'}
+
+// ErrInvalidSnapshot is returned when a snapshot is malformed or doesn't
+// match the trie it's opened as.
+var ErrInvalidSnapshot = errors.New("trie: invalid snapshot")
+
+// snapshotNode is a stored node of a trie.
+type snapshotNode struct {
+	key, val []byte
+}
+
+// WriteSnapshot writes every node reachable from the root of the trie to
+// w in the snapshot format. The nodes are written in the current version,
+// so a trie opened from the snapshot never has to upgrade them.
+func (t *Trie) WriteSnapshot(w io.Writer) error {
+	var nodes []snapshotNode
+	var walk func(path []byte)
+	walk = func(path []byte) {
+		n, ok := t.retrieve(path)
+		if !ok {
+			return
+		}
+		key := path
+		if len(key) == 0 {
+			key = []byte("root")
+		}
+		nodes = append(nodes, snapshotNode{key, n.bytes()})
+		if len(path) == t.keyLen {
+			return
+		}
+		walk(append(path[:len(path):len(path)], 48 /* "0" */))
+		walk(append(path[:len(path):len(path)], 49 /* "1" */))
+	}
+	walk([]byte{})
+	if err := t.Err(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(snapshotMagic[:])
+	binary.Write(bw, binary.BigEndian, uint16(t.keyLen))
+	binary.Write(bw, binary.BigEndian, uint64(len(nodes)))
+	var offset uint64
+	for _, n := range nodes {
+		binary.Write(bw, binary.BigEndian, uint16(len(n.key)))
+		bw.Write(n.key)
+		binary.Write(bw, binary.BigEndian, offset)
+		binary.Write(bw, binary.BigEndian, uint32(len(n.val)))
+		offset += uint64(len(n.val))
+	}
+	for _, n := range nodes {
+		bw.Write(n.val)
+	}
+	// bufio.Writer keeps the first error, so checking it once on Flush
+	// covers every write above.
+	return bw.Flush()
+}
+
+// snapshotSpan is the position of a value in the data of a snapshot.
+type snapshotSpan struct {
+	offset int64
+	length uint32
+}
+
+// snapshotStore is a read-only store over a snapshot. The index is kept
+// in memory and the values are read from the snapshot when they are
+// needed.
+type snapshotStore struct {
+	r     io.ReaderAt
+	data  int64
+	index map[string]snapshotSpan
+}
+
+// Get reads the value of the given key from the snapshot.
+func (s snapshotStore) Get(key []byte) ([]byte, error) {
+	span, ok := s.index[string(key)]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	val := make([]byte, span.length)
+	if _, err := s.r.ReadAt(val, s.data+span.offset); err != nil {
+		// notest
+		return nil, fmt.Errorf("trie: read snapshot: %w", err)
+	}
+	return val, nil
+}
+
+// Has returns true if the key is in the snapshot.
+func (s snapshotStore) Has(key []byte) (bool, error) {
+	_, ok := s.index[string(key)]
+	return ok, nil
+}
+
+// Put panics since a snapshot can't be modified.
+func (s snapshotStore) Put([]byte, []byte) {
+	panic("trie: snapshot is read-only")
+}
+
+// Delete panics since a snapshot can't be modified.
+func (s snapshotStore) Delete([]byte) {
+	panic("trie: snapshot is read-only")
+}
+
+// OpenSnapshotTrie opens a snapshot written by WriteSnapshot as a
+// read-only trie of the given height. The commitment of the snapshot
+// must be root. Only the index is read when the snapshot is opened, and
+// r must stay readable for as long as the trie is used. Putting or
+// deleting keys in the trie panics.
+func OpenSnapshotTrie(r io.ReaderAt, root *big.Int, height int) (*Trie, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 0, math.MaxInt64))
+	var header struct {
+		Magic  [8]byte
+		Height uint16
+		Count  uint64
+	}
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrInvalidSnapshot, err)
+	}
+	if header.Magic != snapshotMagic {
+		return nil, fmt.Errorf("%w: unknown format", ErrInvalidSnapshot)
+	}
+	if int(header.Height) != height {
+		return nil, fmt.Errorf("%w: height is %d, want %d", ErrInvalidSnapshot, header.Height, height)
+	}
+
+	s := snapshotStore{r: r, index: make(map[string]snapshotSpan)}
+	// The data starts after the header, whose size is that of the struct
+	// since it has no padding in the binary encoding.
+	s.data = int64(binary.Size(header))
+	var size int64
+	for i := uint64(0); i < header.Count; i++ {
+		var keyLen uint16
+		if err := binary.Read(br, binary.BigEndian, &keyLen); err != nil {
+			return nil, fmt.Errorf("%w: reading index: %v", ErrInvalidSnapshot, err)
+		}
+		key := make([]byte, keyLen)
+		var span struct {
+			Offset uint64
+			Length uint32
+		}
+		if _, err := io.ReadFull(br, key); err != nil {
+			return nil, fmt.Errorf("%w: reading index: %v", ErrInvalidSnapshot, err)
+		}
+		if err := binary.Read(br, binary.BigEndian, &span); err != nil {
+			return nil, fmt.Errorf("%w: reading index: %v", ErrInvalidSnapshot, err)
+		}
+		s.index[string(key)] = snapshotSpan{int64(span.Offset), span.Length}
+		s.data += int64(2 + len(key) + binary.Size(span))
+		if end := int64(span.Offset) + int64(span.Length); end > size {
+			size = end
+		}
+	}
+	// A snapshot cut short in the data would only fail when the missing
+	// nodes are read, so its last byte is checked up front.
+	if size > 0 {
+		if _, err := r.ReadAt(make([]byte, 1), s.data+size-1); err != nil {
+			return nil, fmt.Errorf("%w: reading data: %v", ErrInvalidSnapshot, err)
+		}
+	}
+
+	t := New(s, height)
+	commitment := t.Commitment()
+	if err := t.Err(); err != nil {
+		// notest
+		return nil, fmt.Errorf("%w: reading root: %v", ErrInvalidSnapshot, err)
+	}
+	if commitment.Cmp(root) != 0 {
+		return nil, fmt.Errorf("%w: root is %#x, want %#x", ErrInvalidSnapshot, commitment, root)
+	}
+	return &t, nil
+}
@@ -0,0 +1,73 @@
+package trie
+
+// TrieStats describes the shape of a trie in terms of the nodes of the
+// StarkNet commitment: binary nodes with two children, edge nodes that
+// compress a path with a single child, and leaves. Every node along an
+// edge is stored, but an edge is counted once, at its top.
+type TrieStats struct {
+	Binary int
+	Edge   int
+	Leaves int
+
+	// PathLengths is the number of edge nodes by the length of their path.
+	PathLengths   map[int]int
+	MaxPathLength int
+	AvgPathLength float64
+
+	// LeafDepths is the number of leaves by the number of binary and edge
+	// nodes above them.
+	LeafDepths   map[int]int
+	MaxLeafDepth int
+	AvgLeafDepth float64
+}
+
+// Stats traverses the trie and returns its TrieStats. Nodes are read one
+// at a time, so only the current path is kept in memory, but every
+// stored node is read.
+func (t *Trie) Stats() TrieStats {
+	stats := TrieStats{PathLengths: make(map[int]int), LeafDepths: make(map[int]int)}
+	var pathLengths, leafDepths int
+
+	// depth is the number of binary and edge nodes above path, and
+	// inEdge is whether path is below the top of an edge.
+	var walk func(path []byte, depth int, inEdge bool)
+	walk = func(path []byte, depth int, inEdge bool) {
+		n, ok := t.retrieve(path)
+		if !ok {
+			return
+		}
+		switch {
+		case len(path) == t.keyLen:
+			stats.Leaves++
+			stats.LeafDepths[depth]++
+			leafDepths += depth
+			if depth > stats.MaxLeafDepth {
+				stats.MaxLeafDepth = depth
+			}
+			return
+		case n.Length == 0:
+			stats.Binary++
+			depth, inEdge = depth+1, false
+		case !inEdge:
+			length := int(n.Length)
+			stats.Edge++
+			stats.PathLengths[length]++
+			pathLengths += length
+			if length > stats.MaxPathLength {
+				stats.MaxPathLength = length
+			}
+			depth, inEdge = depth+1, true
+		}
+		walk(append(path[:len(path):len(path)], 48 /* "0" */), depth, inEdge)
+		walk(append(path[:len(path):len(path)], 49 /* "1" */), depth, inEdge)
+	}
+	walk([]byte{}, 0, false)
+
+	if stats.Edge > 0 {
+		stats.AvgPathLength = float64(pathLengths) / float64(stats.Edge)
+	}
+	if stats.Leaves > 0 {
+		stats.AvgLeafDepth = float64(leafDepths) / float64(stats.Leaves)
+	}
+	return stats
+}
@@ -28,11 +28,17 @@
 package trie
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
+	"fmt"
 	"math/big"
+	"runtime"
+	"sort"
+	"sync"
 
 	"github.com/NethermindEth/juno/pkg/crypto/pedersen"
 	"github.com/NethermindEth/juno/pkg/store"
+	"github.com/NethermindEth/juno/pkg/types"
 )
 
 // A visualisation of the trie with 3-bit keys which results in a tree
@@ -59,10 +65,21 @@ import (
 // compute the new node encodings and hashes which result in a new tree
 // commitment.
 
+// ErrNodeNotFound is returned by Children when the node, or a child
+// that its encoding says exists, isn't in storage.
+var ErrNodeNotFound = errors.New("trie: node not found")
+
+// ErrCorruptTrie is the error of a trie with a stored node that can't be
+// decoded or whose encoding is invalid, such as an edge longer than the
+// levels below the node.
+var ErrCorruptTrie = errors.New("trie: corrupt node")
+
 // Trie represents a binary trie.
 type Trie struct {
 	keyLen int
 	store  store.Storer
+	// err is the first error of the store other than a missing key.
+	err error
 }
 
 // New constructs a new binary trie.
@@ -70,6 +87,70 @@ func New(store store.Storer, keyLen int) Trie {
 	return Trie{keyLen: keyLen, store: store}
 }
 
+// NewComputeOnly constructs a trie that computes the commitments of
+// updates without persisting any node, for example to verify that a
+// state diff produces a claimed root. The nodes of base, which must be
+// the trie with the given root, are read but never modified; the nodes
+// written by updates are kept in memory and discarded with the trie. A
+// nil base is an empty trie, whose root is 0, so no database is needed
+// to verify updates from the empty state.
+func NewComputeOnly(base store.Storer, root *big.Int, keyLen int) (Trie, error) {
+	t := New(store.NewOverlay(base), keyLen)
+	got := t.Commitment()
+	if err := t.Err(); err != nil {
+		return Trie{}, err
+	}
+	if got.Cmp(root) != 0 {
+		return Trie{}, fmt.Errorf("trie: base root is %x, want %x", got, root)
+	}
+	return t, nil
+}
+
+// RootHashAfter returns the commitment the trie would have after putting
+// the values at the keys, in order, without modifying the trie or its
+// store. As with Put, a value of 0 deletes the key. An error is returned
+// if the number of keys and values differ or a key is longer than the
+// trie's key length.
+func (t *Trie) RootHashAfter(keys, values []*types.Felt) (*types.Felt, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("trie: %d keys but %d values", len(keys), len(values))
+	}
+	computed, err := NewComputeOnly(t.store, t.Commitment(), t.keyLen)
+	if err != nil {
+		// notest
+		return nil, err
+	}
+	for i, key := range keys {
+		k := key.Big()
+		if k.BitLen() > t.keyLen {
+			return nil, fmt.Errorf("trie: key %s is longer than %d bits", key.Hex(), t.keyLen)
+		}
+		computed.Put(k, values[i].Big())
+	}
+	root := types.BigToFelt(computed.Commitment())
+	if err := computed.Err(); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// Err returns the first error the store returned while the trie was
+// used, other than a key not being found, or an ErrCorruptTrie for the
+// first stored node that couldn't be decoded. A node that can't be read
+// is taken as missing, so once Err isn't nil the values and commitment of
+// the trie can't be trusted, nor can the nodes written since, and Put
+// and Delete do nothing.
+func (t *Trie) Err() error {
+	return t.err
+}
+
+// fail records err as the error of the trie unless it already has one.
+func (t *Trie) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
 // commit persists the given key-value pair in storage.
 func (t *Trie) commit(key, val []byte) {
 	if len(key) == 0 {
@@ -86,34 +167,118 @@ func (t *Trie) remove(key []byte) {
 	t.store.Delete(key)
 }
 
+// exists returns true if a node with the given key is in storage.
+func (t *Trie) exists(key []byte) bool {
+	if len(key) == 0 {
+		key = []byte("root")
+	}
+	has, err := t.store.Has(key)
+	if err != nil {
+		t.fail(err)
+		return false
+	}
+	return has
+}
+
 // retrieve gets a node from storage and returns true if the node was
-// found.
+// found. A node that can't be read or decoded isn't found, and the error
+// is recorded. An empty value is a missing node.
 func (t *Trie) retrieve(key []byte) (Node, bool) {
+	depth := len(key)
 	if len(key) == 0 {
 		key = []byte("root")
 	}
-	b, ok := t.store.Get(key)
-	if !ok {
+	b, err := t.store.Get(key)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			t.fail(err)
+		}
 		return Node{}, false
 	}
-	var n Node
-	if err := json.Unmarshal(b, &n); err != nil {
-		// notest
+	if len(b) == 0 {
+		return Node{}, false
+	}
+	n, err := decodeNode(b, t.keyLen-depth)
+	if err != nil {
+		t.fail(fmt.Errorf("%w at path %q (depth %d): %v", ErrCorruptTrie, key, depth, err))
 		return Node{}, false
 	}
 	return n, true
 }
 
+// childNodes gets the nodes stored immediately below the node at the
+// given path and reports which of them were found.
+func (t *Trie) childNodes(parent []byte) (left Node, leftOk bool, right Node, rightOk bool) {
+	parent = parent[:len(parent):len(parent)]
+	left, leftOk = t.retrieve(append(parent, 48 /* "0" */))
+	right, rightOk = t.retrieve(append(parent, 49 /* "1" */))
+	return left, leftOk, right, rightOk
+}
+
+// Children returns the children of the node at the given path, which is
+// a prefix of the reversed key as returned by Prefix. A leaf has no
+// children. A binary node has both. An edge node has a single child, the
+// node at the bottom of the edge, returned on the side of the edge's
+// first bit; its path is the node's path followed by the Length bits of
+// the edge's Path, most significant first. Nodes are stored under their
+// path, so it is the path rather than the node that identifies them.
+func (t *Trie) Children(path []byte) (left, right *Node, isLeaf bool, err error) {
+	if len(path) > t.keyLen {
+		return nil, nil, false, fmt.Errorf("path of %d bits is longer than the key", len(path))
+	}
+	n, ok := t.retrieve(path)
+	if err := t.Err(); err != nil {
+		return nil, nil, false, err
+	}
+	if !ok {
+		return nil, nil, false, fmt.Errorf("%w: %q", ErrNodeNotFound, path)
+	}
+	if len(path) == t.keyLen {
+		return nil, nil, true, nil
+	}
+	if n.Length == 0 {
+		l, leftOk, r, rightOk := t.childNodes(path)
+		if err := t.Err(); err != nil {
+			return nil, nil, false, err
+		}
+		if !leftOk || !rightOk {
+			// notest
+			return nil, nil, false, fmt.Errorf("%w: child of binary node %q", ErrNodeNotFound, path)
+		}
+		return &l, &r, false, nil
+	}
+	edge := edgePath(n.Path, n.Length)
+	if len(path)+len(edge) > t.keyLen {
+		// notest
+		return nil, nil, false, fmt.Errorf("edge of node %q is longer than the key", path)
+	}
+	child, ok := t.retrieve(append(path[:len(path):len(path)], edge...))
+	if err := t.Err(); err != nil {
+		return nil, nil, false, err
+	}
+	if !ok {
+		// notest
+		return nil, nil, false, fmt.Errorf("%w: bottom of edge node %q", ErrNodeNotFound, path)
+	}
+	if edge[0] == 48 /* "0" */ {
+		return &child, nil, false, nil
+	}
+	return nil, &child, false, nil
+}
+
 // diff traverses the tree upwards from the given path (key) starting
 // from the node that immediately precedes the bottom node and either
 // deletes the node if it its child nodes are empty or recomputes the
-// encoding and hashes otherwise.
+// encoding and hashes otherwise. It stops if a child can't be read,
+// since it would be taken as empty.
 func (t *Trie) diff(key *big.Int) {
 	for height := t.keyLen - 1; height >= 0; height-- {
 		parent := Prefix(key, height)
 
-		leftChild, leftChildIsNotEmpty := t.retrieve(append(parent, 48 /* "0" */))
-		rightChild, rightChildIsNotEmpty := t.retrieve(append(parent, 49 /* "1" */))
+		leftChild, leftChildIsNotEmpty, rightChild, rightChildIsNotEmpty := t.childNodes(parent)
+		if t.err != nil {
+			return
+		}
 
 		if !leftChildIsNotEmpty && !rightChildIsNotEmpty {
 			t.remove(parent)
@@ -121,27 +286,25 @@ func (t *Trie) diff(key *big.Int) {
 			// Overwrite the parent node.
 			n := new(Node)
 
-			// Compute its encoding.
+			// Compute its encoding. A single child is extended by the
+			// bit that leads to it.
+			var err error
 			switch {
 			case !rightChildIsNotEmpty:
-				n.Encoding = Encoding{
-					leftChild.Length + 1, leftChild.Path, new(big.Int).Set(leftChild.Bottom),
-				}
+				n.Encoding, err = leftChild.extend(0)
 			case !leftChildIsNotEmpty:
-				n.Encoding = Encoding{
-					rightChild.Length + 1,
-					rightChild.Path.Add(
-						rightChild.Path,
-						new(big.Int).Exp(
-							new(big.Int).SetUint64(2),
-							new(big.Int).SetUint64(uint64(rightChild.Length)), nil)),
-					new(big.Int).Set(rightChild.Bottom),
-				}
+				n.Encoding, err = rightChild.extend(1)
 			default:
 				n.Encoding = Encoding{
 					0, new(big.Int), pedersen.Digest(leftChild.Hash, rightChild.Hash),
 				}
 			}
+			if err != nil {
+				// The child's edge is already as long as an edge can be,
+				// which only a corrupt node gets to.
+				t.fail(fmt.Errorf("%w at path %q (depth %d): %v", ErrCorruptTrie, parent, height, err))
+				return
+			}
 
 			// Compute its hash.
 			n.hash()
@@ -154,16 +317,26 @@ func (t *Trie) diff(key *big.Int) {
 
 // Delete removes a key-value pair from the trie.
 func (t *Trie) Delete(key *big.Int) {
+	if t.err != nil {
+		return
+	}
 	// The internal representation of big.Int has the least significant
 	// bit in the 0th position but this algorithm assumes the oppose so
 	// a copy with the bits reversed is used instead.
 	rev := Reversed(key, t.keyLen)
 
-	t.remove(Prefix(rev, t.keyLen))
+	// If the leaf does not exist, the trie is left unchanged so there is
+	// nothing to recompute.
+	leaf := Prefix(rev, t.keyLen)
+	if !t.exists(leaf) {
+		return
+	}
+	t.remove(leaf)
 	t.diff(rev)
 }
 
-// Get retrieves a value from the trie with the corresponding key.
+// Get retrieves a value from the trie with the corresponding key. A key
+// whose leaf can't be read isn't found; Err tells it apart.
 func (t *Trie) Get(key *big.Int) (*big.Int, bool) {
 	// The internal representation of big.Int has the least significant
 	// bit in the 0th position but this algorithm assumes the opposite so
@@ -175,8 +348,128 @@ func (t *Trie) Get(key *big.Int) (*big.Int, bool) {
 	return node.Bottom, true
 }
 
+// MultiGet retrieves the values of the given keys from the trie and
+// returns them in the same order as the keys. The value of a key that is
+// not in the trie is nil. Since leaves are stored under their full path,
+// each key is a single lookup; the lookups are made in storage key order
+// so that neighbouring leaves are read together.
+func (t *Trie) MultiGet(keys []*types.Felt) ([]*types.Felt, error) {
+	paths := make([][]byte, len(keys))
+	for i, key := range keys {
+		k := key.Big()
+		if k.BitLen() > t.keyLen {
+			return nil, fmt.Errorf("key %s is longer than %d bits", key, t.keyLen)
+		}
+		paths[i] = Prefix(Reversed(k, t.keyLen), t.keyLen)
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(paths[order[i]], paths[order[j]]) < 0
+	})
+
+	values := make([]*types.Felt, len(keys))
+	for _, i := range order {
+		node, ok := t.retrieve(paths[i])
+		if !ok {
+			continue
+		}
+		value := types.BigToFelt(node.Bottom)
+		values[i] = &value
+	}
+	if err := t.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Prefetch reads the nodes a Put or Delete of the given keys would read,
+// that is, the nodes along their paths and the siblings of those nodes,
+// so that they are loaded into whatever cache backs the store before the
+// keys are updated. The keys are read concurrently, so the store must be
+// safe for concurrent reads, like a db.KeyValueStore over a db.Database
+// used outside a transaction. Nothing is written and the values read are
+// discarded. Keys longer than the trie's key length are ignored.
+func (t *Trie) Prefetch(keys []*types.Felt) {
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		k := key.Big()
+		if k.BitLen() > t.keyLen {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(k *big.Int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			t.prefetchPath(Prefix(Reversed(k, t.keyLen), t.keyLen))
+		}(k)
+	}
+	wg.Wait()
+}
+
+// prefetchPath reads the root and both children of every node along path.
+func (t *Trie) prefetchPath(path []byte) {
+	// Errors are left to the reads of the update.
+	_, _ = t.store.Get([]byte("root"))
+	for height := 0; height < len(path); height++ {
+		child := make([]byte, height+1)
+		copy(child, path[:height])
+		child[height] = 48 /* "0" */
+		_, _ = t.store.Get(child)
+		child[height] = 49 /* "1" */
+		_, _ = t.store.Get(child)
+	}
+}
+
+// Warm reads every node in the top levels of the trie, the root being
+// the only node of the first level, so that they are loaded into
+// whatever cache backs the store. As only non-empty nodes are stored,
+// the children of a node are only looked for if the node exists. Nothing
+// is written and the values read are discarded, as are the errors of
+// the store, a node that can't be read being left cold. It returns the
+// number of nodes read.
+func (t *Trie) Warm(levels int) int {
+	if levels > t.keyLen+1 {
+		levels = t.keyLen + 1
+	}
+	if levels <= 0 {
+		return 0
+	}
+	if _, err := t.store.Get([]byte("root")); err != nil {
+		return 0
+	}
+	read := 1
+	level := [][]byte{{}}
+	for height := 1; height < levels && len(level) > 0; height++ {
+		var next [][]byte
+		for _, parent := range level {
+			for _, bit := range []byte{48 /* "0" */, 49 /* "1" */} {
+				child := make([]byte, height)
+				copy(child, parent)
+				child[height-1] = bit
+				if _, err := t.store.Get(child); err == nil {
+					read++
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+	return read
+}
+
 // Put inserts a [big.Int] key-value pair in the trie.
 func (t *Trie) Put(key, val *big.Int) {
+	if t.err != nil {
+		return
+	}
 	if val.Cmp(new(big.Int)) == 0 {
 		t.Delete(key)
 		return
@@ -192,6 +485,44 @@ func (t *Trie) Put(key, val *big.Int) {
 	t.diff(rev)
 }
 
+// Iterate calls fn with every key-value pair in the trie, in increasing
+// order of the keys, until fn returns an error or a node can't be read,
+// and returns that error. Nodes
+// are read one at a time, so only the current path is kept in memory.
+func (t *Trie) Iterate(fn func(key, val *big.Int) error) error {
+	var walk func(path []byte) error
+	walk = func(path []byte) error {
+		n, ok := t.retrieve(path)
+		if err := t.Err(); err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if len(path) == t.keyLen {
+			// The path holds the bits of the key, most significant first.
+			key, _ := new(big.Int).SetString(string(path), 2)
+			return fn(key, new(big.Int).Set(n.Bottom))
+		}
+		if err := walk(append(path[:len(path):len(path)], 48 /* "0" */)); err != nil {
+			return err
+		}
+		return walk(append(path[:len(path):len(path)], 49 /* "1" */))
+	}
+	return walk([]byte{})
+}
+
+// Walk calls fn with every leaf of the trie as a key-value pair of felts,
+// in increasing order of the keys, and stops at the first error returned
+// by fn, which is returned. Like Iterate, it reads the nodes one at a time
+// instead of collecting the leaves first.
+func (t *Trie) Walk(fn func(key *types.Felt, value *types.Felt) error) error {
+	return t.Iterate(func(key, val *big.Int) error {
+		k, v := types.BigToFelt(key), types.BigToFelt(val)
+		return fn(&k, &v)
+	})
+}
+
 // Commitment returns the root hash of the trie. If the tree is empty,
 // this value is nil.
 func (t *Trie) Commitment() *big.Int {
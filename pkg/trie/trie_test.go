@@ -1,15 +1,21 @@
 package trie
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
+	"os"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/NethermindEth/juno/pkg/crypto/pedersen"
 	"github.com/NethermindEth/juno/pkg/store"
+	"github.com/NethermindEth/juno/pkg/types"
 )
 
 const testKeyLen = 3
@@ -27,6 +33,108 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+// benchKeyLen is the height of the tries used in benchmarks and
+// matches the height of the StarkNet state and storage tries.
+const benchKeyLen = 251
+
+// benchTrieSizes are the numbers of keys of the tries the benchmarks are
+// run on. A Put hashes every level of the trie, about a quarter of a
+// second in total, so a trie of 10000 keys would take most of an hour
+// to build.
+var benchTrieSizes = [...]int{100, 1000}
+
+// benchFixture is a trie of random keys and the values stored under them.
+type benchFixture struct {
+	trie       Trie
+	keys, vals []*big.Int
+}
+
+// benchFixtures holds the tries of benchTrieSizes, which are built once
+// and shared by the benchmarks. The benchmarks leave the keys of a trie
+// in it.
+var benchFixtures = make(map[int]*benchFixture)
+
+// randomPairs returns n random key-value pairs where the keys are
+// benchKeyLen bits long and the values are non-zero. The pairs only
+// depend on n and seed.
+func randomPairs(n int, seed int64) (keys, vals []*big.Int) {
+	r := rand.New(rand.NewSource(seed))
+	max := new(big.Int).Lsh(big.NewInt(1), benchKeyLen)
+	keys, vals = make([]*big.Int, n), make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		keys[i] = new(big.Int).Rand(r, max)
+		vals[i] = new(big.Int).Add(new(big.Int).Rand(r, max), big.NewInt(1))
+	}
+	return keys, vals
+}
+
+// benchTrie returns the trie of size random keys backed by an in-memory
+// store, building it on first use.
+func benchTrie(b *testing.B, size int) *benchFixture {
+	b.Helper()
+	if f, ok := benchFixtures[size]; ok {
+		return f
+	}
+	f := &benchFixture{trie: New(store.New(), benchKeyLen)}
+	f.keys, f.vals = randomPairs(size, 1)
+	for i := range f.keys {
+		f.trie.Put(f.keys[i], f.vals[i])
+	}
+	benchFixtures[size] = f
+	return f
+}
+
+// benchSizes runs bench on the trie of each of benchTrieSizes.
+func benchSizes(b *testing.B, bench func(b *testing.B, f *benchFixture)) {
+	for _, size := range benchTrieSizes {
+		b.Run(fmt.Sprintf("keys=%d", size), func(b *testing.B) {
+			f := benchTrie(b, size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			bench(b, f)
+		})
+	}
+}
+
+// BenchmarkTriePut updates the keys of the trie with new values, so that
+// the trie keeps its size.
+func BenchmarkTriePut(b *testing.B) {
+	benchSizes(b, func(b *testing.B, f *benchFixture) {
+		_, vals := randomPairs(len(f.keys), 2)
+		for i := 0; i < b.N; i++ {
+			j := i % len(f.keys)
+			f.trie.Put(f.keys[j], vals[j])
+		}
+		b.StopTimer()
+		for j := 0; j < b.N && j < len(f.keys); j++ {
+			f.vals[j] = vals[j]
+		}
+	})
+}
+
+func BenchmarkTrieGet(b *testing.B) {
+	benchSizes(b, func(b *testing.B, f *benchFixture) {
+		for i := 0; i < b.N; i++ {
+			f.trie.Get(f.keys[i%len(f.keys)])
+		}
+	})
+}
+
+func BenchmarkTrieDelete(b *testing.B) {
+	benchSizes(b, func(b *testing.B, f *benchFixture) {
+		for i := 0; i < b.N; i++ {
+			j := i % len(f.keys)
+			f.trie.Delete(f.keys[j])
+
+			// Restore the key so that every iteration deletes a key that
+			// is present in the trie.
+			b.StopTimer()
+			f.trie.Put(f.keys[j], f.vals[j])
+			b.StartTimer()
+		}
+	})
+}
+
 func Example() {
 	pairs := [...]struct {
 		key, val *big.Int
@@ -87,7 +195,221 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+// TestDeleteMissing asserts that deleting a key that is not in the trie
+// leaves the commitment unchanged.
+func TestDeleteMissing(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	want := trie.Commitment()
+
+	missing := big.NewInt(6) /* 0b110 */
+	if _, ok := trie.Get(missing); ok {
+		t.Fatalf("key %#v unexpectedly in the trie", missing)
+	}
+	trie.Delete(missing)
+	if got := trie.Commitment(); got.Cmp(want) != 0 {
+		t.Errorf("commitment after deleting a missing key = %x, want %x", got, want)
+	}
+}
+
+// failingStore is a store whose reads fail once failing is set.
+type failingStore struct {
+	store.Ephemeral
+	failing bool
+}
+
+var errRead = errors.New("read failed")
+
+func (f *failingStore) Get(key []byte) ([]byte, error) {
+	if f.failing {
+		return nil, errRead
+	}
+	return f.Ephemeral.Get(key)
+}
+
+func (f *failingStore) Has(key []byte) (bool, error) {
+	if f.failing {
+		return false, errRead
+	}
+	return f.Ephemeral.Has(key)
+}
+
+// TestStoreError asserts that a key missing from the store isn't an
+// error of the trie, while a failed read is, and that the trie stops
+// writing once a read has failed.
+func TestStoreError(t *testing.T) {
+	db := &failingStore{Ephemeral: store.New()}
+	trie := New(db, testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	if _, ok := trie.Get(big.NewInt(6)); ok {
+		t.Fatal("key 6 unexpectedly in the trie")
+	}
+	if err := trie.Err(); err != nil {
+		t.Fatalf("Err() after reading a missing key = %v, want nil", err)
+	}
+	want := trie.Commitment()
+
+	db.failing = true
+	if _, ok := trie.Get(tests[0].key); ok {
+		t.Errorf("Get(%d) found a key in a failing store", tests[0].key)
+	}
+	if err := trie.Err(); !errors.Is(err, errRead) {
+		t.Fatalf("Err() after a failed read = %v, want %v", err, errRead)
+	}
+	if _, err := trie.MultiGet([]*types.Felt{new(types.Felt)}); !errors.Is(err, errRead) {
+		t.Errorf("MultiGet() error = %v, want %v", err, errRead)
+	}
+	if err := trie.Iterate(func(_, _ *big.Int) error { return nil }); !errors.Is(err, errRead) {
+		t.Errorf("Iterate() error = %v, want %v", err, errRead)
+	}
+	if _, _, _, err := trie.Children([]byte{}); !errors.Is(err, errRead) {
+		t.Errorf("Children() error = %v, want %v", err, errRead)
+	}
+	if _, err := trie.RootHashAfter(nil, nil); !errors.Is(err, errRead) {
+		t.Errorf("RootHashAfter() error = %v, want %v", err, errRead)
+	}
+
+	trie.Put(big.NewInt(6), big.NewInt(1))
+	trie.Delete(tests[0].key)
+	db.failing = false
+	reopened := New(db, testKeyLen)
+	if got := reopened.Commitment(); got.Cmp(want) != 0 {
+		t.Errorf("commitment after writes to a failed trie = %x, want %x", got, want)
+	}
+}
+
+// TestCorruptNode asserts that a node with an invalid encoding is an
+// ErrCorruptTrie error of the trie instead of a panic, and that an empty
+// stored value is still a missing node.
+func TestCorruptNode(t *testing.T) {
+	db := store.New()
+	trie := New(db, testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	db.Put([]byte("0"), append([]byte{nodeVersion}, `{"length": 255, "path": 0, "bottom": 1, "hash": 1}`...))
+
+	trie.Put(big.NewInt(6), big.NewInt(1))
+	if err := trie.Err(); !errors.Is(err, ErrCorruptTrie) {
+		t.Errorf("Err() after reading a corrupt node = %v, want %v", err, ErrCorruptTrie)
+	}
+
+	db = store.New()
+	db.Put([]byte("root"), []byte{})
+	empty := New(db, testKeyLen)
+	if got := empty.Commitment(); got.Sign() != 0 {
+		t.Errorf("commitment with an empty root value = %x, want 0", got)
+	}
+	if err := empty.Err(); err != nil {
+		t.Errorf("Err() with an empty root value = %v, want nil", err)
+	}
+}
+
+// TestLegacyNodeUpgrade asserts that nodes stored without a version
+// byte are still read, are left as they are by reads and are rewritten
+// in the current version when the trie is updated.
+func TestLegacyNodeUpgrade(t *testing.T) {
+	db := store.New()
+	trie := New(db, testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	want := trie.Commitment()
+
+	// Rewrite the root node as an unversioned JSON node.
+	root, _ := db.Get([]byte("root"))
+	n, err := decodeNode(root, testKeyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("root"), legacy)
+
+	if got := trie.Commitment(); got.Cmp(want) != 0 {
+		t.Errorf("commitment with a legacy root = %x, want %x", got, want)
+	}
+	if stored, _ := db.Get([]byte("root")); !bytes.Equal(stored, legacy) {
+		t.Errorf("root node after read = %q, want the legacy node %q", stored, legacy)
+	}
+
+	trie.Put(big.NewInt(1), big.NewInt(1))
+	upgraded, _ := db.Get([]byte("root"))
+	if upgraded[0] != nodeVersion {
+		t.Errorf("root node version after update = %d, want %d", upgraded[0], nodeVersion)
+	}
+	if _, err := decodeNode(upgraded, testKeyLen); err != nil {
+		t.Errorf("decodeNode(upgraded root) = %v", err)
+	}
+}
+
+func TestDecodeNodeUnknownVersion(t *testing.T) {
+	if _, err := decodeNode([]byte{0xff, '{', '}'}, testKeyLen); err == nil {
+		t.Error("decodeNode did not fail on an unknown version")
+	}
+	if _, err := decodeNode(nil, testKeyLen); err == nil {
+		t.Error("decodeNode did not fail on an empty node")
+	}
+	if _, err := decodeNode([]byte(`{"length": 3, "path": 0, "bottom": 1, "hash": 1}`), 2); err == nil {
+		t.Error("decodeNode did not fail on an edge longer than the levels below the node")
+	}
+	if _, err := decodeNode([]byte(`{"length": 0, "path": 0, "hash": 1}`), 2); err == nil {
+		t.Error("decodeNode did not fail on a node without a bottom")
+	}
+}
+
 // TestEmptyTrie asserts that the commitment of an empty trie is zero.
+func TestEncodingBits(t *testing.T) {
+	// The edge 0b10 of length 2.
+	e := Encoding{2, big.NewInt(0b10), big.NewInt(1)}
+	for i, want := range []uint{0, 1} {
+		if got, err := e.Bit(i); err != nil || got != want {
+			t.Errorf("Bit(%d) = %d, %v, want %d", i, got, err, want)
+		}
+	}
+	if err := e.SetBit(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ClearBit(1); err != nil {
+		t.Fatal(err)
+	}
+	if e.Path.Cmp(big.NewInt(0b01)) != 0 {
+		t.Errorf("path %b after SetBit(0) and ClearBit(1), want 1", e.Path)
+	}
+	for _, i := range []int{-1, 2} {
+		if _, err := e.Bit(i); !errors.Is(err, ErrPathBounds) {
+			t.Errorf("Bit(%d) returned error %v, want ErrPathBounds", i, err)
+		}
+		if err := e.SetBit(i); !errors.Is(err, ErrPathBounds) {
+			t.Errorf("SetBit(%d) returned error %v, want ErrPathBounds", i, err)
+		}
+		if err := e.ClearBit(i); !errors.Is(err, ErrPathBounds) {
+			t.Errorf("ClearBit(%d) returned error %v, want ErrPathBounds", i, err)
+		}
+	}
+
+	ext, err := e.extend(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext.Length != 3 || ext.Path.Cmp(big.NewInt(0b101)) != 0 {
+		t.Errorf("extended edge %b of length %d, want 101 of length 3", ext.Path, ext.Length)
+	}
+	if e.Path.Cmp(big.NewInt(0b01)) != 0 {
+		t.Errorf("extend modified the path to %b", e.Path)
+	}
+	long := Encoding{255, new(big.Int), big.NewInt(1)}
+	if _, err := long.extend(0); !errors.Is(err, ErrPathBounds) {
+		t.Errorf("extending an edge of length 255 returned error %v, want ErrPathBounds", err)
+	}
+}
+
 func TestEmptyTrie(t *testing.T) {
 	trie := New(store.New(), testKeyLen)
 	if trie.Commitment().Cmp(new(big.Int)) != 0 {
@@ -95,6 +417,49 @@ func TestEmptyTrie(t *testing.T) {
 	}
 }
 
+func TestNewComputeOnly(t *testing.T) {
+	want := New(store.New(), testKeyLen)
+	for _, test := range tests {
+		want.Put(test.key, test.val)
+	}
+
+	// From the empty trie, without a base.
+	trie, err := NewComputeOnly(nil, new(big.Int), testKeyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	if trie.Commitment().Cmp(want.Commitment()) != 0 {
+		t.Errorf("commitment %x, want %x", trie.Commitment(), want.Commitment())
+	}
+
+	// On top of a persisted trie, which isn't modified.
+	db := store.New()
+	base := New(db, testKeyLen)
+	base.Put(tests[0].key, tests[0].val)
+	root := base.Commitment()
+	if _, err := NewComputeOnly(db, new(big.Int), testKeyLen); err == nil {
+		t.Error("a base with another root must be rejected")
+	}
+	trie, err = NewComputeOnly(db, root, testKeyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests[1:] {
+		trie.Put(test.key, test.val)
+	}
+	trie.Delete(tests[0].key)
+	trie.Put(tests[0].key, tests[0].val)
+	if trie.Commitment().Cmp(want.Commitment()) != 0 {
+		t.Errorf("commitment %x, want %x", trie.Commitment(), want.Commitment())
+	}
+	if base.Commitment().Cmp(root) != 0 {
+		t.Error("the base trie must not be modified")
+	}
+}
+
 func TestGet(t *testing.T) {
 	db := store.New()
 	trie := New(db, testKeyLen)
@@ -112,6 +477,464 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestMultiGet(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+
+	keys := make([]*types.Felt, 0, len(tests)+2)
+	for i := len(tests) - 1; i >= 0; i-- {
+		key := types.BigToFelt(tests[i].key)
+		keys = append(keys, &key)
+	}
+	missing := types.BigToFelt(big.NewInt(6))
+	keys = append(keys, &missing, keys[0])
+
+	values, err := trie.MultiGet(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range keys {
+		want, ok := trie.Get(key.Big())
+		switch {
+		case !ok && values[i] != nil:
+			t.Errorf("MultiGet()[%d] = %s for missing key %s, want nil", i, values[i], key)
+		case ok && (values[i] == nil || values[i].Big().Cmp(want) != 0):
+			t.Errorf("MultiGet()[%d] = %v for key %s, want %x", i, values[i], key, want)
+		}
+	}
+
+	tooLong := types.BigToFelt(big.NewInt(1 << testKeyLen))
+	if _, err := trie.MultiGet([]*types.Felt{&tooLong}); err == nil {
+		t.Error("MultiGet did not fail on a key longer than the trie keys")
+	}
+}
+
+// recordingStore is a store that records the keys read from it and
+// counts the writes.
+type recordingStore struct {
+	store.Ephemeral
+	mu     sync.Mutex
+	reads  map[string]bool
+	writes int
+}
+
+func (r *recordingStore) Get(key []byte) ([]byte, error) {
+	r.mu.Lock()
+	r.reads[string(key)] = true
+	r.mu.Unlock()
+	return r.Ephemeral.Get(key)
+}
+
+func (r *recordingStore) Put(key, val []byte) {
+	r.writes++
+	r.Ephemeral.Put(key, val)
+}
+
+func (r *recordingStore) Delete(key []byte) {
+	r.writes++
+	r.Ephemeral.Delete(key)
+}
+
+func TestPrefetch(t *testing.T) {
+	s := &recordingStore{Ephemeral: store.New(), reads: make(map[string]bool)}
+	trie := New(s, testKeyLen)
+	for _, test := range tests[:2] {
+		trie.Put(test.key, test.val)
+	}
+
+	keys := make([]*types.Felt, 0, len(tests)+1)
+	for _, test := range tests[2:] {
+		key := types.BigToFelt(test.key)
+		keys = append(keys, &key)
+	}
+	tooLong := types.BigToFelt(big.NewInt(1 << testKeyLen))
+	keys = append(keys, &tooLong)
+
+	s.reads, s.writes = make(map[string]bool), 0
+	trie.Prefetch(keys)
+	if s.writes != 0 {
+		t.Errorf("Prefetch wrote %d times to the store, want 0", s.writes)
+	}
+	prefetched := s.reads
+
+	// Every node read when the keys are updated must have been prefetched.
+	s.reads = make(map[string]bool)
+	for _, test := range tests[2:] {
+		trie.Put(test.key, test.val)
+	}
+	for key := range s.reads {
+		if !prefetched[key] {
+			t.Errorf("node %q read by Put was not prefetched", key)
+		}
+	}
+}
+
+func TestRootHashAfter(t *testing.T) {
+	want := New(store.New(), testKeyLen)
+	for _, test := range tests {
+		want.Put(test.key, test.val)
+	}
+
+	s := &recordingStore{Ephemeral: store.New(), reads: make(map[string]bool)}
+	trie := New(s, testKeyLen)
+	trie.Put(tests[0].key, tests[0].val)
+	root := trie.Commitment()
+	s.writes = 0
+
+	keys := make([]*types.Felt, 0, len(tests))
+	values := make([]*types.Felt, 0, len(tests))
+	for _, test := range tests[1:] {
+		key, val := types.BigToFelt(test.key), types.BigToFelt(test.val)
+		keys, values = append(keys, &key), append(values, &val)
+	}
+	got, err := trie.RootHashAfter(keys, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Big().Cmp(want.Commitment()) != 0 {
+		t.Errorf("RootHashAfter() = %s, want %x", got.Hex(), want.Commitment())
+	}
+	if s.writes != 0 || trie.Commitment().Cmp(root) != 0 {
+		t.Errorf("RootHashAfter() modified the trie with %d writes", s.writes)
+	}
+
+	if _, err := trie.RootHashAfter(keys, values[1:]); err == nil {
+		t.Error("RootHashAfter() with fewer values than keys returned no error")
+	}
+	tooLong := types.BigToFelt(big.NewInt(1 << testKeyLen))
+	if _, err := trie.RootHashAfter([]*types.Felt{&tooLong}, values[:1]); err == nil {
+		t.Error("RootHashAfter() with a key longer than the trie's returned no error")
+	}
+}
+
+func TestWarm(t *testing.T) {
+	s := &recordingStore{Ephemeral: store.New(), reads: make(map[string]bool)}
+	trie := New(s, testKeyLen)
+	if got := trie.Warm(testKeyLen + 1); got != 0 {
+		t.Errorf("Warm() on an empty trie = %d, want 0", got)
+	}
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+
+	// The leaves of the keys 0b010, 0b011 and 0b101 are under the paths
+	// 010, 011 and 101, whose upper nodes are 0, 1, 01 and 10.
+	for levels, want := range []int{0, 1, 3, 5, 8, 8} {
+		s.reads, s.writes = make(map[string]bool), 0
+		if got := trie.Warm(levels); got != want {
+			t.Errorf("Warm(%d) = %d, want %d", levels, got, want)
+		}
+		if s.writes != 0 {
+			t.Errorf("Warm(%d) wrote %d times to the store, want 0", levels, s.writes)
+		}
+		for key := range s.reads {
+			if key != "root" && len(key) >= levels {
+				t.Errorf("Warm(%d) read the node %q below the warmed levels", levels, key)
+			}
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	var buf bytes.Buffer
+	if err := trie.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(buf.Bytes())
+
+	snapshot, err := OpenSnapshotTrie(r, trie.Commitment(), testKeyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		want, wantOk := trie.Get(test.key)
+		got, ok := snapshot.Get(test.key)
+		if ok != wantOk || (ok && got.Cmp(want) != 0) {
+			t.Errorf("snapshot.Get(%d) = %v, %t, want %v, %t", test.key, got, ok, want, wantOk)
+		}
+	}
+
+	if _, err := OpenSnapshotTrie(r, big.NewInt(1), testKeyLen); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("opening the snapshot with the wrong root returned %v, want %v", err, ErrInvalidSnapshot)
+	}
+	if _, err := OpenSnapshotTrie(r, trie.Commitment(), testKeyLen+1); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("opening the snapshot with the wrong height returned %v, want %v", err, ErrInvalidSnapshot)
+	}
+	truncated := bytes.NewReader(buf.Bytes()[:buf.Len()/2])
+	if _, err := OpenSnapshotTrie(truncated, trie.Commitment(), testKeyLen); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("opening a truncated snapshot returned %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("putting a key in a snapshot trie did not panic")
+		}
+	}()
+	snapshot.Put(big.NewInt(1), big.NewInt(1))
+}
+
+func TestSnapshotEmpty(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	var buf bytes.Buffer
+	if err := trie.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := OpenSnapshotTrie(bytes.NewReader(buf.Bytes()), new(big.Int), testKeyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshot.Commitment(); got.Sign() != 0 {
+		t.Errorf("commitment of an empty snapshot = %d, want 0", got)
+	}
+}
+
+func TestChildren(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	if _, _, _, err := trie.Children([]byte{}); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Children of the root of an empty trie returned error %v, want ErrNodeNotFound", err)
+	}
+	// The keys 0b010, 0b011 and 0b101 give a binary root with an edge of
+	// length 1 to the binary node 0b01 on the left and an edge of length
+	// 2 to the leaf 0b101 on the right.
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	node := func(path string) *Node {
+		n, ok := trie.retrieve([]byte(path))
+		if !ok {
+			t.Fatalf("node %q not found", path)
+		}
+		return &n
+	}
+
+	for _, test := range [...]struct {
+		path        string
+		left, right *Node
+		isLeaf      bool
+	}{
+		{"", node("0"), node("1"), false},
+		{"0", nil, node("01"), false},
+		{"01", node("010"), node("011"), false},
+		{"1", node("101"), nil, false},
+		{"011", nil, nil, true},
+	} {
+		left, right, isLeaf, err := trie.Children([]byte(test.path))
+		if err != nil {
+			t.Errorf("Children(%q) returned error %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(left, test.left) || !reflect.DeepEqual(right, test.right) || isLeaf != test.isLeaf {
+			t.Errorf("Children(%q) = %v, %v, %t, want %v, %v, %t",
+				test.path, left, right, isLeaf, test.left, test.right, test.isLeaf)
+		}
+	}
+
+	if _, _, _, err := trie.Children([]byte("00")); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Children of a missing node returned error %v, want ErrNodeNotFound", err)
+	}
+	if _, _, _, err := trie.Children([]byte("0110")); err == nil {
+		t.Error("Children of a path longer than the key returned no error")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	trie.Put(big.NewInt(0), big.NewInt(4))
+
+	var keys, vals []int64
+	err := trie.Iterate(func(key, val *big.Int) error {
+		keys, vals = append(keys, key.Int64()), append(vals, val.Int64())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{0, 2, 3, 5}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	if want := []int64{4, 1, 1, 1}; !reflect.DeepEqual(vals, want) {
+		t.Errorf("values = %v, want %v", vals, want)
+	}
+
+	// An error stops the iteration.
+	stop := errors.New("stop")
+	n := 0
+	err = trie.Iterate(func(*big.Int, *big.Int) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("Iterate returned %v after %d keys, want the error after 1", err, n)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+
+	// Two indexes built in one pass.
+	byKey := make(map[types.Felt]types.Felt)
+	var keys []types.Felt
+	err := trie.Walk(func(key, value *types.Felt) error {
+		byKey[*key] = *value
+		keys = append(keys, *key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.Felt{types.BigToFelt(big.NewInt(2)), types.BigToFelt(big.NewInt(3)), types.BigToFelt(big.NewInt(5))}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	for _, key := range want {
+		if value := byKey[key]; value != types.BigToFelt(big.NewInt(1)) {
+			t.Errorf("value of %s = %s, want 0x1", key.Hex(), value.Hex())
+		}
+	}
+
+	// An error stops the walk.
+	stop := errors.New("stop")
+	n := 0
+	err = trie.Walk(func(*types.Felt, *types.Felt) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("Walk returned %v after %d leaves, want the error after 1", err, n)
+	}
+}
+
+func TestStats(t *testing.T) {
+	trie := New(store.New(), testKeyLen)
+	if got := trie.Stats(); got.Binary+got.Edge+got.Leaves != 0 {
+		t.Errorf("stats of an empty trie = %+v, want no nodes", got)
+	}
+
+	// The keys 0b010, 0b011 and 0b101 give a binary root with an edge of
+	// length 1 to the binary node 0b01 on the left and an edge of length
+	// 2 to the leaf 0b101 on the right.
+	for _, test := range tests {
+		trie.Put(test.key, test.val)
+	}
+	want := TrieStats{
+		Binary:        2,
+		Edge:          2,
+		Leaves:        3,
+		PathLengths:   map[int]int{1: 1, 2: 1},
+		MaxPathLength: 2,
+		AvgPathLength: 1.5,
+		LeafDepths:    map[int]int{2: 1, 3: 2},
+		MaxLeafDepth:  3,
+		AvgLeafDepth:  8.0 / 3,
+	}
+	if got := trie.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestProve(t *testing.T) {
+	const keyLen = 8
+	trie := New(store.New(), keyLen)
+	// The proof of any key in an empty trie is empty.
+	if proof := trie.Prove(big.NewInt(1)); len(proof) != 0 {
+		t.Errorf("proof in an empty trie has %d nodes, want 0", len(proof))
+	}
+	for i := 0; i < 12; i++ {
+		trie.Put(big.NewInt(rand.Int63n(1<<keyLen)), big.NewInt(rand.Int63n(1000)+1))
+	}
+	root := trie.Commitment()
+
+	// Every key, in the trie or not, is proven.
+	for k := int64(0); k < 1<<keyLen; k++ {
+		key := big.NewInt(k)
+		got, err := VerifyProof(root, key, keyLen, trie.Prove(key))
+		if err != nil {
+			t.Fatalf("proof of key %d: %v", k, err)
+		}
+		want, ok := trie.Get(key)
+		if ok != (got != nil) || (ok && got.Cmp(want) != 0) {
+			t.Errorf("proven value of key %d = %v, want %v", k, got, want)
+		}
+	}
+
+	// A proof against another root or with a changed node fails.
+	var key *big.Int
+	for k := int64(0); key == nil; k++ {
+		if _, ok := trie.Get(big.NewInt(k)); ok {
+			key = big.NewInt(k)
+		}
+	}
+	proof := trie.Prove(key)
+	if _, err := VerifyProof(new(big.Int).Add(root, big.NewInt(1)), key, keyLen, proof); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("proof against another root returned %v, want %v", err, ErrInvalidProof)
+	}
+	last := proof[len(proof)-1]
+	if last.Edge != nil {
+		last.Edge = &EdgeNode{Child: new(big.Int).Add(last.Edge.Child, big.NewInt(1)), Path: last.Edge.Path, Length: last.Edge.Length}
+	} else {
+		last.Binary = &BinaryNode{Left: new(big.Int).Add(last.Binary.Left, big.NewInt(1)), Right: last.Binary.Right}
+	}
+	proof[len(proof)-1] = last
+	if _, err := VerifyProof(root, key, keyLen, proof); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("proof with a changed node returned %v, want %v", err, ErrInvalidProof)
+	}
+	if _, err := VerifyProof(root, key, keyLen, nil); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("empty proof of a non-empty trie returned %v, want %v", err, ErrInvalidProof)
+	}
+}
+
+// TestPutDeleteInverse checks, for random sequences of puts and deletes,
+// that putting a new key and deleting it leaves the commitment unchanged
+// and that deleting every key leaves an empty trie.
+func TestPutDeleteInverse(t *testing.T) {
+	const keyLen = 8
+	for run := 0; run < 4; run++ {
+		trie := New(store.New(), keyLen)
+		present := make(map[int64]bool)
+		for op := 0; op < 24; op++ {
+			key := big.NewInt(rand.Int63n(1 << keyLen))
+			if present[key.Int64()] && rand.Intn(2) == 0 {
+				trie.Delete(key)
+				delete(present, key.Int64())
+				continue
+			}
+			val := big.NewInt(rand.Int63n(1<<16) + 1)
+			if !present[key.Int64()] {
+				before := trie.Commitment()
+				trie.Put(key, val)
+				trie.Delete(key)
+				if got := trie.Commitment(); got.Cmp(before) != 0 {
+					t.Fatalf("run %d: commitment after put(%d) and delete(%d) = %x, want %x", run, key, key, got, before)
+				}
+			}
+			trie.Put(key, val)
+			present[key.Int64()] = true
+		}
+
+		for key := range present {
+			trie.Delete(big.NewInt(key))
+		}
+		if got := trie.Commitment(); got.Sign() != 0 {
+			t.Errorf("run %d: commitment after deleting every key = %x, want 0", run, got)
+		}
+		if _, ok := trie.retrieve([]byte{}); ok {
+			t.Errorf("run %d: root node still stored after deleting every key", run)
+		}
+	}
+}
+
 // TestInvariant checks that the root hash is independent of the
 // insertion and deletion order.
 func TestInvariant(t *testing.T) {
@@ -149,6 +972,54 @@ func TestInvariant(t *testing.T) {
 	})
 }
 
+// TestPermutations checks that every insertion order of the same set
+// of keys gives the same root hash, including keys that share long
+// prefixes and keys at the edges of the key space.
+func TestPermutations(t *testing.T) {
+	const keyLen = 8
+	commitment := func(keys []*big.Int) *big.Int {
+		trie := New(store.New(), keyLen)
+		for _, key := range keys {
+			trie.Put(key, new(big.Int).Add(key, big.NewInt(1)))
+		}
+		return trie.Commitment()
+	}
+
+	// Every order of a small set.
+	keys := []*big.Int{
+		big.NewInt(0), big.NewInt(1), big.NewInt(0b10000000), big.NewInt(0b10000001), big.NewInt(0b11111111),
+	}
+	want := commitment(keys)
+	var permute func(k int)
+	permute = func(k int) {
+		if k == len(keys) {
+			if got := commitment(keys); got.Cmp(want) != 0 {
+				t.Errorf("commitment of keys inserted in the order %v = %x, want %x", keys, got, want)
+			}
+			return
+		}
+		for i := k; i < len(keys); i++ {
+			keys[k], keys[i] = keys[i], keys[k]
+			permute(k + 1)
+			keys[k], keys[i] = keys[i], keys[k]
+		}
+	}
+	permute(0)
+
+	// Random orders of a larger set.
+	keys = keys[:0]
+	for _, k := range rand.Perm(1 << keyLen)[:32] {
+		keys = append(keys, big.NewInt(int64(k)))
+	}
+	want = commitment(keys)
+	for run := 0; run < 8; run++ {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		if got := commitment(keys); got.Cmp(want) != 0 {
+			t.Errorf("run %d: commitment of keys inserted in the order %v = %x, want %x", run, keys, got, want)
+		}
+	}
+}
+
 // TestRebuild tests that the trie can be reconstructed from storage.
 func TestRebuild(t *testing.T) {
 	db := store.New()
@@ -186,17 +1057,17 @@ func TestPut(t *testing.T) {
 		t.Run(fmt.Sprintf("put(%#v, %#v)", test.key, test.val), func(t *testing.T) {
 			trie.Put(test.key, test.val)
 			pre := Prefix(Reversed(test.key, testKeyLen), testKeyLen)
-			got, ok := db.Get(pre)
-			if !ok {
+			got, err := db.Get(pre)
+			if err != nil {
 				// A key with a value 0 is deleted.
 				if test.val.Cmp(new(big.Int)) == 0 {
 					t.Skip()
 				}
 				t.Fatalf("failed to retrieve value with key %s from database", pre)
 			}
-			var n Node
-			if err := json.Unmarshal(got, &n); err != nil {
-				t.Fatal("failed to unmarshal value from database")
+			n, err := decodeNode(got, 0)
+			if err != nil {
+				t.Fatal("failed to decode value from database")
 			}
 			if test.val.Cmp(n.Bottom) != 0 {
 				t.Errorf("failed to put value %#v at key %#v", test.key, test.val)
@@ -323,3 +1194,67 @@ func TestState(t *testing.T) {
 		t.Errorf("state.Commitment() = %x, want = %x", got, want)
 	}
 }
+
+// replayFixture is the recorded feeder gateway state update of block 0 of
+// the StarkNet mainnet.
+const replayFixture = "../starknet/testdata/state_updates/mainnet/0.json"
+
+// blockUpdate is the part of a feeder gateway state update that replay
+// applies.
+type blockUpdate struct {
+	NewRoot   string `json:"new_root"`
+	StateDiff struct {
+		StorageDiffs map[string][]struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"storage_diffs"`
+		DeployedContracts []struct {
+			Address   string `json:"address"`
+			ClassHash string `json:"class_hash"`
+		} `json:"deployed_contracts"`
+	} `json:"state_diff"`
+}
+
+// replay applies the state diff of update to an empty state and returns
+// the commitment of the state trie. The storage of every contract is
+// built in a trie of its own, whose root goes into the contract's leaf
+// along with its class hash.
+func replay(update *blockUpdate) *big.Int {
+	classHashes := make(map[string]*big.Int)
+	for _, contract := range update.StateDiff.DeployedContracts {
+		classHashes[contract.Address] = types.HexToFelt(contract.ClassHash).Big()
+	}
+	state := New(store.New(), benchKeyLen)
+	for address, classHash := range classHashes {
+		storage := New(store.New(), benchKeyLen)
+		for _, slot := range update.StateDiff.StorageDiffs[address] {
+			storage.Put(types.HexToFelt(slot.Key).Big(), types.HexToFelt(slot.Value).Big())
+		}
+		val := pedersen.Digest(pedersen.Digest(pedersen.Digest(classHash, storage.Commitment()), new(big.Int)), new(big.Int))
+		state.Put(types.HexToFelt(address).Big(), val)
+	}
+	return state.Commitment()
+}
+
+// BenchmarkBlockReplay measures the time it takes to apply the recorded
+// state diff of block 0 of the StarkNet mainnet. It doubles as a
+// regression guard: the benchmark fails if the resulting root is not the
+// one reported by the feeder gateway.
+func BenchmarkBlockReplay(b *testing.B) {
+	raw, err := os.ReadFile(replayFixture)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var update blockUpdate
+	if err := json.Unmarshal(raw, &update); err != nil {
+		b.Fatal(err)
+	}
+	want := types.HexToFelt(update.NewRoot).Big()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if got := replay(&update); got.Cmp(want) != 0 {
+			b.Fatalf("replay of block 0 = %x, want %x", got, want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package trietest provides helpers to build and check tries in tests.
+package trietest
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/pkg/store"
+	"github.com/NethermindEth/juno/pkg/trie"
+	"github.com/NethermindEth/juno/pkg/types"
+)
+
+// BuildTrie returns a trie of the given height in an in-memory store
+// with the given entries put in it.
+func BuildTrie(t testing.TB, entries map[*types.Felt]*types.Felt, height int) *trie.Trie {
+	t.Helper()
+	tr := trie.New(store.New(), height)
+	for key, val := range entries {
+		if key.Big().BitLen() > height {
+			t.Fatalf("key %s is longer than %d bits", key.Hex(), height)
+		}
+		tr.Put(key.Big(), val.Big())
+	}
+	return &tr
+}
+
+// AssertRoot fails the test if the commitment of tr isn't the felt given
+// in hex.
+func AssertRoot(t testing.TB, tr *trie.Trie, expectedHex string) {
+	t.Helper()
+	expected, err := types.FeltFromHex(expectedHex)
+	if err != nil {
+		t.Fatalf("expected root: %v", err)
+	}
+	if root := types.BigToFelt(tr.Commitment()); root != expected {
+		t.Errorf("trie root = %s, want %s", root.Hex(), expected.Hex())
+	}
+}
@@ -2,6 +2,8 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 )
 
 type BlockStatus int32
@@ -34,12 +36,24 @@ var (
 	}
 )
 
-func StringToBlockStatus(s string) BlockStatus {
+// ErrUnknownBlockStatus is returned by ParseBlockStatus for a string that
+// isn't the name of a BlockStatus.
+var ErrUnknownBlockStatus = errors.New("unknown block status")
+
+// ParseBlockStatus returns the BlockStatus named s, as in the responses
+// of the feeder gateway. For any other string, it returns
+// BlockStatusUnknown and ErrUnknownBlockStatus, so that a status added to
+// the gateway isn't mistaken for a known one.
+func ParseBlockStatus(s string) (BlockStatus, error) {
 	blockStatus, ok := BlockStatusValue[s]
 	if !ok {
-		// notest
-		return BlockStatusUnknown
+		return BlockStatusUnknown, fmt.Errorf("%w: %q", ErrUnknownBlockStatus, s)
 	}
+	return blockStatus, nil
+}
+
+func StringToBlockStatus(s string) BlockStatus {
+	blockStatus, _ := ParseBlockStatus(s)
 	return blockStatus
 }
 
@@ -96,4 +110,40 @@ type Block struct {
 
 	EventCount      uint64 `json:"event_count"`
 	EventCommitment Felt   `json:"event_commitment"`
+
+	// RawStatus is the status of the block as received when it isn't the
+	// name of a BlockStatus, in which case Status is BlockStatusUnknown.
+	RawStatus string `json:"raw_status,omitempty"`
+}
+
+// Equal reports whether b and other are the same block, field by field.
+// The transaction hashes must be in the same order. A nil and an empty
+// list of transaction hashes are equal, as they are once stored.
+func (b *Block) Equal(other *Block) bool {
+	if b == nil || other == nil {
+		return b == other
+	}
+	if b.BlockHash != other.BlockHash ||
+		b.ParentHash != other.ParentHash ||
+		b.BlockNumber != other.BlockNumber ||
+		b.Status != other.Status ||
+		b.RawStatus != other.RawStatus ||
+		b.Sequencer != other.Sequencer ||
+		b.NewRoot != other.NewRoot ||
+		b.OldRoot != other.OldRoot ||
+		b.AcceptedTime != other.AcceptedTime ||
+		b.TimeStamp != other.TimeStamp ||
+		b.TxCount != other.TxCount ||
+		b.TxCommitment != other.TxCommitment ||
+		b.EventCount != other.EventCount ||
+		b.EventCommitment != other.EventCommitment ||
+		len(b.TxHashes) != len(other.TxHashes) {
+		return false
+	}
+	for i := range b.TxHashes {
+		if b.TxHashes[i] != other.TxHashes[i] {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseBlockStatus(t *testing.T) {
+	for status, name := range BlockStatusName {
+		got, err := ParseBlockStatus(name)
+		if err != nil || got != status {
+			t.Errorf("ParseBlockStatus(%q) = %v, %v, want %v", name, got, err, status)
+		}
+	}
+	for _, name := range []string{"", "accepted_on_l2", "NEW_STATUS"} {
+		got, err := ParseBlockStatus(name)
+		if !errors.Is(err, ErrUnknownBlockStatus) || got != BlockStatusUnknown {
+			t.Errorf("ParseBlockStatus(%q) = %v, %v, want %v, %v", name, got, err, BlockStatusUnknown, ErrUnknownBlockStatus)
+		}
+	}
+}
+
+func TestBlockEqual(t *testing.T) {
+	newBlock := func() *Block {
+		return &Block{
+			BlockHash:   HexToBlockHash("43950c9e3565cba1f2627b219d4863380f93a8548818ce26019d1bd5eebb0fb"),
+			ParentHash:  HexToBlockHash("f8fe26de3ce9ee4d543b1152deb2ce549e589524d79598227761d6006b74a9"),
+			BlockNumber: 2175,
+			Status:      BlockStatusAcceptedOnL2,
+			NewRoot:     HexToFelt("6a42d697b5b735eef03bb71841ed5099d57088f7b5eec8e356fe2601d5ba08f"),
+			TxCount:     2,
+			TxHashes:    []TransactionHash{HexToTransactionHash("1"), HexToTransactionHash("2")},
+			EventCount:  19,
+		}
+	}
+	tests := [...]struct {
+		name   string
+		change func(b *Block)
+		equal  bool
+	}{
+		{"same", func(b *Block) {}, true},
+		{"parent hash", func(b *Block) { b.ParentHash = HexToBlockHash("1") }, false},
+		{"status", func(b *Block) { b.Status = BlockStatusAcceptedOnL1 }, false},
+		{"raw status", func(b *Block) { b.Status, b.RawStatus = BlockStatusUnknown, "NEW_STATUS" }, false},
+		{"new root", func(b *Block) { b.NewRoot = HexToFelt("1") }, false},
+		{"event count", func(b *Block) { b.EventCount++ }, false},
+		{"tx hash order", func(b *Block) { b.TxHashes[0], b.TxHashes[1] = b.TxHashes[1], b.TxHashes[0] }, false},
+		{"missing tx hash", func(b *Block) { b.TxHashes = b.TxHashes[:1] }, false},
+	}
+	for _, test := range tests {
+		b := newBlock()
+		test.change(b)
+		if got := newBlock().Equal(b); got != test.equal {
+			t.Errorf("%s: Equal() = %t, want %t", test.name, got, test.equal)
+		}
+	}
+
+	empty, noHashes := newBlock(), newBlock()
+	empty.TxHashes, noHashes.TxHashes = []TransactionHash{}, nil
+	if !empty.Equal(noHashes) {
+		t.Error("blocks with empty and nil transaction hashes are not equal")
+	}
+	var nilBlock *Block
+	if nilBlock.Equal(newBlock()) || !nilBlock.Equal(nil) {
+		t.Error("a nil block must only be equal to nil")
+	}
+}
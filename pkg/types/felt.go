@@ -5,10 +5,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 
 	"github.com/NethermindEth/juno/pkg/common"
+	"github.com/NethermindEth/juno/pkg/crypto/weierstrass"
 )
 
 const (
@@ -16,6 +18,18 @@ const (
 	FeltLength = 32
 )
 
+var (
+	// ErrInvalidFeltHex is returned by FeltFromHex when the string is not
+	// a hexadecimal number.
+	ErrInvalidFeltHex = errors.New("invalid hexadecimal felt")
+	// ErrFeltOutOfRange is returned by FeltFromHex when the number is not
+	// lower than the field prime.
+	ErrFeltOutOfRange = errors.New("felt out of range")
+)
+
+// feltPrime is the prime number 2²⁵¹ + 17·2¹⁹² + 1.
+var feltPrime = weierstrass.Stark().Params().P
+
 type IsFelt interface {
 	Felt() Felt
 }
@@ -36,6 +50,26 @@ func HexToFelt(s string) Felt {
 	return BytesToFelt(common.FromHex(s))
 }
 
+// FeltFromHex parses a hexadecimal string, with or without the 0x
+// prefix, into a Felt. Leading zeros are allowed, so "0" and "0x0" are
+// both zero, but a string without any digit is not. Unlike HexToFelt,
+// numbers that are not lower than the field prime are rejected instead
+// of being truncated.
+func FeltFromHex(s string) (Felt, error) {
+	digits := s
+	if len(digits) >= 2 && digits[0] == '0' && (digits[1] == 'x' || digits[1] == 'X') {
+		digits = digits[2:]
+	}
+	n, ok := new(big.Int).SetString(digits, 16)
+	if !ok || n.Sign() < 0 {
+		return Felt{}, fmt.Errorf("%w: %q", ErrInvalidFeltHex, s)
+	}
+	if n.Cmp(feltPrime) >= 0 {
+		return Felt{}, fmt.Errorf("%w: %s", ErrFeltOutOfRange, s)
+	}
+	return BigToFelt(n), nil
+}
+
 func (f Felt) Bytes() []byte {
 	return f[:]
 }
@@ -44,6 +78,16 @@ func (f Felt) Big() *big.Int {
 	return new(big.Int).SetBytes(f[:])
 }
 
+// Bit returns whether the i'th bit of f is set. Bits are indexed from the
+// least significant one, the same order used by big.Int.Bit, so bit 0 is
+// the lowest bit of the last byte. Bits out of range are never set.
+func (f Felt) Bit(i int) bool {
+	if i < 0 || i >= FeltLength*8 {
+		return false
+	}
+	return f[FeltLength-1-i/8]>>(i%8)&1 == 1
+}
+
 func (f Felt) Hex() string {
 	enc := make([]byte, len(f)*2)
 	hex.Encode(enc, f[:])
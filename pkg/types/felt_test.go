@@ -3,8 +3,10 @@ package types
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -163,6 +165,27 @@ func TestFelt_Hex(t *testing.T) {
 	}
 }
 
+func TestFelt_HexCanonical(t *testing.T) {
+	// Felts equal as numbers have the same Hex whatever they were built
+	// from.
+	for _, want := range []string{"0x0", "0x1", "0xa0", "0x1000000000000000000000000000000000000000000000000000000000000"} {
+		n, _ := new(big.Int).SetString(want[2:], 16)
+		padded := make([]byte, FeltLength)
+		n.FillBytes(padded)
+		for _, f := range []Felt{
+			BigToFelt(n),
+			BytesToFelt(n.Bytes()),
+			BytesToFelt(padded),
+			HexToFelt(want),
+			HexToFelt("0x000" + want[2:]),
+		} {
+			if got := f.Hex(); got != want {
+				t.Errorf("Hex() = %s, want %s", got, want)
+			}
+		}
+	}
+}
+
 func TestFelt_String(t *testing.T) {
 	type TestCase struct {
 		Input Felt
@@ -285,3 +308,57 @@ func TestFelt_UnmarshalJSON(t *testing.T) {
 		t.Error("unexpected nil error, want: \"unexpected token type\"")
 	}
 }
+
+func TestFeltBit(t *testing.T) {
+	keys := [...]string{
+		"0x0",
+		"0xa",
+		"0x2ca7c49c9b7f58265a",
+		"0x9cb17c8249aa59d4561deb4d1e51d640c49f355bf74c76a6c3",
+		"0xc1e3718ac229397d192530c0ca37982fd6609a2b9efa2fbc09c1df983f43d225",
+	}
+	for _, key := range keys {
+		want, _ := new(big.Int).SetString(key[2:], 16)
+		f := HexToFelt(key)
+		for i := 0; i < FeltLength*8; i++ {
+			if got := f.Bit(i); got != (want.Bit(i) == 1) {
+				t.Errorf("HexToFelt(%s).Bit(%d) = %t, want %d", key, i, got, want.Bit(i))
+			}
+		}
+	}
+	if f := HexToFelt("0xa"); !f.Bit(1) || f.Bit(0) || !f.Bit(3) || f.Bit(FeltLength*8) || f.Bit(-1) {
+		t.Errorf("HexToFelt(0xa) bits do not follow the least significant bit first order")
+	}
+}
+
+func TestFeltFromHex(t *testing.T) {
+	tests := [...]struct {
+		Input string
+		Want  Felt
+		Err   error
+	}{
+		{"0x0", Felt{}, nil},
+		{"0", Felt{}, nil},
+		{"0x000", Felt{}, nil},
+		{"a", BigToFelt(big.NewInt(10)), nil},
+		{"0xa", BigToFelt(big.NewInt(10)), nil},
+		{"0XA", BigToFelt(big.NewInt(10)), nil},
+		{"0x800000000000011000000000000000000000000000000000000000000000000", HexToFelt("0x800000000000011000000000000000000000000000000000000000000000000"), nil},
+		{"", Felt{}, ErrInvalidFeltHex},
+		{"0x", Felt{}, ErrInvalidFeltHex},
+		{"0xz", Felt{}, ErrInvalidFeltHex},
+		{"0x-1", Felt{}, ErrInvalidFeltHex},
+		{"0x800000000000011000000000000000000000000000000000000000000000001", Felt{}, ErrFeltOutOfRange},
+		{"0x1" + strings.Repeat("0", 64), Felt{}, ErrFeltOutOfRange},
+	}
+	for _, test := range tests {
+		got, err := FeltFromHex(test.Input)
+		if !errors.Is(err, test.Err) {
+			t.Errorf("FeltFromHex(%q) error = %v, want %v", test.Input, err, test.Err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("FeltFromHex(%q) = %s, want %s", test.Input, got, test.Want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"bytes"
+	"sort"
+)
+
+// FeltMap is a map keyed by Felt whose entries are iterated in increasing
+// key order, so that anything derived from it is deterministic. The zero
+// value is an empty map ready to use.
+type FeltMap[V any] struct {
+	values map[Felt]V
+	// keys holds the keys of values in increasing order.
+	keys []Felt
+}
+
+// Len returns the number of entries in the map.
+func (m *FeltMap[V]) Len() int {
+	return len(m.keys)
+}
+
+// Get returns the value stored under key and whether it was found.
+func (m *FeltMap[V]) Get(key Felt) (V, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Put stores value under key, replacing the previous value if any.
+func (m *FeltMap[V]) Put(key Felt, value V) {
+	if m.values == nil {
+		m.values = make(map[Felt]V)
+	}
+	if _, ok := m.values[key]; !ok {
+		i := sort.Search(len(m.keys), func(i int) bool {
+			return bytes.Compare(m.keys[i][:], key[:]) >= 0
+		})
+		m.keys = append(m.keys, Felt{})
+		copy(m.keys[i+1:], m.keys[i:])
+		m.keys[i] = key
+	}
+	m.values[key] = value
+}
+
+// Range calls f for each entry in increasing key order until f returns
+// false. The map must not be modified by f.
+func (m *FeltMap[V]) Range(f func(key Felt, value V) bool) {
+	for _, key := range m.keys {
+		if !f(key, m.values[key]) {
+			return
+		}
+	}
+}
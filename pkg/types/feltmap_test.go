@@ -0,0 +1,49 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFeltMap(t *testing.T) {
+	var m FeltMap[string]
+	if _, ok := m.Get(HexToFelt("0x1")); ok {
+		t.Error("Get on an empty map found a value")
+	}
+	for _, k := range []int64{5, 1, 300, 2, 1} {
+		m.Put(BigToFelt(big.NewInt(k)), big.NewInt(k).String())
+	}
+	m.Put(BigToFelt(big.NewInt(2)), "two")
+
+	if m.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", m.Len())
+	}
+	if v, ok := m.Get(BigToFelt(big.NewInt(2))); !ok || v != "two" {
+		t.Errorf("Get(2) = %q, %t, want %q, true", v, ok, "two")
+	}
+
+	want := []struct {
+		key   int64
+		value string
+	}{{1, "1"}, {2, "two"}, {5, "5"}, {300, "300"}}
+	i := 0
+	m.Range(func(key Felt, value string) bool {
+		if key != BigToFelt(big.NewInt(want[i].key)) || value != want[i].value {
+			t.Errorf("entry %d = (%s, %q), want (%d, %q)", i, key, value, want[i].key, want[i].value)
+		}
+		i++
+		return true
+	})
+	if i != len(want) {
+		t.Errorf("Range visited %d entries, want %d", i, len(want))
+	}
+
+	i = 0
+	m.Range(func(Felt, string) bool {
+		i++
+		return i < 2
+	})
+	if i != 2 {
+		t.Errorf("Range did not stop when f returned false, visited %d entries", i)
+	}
+}
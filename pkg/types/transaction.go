@@ -54,6 +54,23 @@ func (tx *TransactionDeploy) GetHash() TransactionHash {
 	return tx.Hash
 }
 
+// TransactionDeployAccount is a transaction that deploys an account
+// contract, which pays for its own deployment.
+type TransactionDeployAccount struct {
+	Hash                TransactionHash
+	ContractAddress     Address
+	ClassHash           Felt
+	ContractAddressSalt Felt
+	ConstructorCallData []Felt
+	Signature           []Felt
+	Nonce               Felt
+	MaxFee              Felt
+}
+
+func (tx *TransactionDeployAccount) GetHash() TransactionHash {
+	return tx.Hash
+}
+
 type TransactionInvoke struct {
 	Hash               TransactionHash `json:"txn_hash"`
 	ContractAddress    Address         `json:"contract_address"`